@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/saku-730/bio-occurrence/backend/internal/config"
+	"github.com/saku-730/bio-occurrence/backend/internal/export"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+)
+
+// 系統比較の解析に使う形式で書き出す (API の /api/export/... と同じもの)
+// 書き出すのは公開の記録だけ。-user を付けると、その人の非公開の記録も入れる
+//
+//	export [設定のフラグ] matrix [-format csv|nexus|tnt] [-rank family] [-taxon ncbi:9604] [-predicate RO:0000053,...] [-user ID] [-o ファイル]
+//	export [設定のフラグ] tree [-format newick|phyloxml] [-taxon ncbi:9604] [-owner ID] [-user ID] [-o ファイル]
+func main() {
+	cfg := config.MustLoad(config.SectionFuseki)
+	if len(cfg.Args) == 0 {
+		log.Fatalf("❌ usage: export [flags] matrix|tree [options]")
+	}
+
+	occRepo := repository.NewOccurrenceRepository(cfg.Fuseki.URL, cfg.Fuseki.User, cfg.Fuseki.Password, cfg.URIs.BaseURIs(), cfg.Log.SlowQueryThreshold.Std())
+	svc := service.NewExportService(occRepo, service.NewTaxonLineageCache(occRepo))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch cfg.Args[0] {
+	case "matrix":
+		err = runMatrix(ctx, svc, cfg.Args[1:])
+	case "tree":
+		err = runTree(ctx, svc, cfg.Args[1:])
+	default:
+		log.Fatalf("❌ Unknown export: %s (matrix / tree)", cfg.Args[0])
+	}
+	if err != nil {
+		log.Fatalf("❌ Export failed: %v", err)
+	}
+}
+
+func runMatrix(ctx context.Context, svc service.ExportService, args []string) error {
+	fs := flag.NewFlagSet("matrix", flag.ExitOnError)
+	format := fs.String("format", model.MatrixFormatCSV, "csv / nexus / tnt")
+	rank := fs.String("rank", "", "この階級の祖先にまとめる (kingdom / phylum / class / order / family / genus / species)")
+	taxon := fs.String("taxon", "", "この分類群と子孫の記録だけ (ID か学名)")
+	predicates := fs.String("predicate", "", "形質にする述語のID (カンマ区切り、省くとすべて)")
+	user := fs.String("user", "", "このユーザーの非公開の記録も入れる")
+	out := fs.String("o", "", "書き出すファイル (省くと標準出力)")
+	fs.Parse(args)
+
+	switch *format {
+	case model.MatrixFormatCSV, model.MatrixFormatNEXUS, model.MatrixFormatTNT:
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+	if *rank != "" && !slices.Contains(model.MatrixRanks, *rank) {
+		return fmt.Errorf("unknown rank: %s (%s)", *rank, strings.Join(model.MatrixRanks, " / "))
+	}
+
+	filter := model.TraitMatrixFilter{Format: *format, Rank: *rank, Taxon: *taxon}
+	if *predicates != "" {
+		filter.Predicates = strings.Split(*predicates, ",")
+	}
+
+	log.Printf("🚀 Building taxon x trait matrix (format=%s rank=%s taxon=%s)", *format, *rank, *taxon)
+	m, err := svc.TraitMatrix(ctx, filter, *user)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(*out, func(w io.Writer) error {
+		if err := export.WriteMatrix(w, m, *format); err != nil {
+			return err
+		}
+		log.Printf("✅ Wrote %d taxa x %d characters", len(m.Taxa), len(m.Characters))
+		if len(m.Unplaced) > 0 {
+			log.Printf("⚠️  %d taxa have no %s ancestor and were left out: %s", len(m.Unplaced), *rank, strings.Join(m.Unplaced, ", "))
+		}
+		return nil
+	})
+}
+
+func runTree(ctx context.Context, svc service.ExportService, args []string) error {
+	fs := flag.NewFlagSet("tree", flag.ExitOnError)
+	format := fs.String("format", model.TreeFormatNewick, "newick / phyloxml")
+	taxon := fs.String("taxon", "", "この分類群と子孫の記録だけ (ID か学名)")
+	owner := fs.String("owner", "", "このユーザーの記録だけ")
+	user := fs.String("user", "", "このユーザーの非公開の記録も入れる")
+	out := fs.String("o", "", "書き出すファイル (省くと標準出力)")
+	fs.Parse(args)
+
+	switch *format {
+	case model.TreeFormatNewick, model.TreeFormatPhyloXML:
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+
+	log.Printf("🚀 Building taxon tree (format=%s taxon=%s owner=%s)", *format, *taxon, *owner)
+	tree, err := svc.TaxonTree(ctx, model.TaxonTreeFilter{Format: *format, Taxon: *taxon, Owner: *owner}, *user)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(*out, func(w io.Writer) error {
+		if err := export.WriteTree(w, tree, *format); err != nil {
+			return err
+		}
+		if tree.Root == nil {
+			log.Println("⚠️  No occurrences matched, wrote an empty tree")
+		} else {
+			log.Printf("✅ Wrote tree of %d occurrences", tree.Root.Total)
+		}
+		if len(tree.Unplaced) > 0 {
+			log.Printf("⚠️  %d taxa are not in NCBITaxon and were left out: %s", len(tree.Unplaced), strings.Join(tree.Unplaced, ", "))
+		}
+		return nil
+	})
+}
+
+// writeOutput: path があればそのファイルに、無ければ標準出力に書く
+func writeOutput(path string, write func(io.Writer) error) error {
+	if path == "" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("🎉 Saved to %s", path)
+	return nil
+}
@@ -14,23 +14,29 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/saku-730/bio-occurrence/backend/internal/config"
 )
 
 const (
-	FusekiUpdateURL = "http://localhost:3030/biodb/update"
-	FusekiUser      = "admin"
-	FusekiPass      = "admin123"
-	OboPurlBase     = "http://purl.obolibrary.org/obo/"
-	BatchSize       = 500 // 少し小さめに
+	OboPurlBase = "http://purl.obolibrary.org/obo/"
+	BatchSize   = 500 // 少し小さめに
+
+	// NCBITaxon の階級 (family / order など) を表す述語
+	HasRankPredicate = "http://purl.obolibrary.org/obo/ncbitaxon#has_rank"
 )
 
+// ファイル名 → 入れる名前付きグラフ (<base>ontology/<名前>)
 var ontologyConfig = map[string]string{
-	"pato.obo":      "http://my-db.org/ontology/pato",
-	"ro.obo":        "http://my-db.org/ontology/ro",
-	"envo.obo":      "http://my-db.org/ontology/envo",
-	"ncbitaxon.obo": "http://my-db.org/ontology/ncbitaxon",
+	"pato.obo":      "pato",
+	"ro.obo":        "ro",
+	"envo.obo":      "envo",
+	"ncbitaxon.obo": "ncbitaxon",
 }
 
+// 接続先などの設定 (config.yaml / 環境変数 / フラグ)
+var cfg *config.Config
+
 // 正規表現を事前コンパイル
 var (
 	reSynonym    = regexp.MustCompile(`^synonym:\s*"([^"]+)"`)
@@ -41,11 +47,15 @@ var (
 func main() {
 	log.Println("🚀 Starting improved OBO to RDF Loader (Fuseki)")
 
+	cfg = config.MustLoad(config.SectionFuseki)
+	uris := cfg.URIs.BaseURIs()
+
 	if err := waitForFuseki(); err != nil {
 		log.Fatalf("❌ Fuseki is not ready: %v", err)
 	}
 
-	for filename, graphURI := range ontologyConfig {
+	for filename, graphName := range ontologyConfig {
+		graphURI := uris.OntologyGraph(graphName)
 		filePath := filepath.Join("data", "ontologies", filename)
 		if _, err := os.Stat(filePath); os.IsNotExist(err) {
 			log.Printf("⚠️  File not found: %s (skipping)", filePath)
@@ -63,6 +73,9 @@ func main() {
 			log.Printf("❌ Failed to load %s: %v", filename, err)
 		} else {
 			log.Printf("   -> ✅ Loaded %s successfully.", filename)
+			if err := stampGraph(graphURI); err != nil {
+				log.Printf("⚠️  Failed to stamp graph %s: %v", graphURI, err)
+			}
 		}
 	}
 
@@ -186,6 +199,16 @@ func processAndLoad(filePath, graphURI string) error {
 			continue
 		}
 
+		// --- rank (NCBITaxon の "property_value: has_rank NCBITaxon:family") ---
+		if strings.HasPrefix(line, "property_value: has_rank ") {
+			rankRaw := strings.TrimSpace(strings.TrimPrefix(line, "property_value: has_rank "))
+			if m := reIDToken.FindStringSubmatch(rankRaw); len(m) > 1 && !reIRIInvalid.MatchString(m[1]) {
+				rankSafe := strings.ReplaceAll(m[1], ":", "_")
+				currentTriples = append(currentTriples, fmt.Sprintf("<%s> <%s> <%s%s> .", currentID, HasRankPredicate, OboPurlBase, rankSafe))
+			}
+			continue
+		}
+
 	}
 
 	// 最後の Term をflush
@@ -242,7 +265,7 @@ func sendBatch(triples []string, graphURI string) error {
 
 func waitForFuseki() error {
 	for i := 0; i < 30; i++ {
-		resp, err := http.Get("http://localhost:3030")
+		resp, err := http.Get(cfg.Fuseki.ServerURL())
 		if err == nil && resp.StatusCode == http.StatusOK {
 			return nil
 		}
@@ -266,10 +289,10 @@ func clearGraphWithRetry(graphURI string, retries int) error {
 
 // sendSPARQL: HTTP POST で SPARQL Update を送る（Basic Auth）
 func sendSPARQL(query string) error {
-	req, err := http.NewRequest("POST", FusekiUpdateURL, strings.NewReader(query))
+	req, err := http.NewRequest("POST", cfg.Fuseki.UpdateURL(), strings.NewReader(query))
 	if err != nil { return err }
 	req.Header.Set("Content-Type", "application/sparql-update")
-	auth := FusekiUser + ":" + FusekiPass
+	auth := cfg.Fuseki.User + ":" + cfg.Fuseki.Password
 	encoded := base64.StdEncoding.EncodeToString([]byte(auth))
 	req.Header.Set("Authorization", "Basic "+encoded)
 
@@ -286,6 +309,14 @@ func sendSPARQL(query string) error {
 }
 
 // escapeString: RDF 文字列として安全にする
+// stampGraph: 読み込んだ日時をグラフ自身に書いておく
+// API サーバーはこれを見て分類 (ncbitaxon) の入れ替えに気づき、検索インデックスの系統を付け直すのだ
+func stampGraph(graphURI string) error {
+	query := fmt.Sprintf(`INSERT DATA { GRAPH <%[1]s> { <%[1]s> <http://purl.org/dc/terms/modified> "%[2]s"^^<http://www.w3.org/2001/XMLSchema#dateTime> } }`,
+		graphURI, time.Now().Format(time.RFC3339))
+	return sendSPARQL(query)
+}
+
 func escapeString(s string) string {
 	s = strings.ReplaceAll(s, "\\", "\\\\")
 	s = strings.ReplaceAll(s, "\"", "\\\"")
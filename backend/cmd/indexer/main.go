@@ -12,12 +12,11 @@ import (
 	"strings"
 
 	"github.com/meilisearch/meilisearch-go"
+	"github.com/saku-730/bio-occurrence/backend/internal/config"
 )
 
 // Global Configuration
 const (
-	MeiliURL    = "http://localhost:7700"
-	MeiliKey    = "masterKey123"
 	IndexName   = "ontology"
 	OboPurlBase = "http://purl.obolibrary.org/obo/"
 	BatchSize   = 2000
@@ -45,7 +44,8 @@ var ontologyConfig = map[string]string{
 func main() {
 	log.Println("🚀 Starting Multi-Index Indexer (XSD Support)")
 
-	client := meilisearch.New(MeiliURL, meilisearch.WithAPIKey(MeiliKey))
+	cfg := config.MustLoad(config.SectionMeili)
+	client := meilisearch.New(cfg.Meili.URL, meilisearch.WithAPIKey(cfg.Meili.Key))
 
 	if err := RunBatchIndexer(client); err != nil {
 		log.Fatalf("❌ Indexing failed: %v", err)
@@ -12,31 +12,41 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/saku-730/bio-occurrence/backend/internal/config"
 )
 
 const (
-	FusekiUpdateURL = "http://localhost:3030/biodb/update"
-	FusekiUser      = "admin"
-	FusekiPass      = "admin123"
-	OboPurlBase     = "http://purl.obolibrary.org/obo/"
-	BatchSize       = 1000
+	OboPurlBase = "http://purl.obolibrary.org/obo/"
+	BatchSize   = 1000
+
+	// NCBITaxon の階級 (family / order など) を表す述語
+	HasRankPredicate = "http://purl.obolibrary.org/obo/ncbitaxon#has_rank"
 )
 
+// ファイル名 → 入れる名前付きグラフ (<base>ontology/<名前>、空なら <base>ontology/)
 var ontologyConfig = map[string]string{
-	"pato.obo":      "http://my-db.org/ontology/",
-	"ro.obo":        "http://my-db.org/ontology/",
-	"envo.obo":      "http://my-db.org/ontology/",
-	"ncbitaxon.obo": "http://my-db.org/ontology/ncbitaxon",
+	"pato.obo":      "",
+	"ro.obo":        "",
+	"envo.obo":      "",
+	"ncbitaxon.obo": "ncbitaxon",
 }
 
+// 接続先などの設定 (config.yaml / 環境変数 / フラグ)
+var cfg *config.Config
+
 func main() {
 	log.Println("🚀 Starting OBO to RDF Loader (Fuseki)")
 
+	cfg = config.MustLoad(config.SectionFuseki)
+	uris := cfg.URIs.BaseURIs()
+
 	if err := waitForFuseki(); err != nil {
 		log.Fatalf("❌ Fuseki is not ready: %v", err)
 	}
 
-	for filename, graphURI := range ontologyConfig {
+	for filename, graphName := range ontologyConfig {
+		graphURI := uris.OntologyGraph(graphName)
 		filePath := filepath.Join("data", "ontologies", filename)
 		
 		if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -54,6 +64,9 @@ func main() {
 			log.Printf("❌ Failed to load %s: %v", filename, err)
 		} else {
 			log.Printf("   -> ✅ Loaded %s successfully.", filename)
+			if err := stampGraph(graphURI); err != nil {
+				log.Printf("⚠️  Failed to stamp graph %s: %v", graphURI, err)
+			}
 		}
 	}
 	
@@ -158,6 +171,14 @@ func processAndLoad(filePath, graphURI string) error {
 					syn := escapeString(matches[1])
 					triples = append(triples, fmt.Sprintf("%s <http://www.w3.org/2004/02/skos/core#altLabel> \"%s\" .", currentID, syn))
 				}
+
+			// --- Rank (NCBITaxon の "property_value: has_rank NCBITaxon:family") ---
+			} else if strings.HasPrefix(line, "property_value: has_rank ") {
+				rankRawID := strings.TrimSpace(strings.TrimPrefix(line, "property_value: has_rank "))
+				if strings.Contains(rankRawID, ":") && !strings.ContainsAny(rankRawID, " <>\"{}|\\^`") {
+					rankSafeID := strings.ReplaceAll(rankRawID, ":", "_")
+					triples = append(triples, fmt.Sprintf("%s <%s> <%s%s> .", currentID, HasRankPredicate, OboPurlBase, rankSafeID))
+				}
 			}
 		}
 
@@ -179,7 +200,7 @@ func waitForFuseki() error {
 	// ... (前回と同じなので省略可、そのまま使う) ...
 	// もし消してしまっていたら再掲するので言ってね
 	for i := 0; i < 10; i++ {
-		resp, err := http.Get("http://localhost:3030")
+		resp, err := http.Get(cfg.Fuseki.ServerURL())
 		if err == nil && resp.StatusCode == http.StatusOK {
 			return nil
 		}
@@ -194,12 +215,12 @@ func clearGraph(graphURI string) error {
 }
 
 func sendSPARQL(query string) error {
-	req, err := http.NewRequest("POST", FusekiUpdateURL, strings.NewReader(query))
+	req, err := http.NewRequest("POST", cfg.Fuseki.UpdateURL(), strings.NewReader(query))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/sparql-update")
-	auth := FusekiUser + ":" + FusekiPass
+	auth := cfg.Fuseki.User + ":" + cfg.Fuseki.Password
 	encoded := base64.StdEncoding.EncodeToString([]byte(auth))
 	req.Header.Set("Authorization", "Basic "+encoded)
 
@@ -217,6 +238,14 @@ func sendSPARQL(query string) error {
 	return nil
 }
 
+// stampGraph: 読み込んだ日時をグラフ自身に書いておく
+// API サーバーはこれを見て分類 (ncbitaxon) の入れ替えに気づき、検索インデックスの系統を付け直すのだ
+func stampGraph(graphURI string) error {
+	query := fmt.Sprintf(`INSERT DATA { GRAPH <%[1]s> { <%[1]s> <http://purl.org/dc/terms/modified> "%[2]s"^^<http://www.w3.org/2001/XMLSchema#dateTime> } }`,
+		graphURI, time.Now().Format(time.RFC3339))
+	return sendSPARQL(query)
+}
+
 func escapeString(s string) string {
 	s = strings.ReplaceAll(s, "\\", "\\\\")
 	s = strings.ReplaceAll(s, "\"", "\\\"")
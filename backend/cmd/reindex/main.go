@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/saku-730/bio-occurrence/backend/internal/config"
+	"github.com/saku-730/bio-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+)
+
+// Fuseki の記録から検索インデックス (occurrences) を作り直す
+// 別のインデックスに全件入れてから入れ替えるので、API サーバーを止めなくてよいのだ
+//
+//	reindex [フラグ]          全件作り直す
+//	reindex [フラグ] lineage  系統 (taxon_ancestors・taxon_ranks) だけを今の分類で付け直す
+func main() {
+	cfg := config.MustLoad(config.SectionPostgres, config.SectionFuseki, config.SectionMeili)
+	lineageOnly := false
+	switch {
+	case len(cfg.Args) == 0:
+	case len(cfg.Args) == 1 && cfg.Args[0] == "lineage":
+		lineageOnly = true
+	default:
+		log.Fatalf("❌ Unknown arguments: %s (usage: reindex [flags] [lineage])", strings.Join(cfg.Args, " "))
+	}
+	uris := cfg.URIs.BaseURIs()
+
+	db := infrastructure.NewPostgresDB(cfg.Postgres.Host, cfg.Postgres.Port, cfg.Postgres.User, cfg.Postgres.Password, cfg.Postgres.DBName)
+	defer db.Close()
+
+	occRepo := repository.NewOccurrenceRepository(cfg.Fuseki.URL, cfg.Fuseki.User, cfg.Fuseki.Password, uris, cfg.Log.SlowQueryThreshold.Std())
+	searchRepo := repository.NewSearchRepository(cfg.Meili.URL, cfg.Meili.Key)
+	userRepo := repository.NewUserRepository(db)
+	outboxRepo := repository.NewSearchOutboxRepository(db)
+	auditSvc := service.NewAuditService(repository.NewAuditRepository(db))
+	svc := service.NewReindexService(occRepo, searchRepo, userRepo, outboxRepo, auditSvc, service.NewTaxonLineageCache(occRepo))
+
+	// Ctrl+C で止めたら入れ替えない (作りかけのインデックスは次回の作り直しで消える)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if lineageOnly {
+		refreshLineage(ctx, svc)
+		return
+	}
+
+	log.Println("🚀 Starting occurrence search reindex")
+	report, err := svc.Run(ctx, func(r model.ReindexReport) {
+		if r.Running {
+			log.Printf("   ... Indexed %d occurrences", r.Indexed)
+		}
+	})
+	if err != nil {
+		log.Printf("❌ Reindex failed: %v", err)
+		if report != nil {
+			log.Printf("   -> Indexed %d occurrences before failing (index was not swapped)", report.Indexed)
+		}
+		os.Exit(1)
+	}
+
+	log.Printf("✅ Swapped in new index: %d occurrences (previous index had %d)", report.Indexed, report.Previous)
+	if report.Missing > 0 {
+		log.Printf("⚠️  %d occurrences were missing from the previous index: %s", report.Missing, sample(report.MissingSample, report.Missing))
+	}
+	if report.Stale > 0 {
+		log.Printf("⚠️  %d documents in the previous index no longer exist in Fuseki: %s", report.Stale, sample(report.StaleSample, report.Stale))
+	}
+	if len(report.UnresolvedOwners) > 0 {
+		log.Printf("⚠️  %d owners not found in Postgres (indexed without owner name): %s", len(report.UnresolvedOwners), strings.Join(report.UnresolvedOwners, ", "))
+	}
+	log.Printf("🎉 Done in %s", report.FinishedAt.Sub(report.StartedAt).Round(time.Millisecond))
+}
+
+// refreshLineage: 分類を読み込み直したあと、API サーバーの見張りを待たずに付け直したいとき用
+func refreshLineage(ctx context.Context, svc service.ReindexService) {
+	log.Println("🚀 Refreshing taxon lineage in the search index")
+	start := time.Now()
+
+	report, err := svc.RefreshLineage(ctx)
+	if err != nil {
+		log.Printf("❌ Lineage refresh failed: %v", err)
+		if report != nil {
+			log.Printf("   -> Updated %d taxa (%d occurrences) before failing", report.Taxa, report.Documents)
+		}
+		os.Exit(1)
+	}
+
+	log.Printf("✅ Updated lineage of %d taxa (%d occurrences) for taxonomy version %s", report.Taxa, report.Documents, report.Version)
+	log.Printf("🎉 Done in %s", time.Since(start).Round(time.Millisecond))
+}
+
+func sample(ids []string, total int) string {
+	s := strings.Join(ids, ", ")
+	if total > len(ids) {
+		s += ", ..."
+	}
+	return s
+}
@@ -0,0 +1,505 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/saku-730/bio-occurrence/backend/internal/logging"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+)
+
+// Config: APIサーバーと cmd/* のコマンドで共通の設定
+// 読み込む順番は デフォルト値 → 設定ファイル (YAML/TOML) → 環境変数 → コマンドラインフラグ で、後のものが勝つ
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Postgres  PostgresConfig  `yaml:"postgres" toml:"postgres"`
+	Fuseki    FusekiConfig    `yaml:"fuseki" toml:"fuseki"`
+	Meili     MeiliConfig     `yaml:"meili" toml:"meili"`
+	URIs      URIConfig       `yaml:"uris" toml:"uris"`
+	Mail      MailConfig      `yaml:"mail" toml:"mail"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	OIDC      OIDCConfig      `yaml:"oidc" toml:"oidc"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+	SPARQL    SPARQLConfig    `yaml:"sparql" toml:"sparql"`
+	Search    SearchConfig    `yaml:"search" toml:"search"`
+
+	// フラグの後ろに残った引数 (コマンドごとのサブコマンドなど)
+	Args []string `yaml:"-" toml:"-"`
+}
+
+type ServerConfig struct {
+	ListenAddr     string   `yaml:"listen_addr" toml:"listen_addr"`
+	AppBaseURL     string   `yaml:"app_base_url" toml:"app_base_url"`       // フロントエンドのURL (メール内リンクやOIDCのリダイレクト先)
+	PublicBaseURL  string   `yaml:"public_base_url" toml:"public_base_url"` // 外から見たこのAPIサーバーのURL (JSON-LD の @context など)。省略時は待ち受けアドレスから作る
+	CORSOrigins    []string `yaml:"cors_origins" toml:"cors_origins"`       // "*" なら全許可
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"` // X-Forwarded-For を信用するプロキシ
+
+	MetricsListenAddr string   `yaml:"metrics_listen_addr" toml:"metrics_listen_addr"` // /metrics を別のポートで出す (例: 127.0.0.1:9090)。空なら API と同じポートで出す
+	MetricsAllow      []string `yaml:"metrics_allow" toml:"metrics_allow"`             // API と同じポートで出すとき /metrics を見てよいIP・CIDR
+
+	StartupTimeout     Duration `yaml:"startup_timeout" toml:"startup_timeout"`           // 起動時に依存先の立ち上がりを待つ最大時間
+	ReadyTimeout       Duration `yaml:"ready_timeout" toml:"ready_timeout"`               // /readyz で1つの依存先を待つ時間
+	ShutdownTimeout    Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`         // SIGTERM 後、処理中のリクエストを待つ最大時間
+	ShutdownDrainDelay Duration `yaml:"shutdown_drain_delay" toml:"shutdown_drain_delay"` // SIGTERM 後、/readyz を 503 にしてから新規受付を止めるまでの時間
+}
+
+// Duration: 設定ファイルに "30s" や "2m" と書ける time.Duration
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("時間は 30s や 2m の形で書くのだ: %q", string(text))
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) Std() time.Duration { return time.Duration(d) }
+
+type PostgresConfig struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	DBName   string `yaml:"db_name" toml:"db_name"`
+}
+
+type FusekiConfig struct {
+	URL      string `yaml:"url" toml:"url"` // データセットのURL (例: http://localhost:3030/biodb)
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// QueryURL / UpdateURL: データセットの SPARQL エンドポイント
+func (f FusekiConfig) QueryURL() string  { return strings.TrimSuffix(f.URL, "/") + "/query" }
+func (f FusekiConfig) UpdateURL() string { return strings.TrimSuffix(f.URL, "/") + "/update" }
+
+// ServerURL: Fuseki 本体のURL (データセット名を除いたもの。起動待ちに使う)
+func (f FusekiConfig) ServerURL() string {
+	u := strings.TrimSuffix(f.URL, "/")
+	if i := strings.LastIndex(u, "/"); i > len("https://") {
+		return u[:i]
+	}
+	return u
+}
+
+type MeiliConfig struct {
+	URL string `yaml:"url" toml:"url"`
+	Key string `yaml:"key" toml:"key"`
+}
+
+type URIConfig struct {
+	Base       string `yaml:"base" toml:"base"`             // 例: http://my-db.org/
+	Occurrence string `yaml:"occurrence" toml:"occurrence"` // 省略時は <base>occ/
+	User       string `yaml:"user" toml:"user"`             // 省略時は <base>user/
+}
+
+// BaseURIs: リポジトリ・サービスに渡す形にする
+func (u URIConfig) BaseURIs() model.BaseURIs {
+	return model.BaseURIs{Base: u.Base, Occurrence: u.Occurrence, User: u.User}
+}
+
+type MailConfig struct {
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host"` // 空なら送信せずログに出すだけ
+	SMTPPort     string `yaml:"smtp_port" toml:"smtp_port"`
+	SMTPUser     string `yaml:"smtp_user" toml:"smtp_user"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password"`
+	From         string `yaml:"from" toml:"from"`
+	LogFile      string `yaml:"log_file" toml:"log_file"`
+}
+
+type RateLimitConfig struct {
+	Store string `yaml:"store" toml:"store"` // memory | postgres
+}
+
+type LogConfig struct {
+	Level              string   `yaml:"level" toml:"level"`                               // debug | info | warn | error
+	Format             string   `yaml:"format" toml:"format"`                             // json | text
+	SlowQueryThreshold Duration `yaml:"slow_query_threshold" toml:"slow_query_threshold"` // これより遅いSPARQLは warn で記録する
+}
+
+type TracingConfig struct {
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`         // OTLP/HTTP の送り先 (例: http://localhost:4318)。空ならトレースしない
+	ServiceName string  `yaml:"service_name" toml:"service_name"` // トレースに付くサービス名
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"` // 記録するリクエストの割合 (0〜1)
+}
+
+// SPARQLConfig: 公開 SPARQL エンドポイント (/api/sparql) の制限
+type SPARQLConfig struct {
+	Timeout          Duration `yaml:"timeout" toml:"timeout"`                       // 1回の問い合わせにかけられる最大時間
+	MaxResults       int      `yaml:"max_results" toml:"max_results"`               // LIMIT の上限 (無ければこの値で付ける)
+	MaxResponseBytes int      `yaml:"max_response_bytes" toml:"max_response_bytes"` // 返せる結果の大きさの上限
+}
+
+// SearchConfig: Fuseki → Meilisearch の同期 (search_outbox を処理するワーカー)
+type SearchConfig struct {
+	SyncInterval    Duration `yaml:"sync_interval" toml:"sync_interval"`         // 溜まっている操作を見に行く間隔
+	SyncMaxAttempts int      `yaml:"sync_max_attempts" toml:"sync_max_attempts"` // これだけ失敗したら failed にして諦める
+}
+
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig `yaml:"providers" toml:"providers"`
+}
+
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name" toml:"name"`
+	Issuer       string   `yaml:"issuer" toml:"issuer"`
+	ClientID     string   `yaml:"client_id" toml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url"` // 省略時は http://<listen>/api/auth/oidc/<name>/callback
+	Scopes       []string `yaml:"scopes" toml:"scopes"`
+}
+
+// Default: 手元の docker-compose でそのまま動く値 (パスワード類は入れない)
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddr:     ":8080",
+			AppBaseURL:     "http://localhost:3000",
+			CORSOrigins:    []string{"*"},
+			TrustedProxies: []string{"127.0.0.1", "::1"},
+			MetricsAllow:   []string{"127.0.0.1", "::1"},
+
+			StartupTimeout:     Duration(60 * time.Second),
+			ReadyTimeout:       Duration(2 * time.Second),
+			ShutdownTimeout:    Duration(30 * time.Second),
+			ShutdownDrainDelay: Duration(5 * time.Second),
+		},
+		Postgres: PostgresConfig{
+			Host:   "localhost",
+			Port:   "5432",
+			User:   "bio_user",
+			DBName: "bio_auth",
+		},
+		Fuseki: FusekiConfig{
+			URL:  "http://localhost:3030/biodb",
+			User: "admin",
+		},
+		Meili: MeiliConfig{
+			URL: "http://localhost:7700",
+		},
+		URIs: URIConfig{
+			Base: "http://my-db.org/",
+		},
+		Mail: MailConfig{
+			SMTPPort: "587",
+			From:     "noreply@my-db.org",
+		},
+		RateLimit: RateLimitConfig{
+			Store: "memory",
+		},
+		Log: LogConfig{
+			Level:              "info",
+			Format:             "json",
+			SlowQueryThreshold: Duration(500 * time.Millisecond),
+		},
+		Tracing: TracingConfig{
+			ServiceName: "bio-occurrence-api",
+			SampleRatio: 1,
+		},
+		SPARQL: SPARQLConfig{
+			Timeout:          Duration(10 * time.Second),
+			MaxResults:       1000,
+			MaxResponseBytes: 16 << 20,
+		},
+		Search: SearchConfig{
+			SyncInterval:    Duration(2 * time.Second),
+			SyncMaxAttempts: 10,
+		},
+	}
+}
+
+// setting: 環境変数・フラグで上書きできる1項目
+type setting struct {
+	flag  string
+	envs  []string // 先にあるものが優先
+	usage string
+	str   *string
+	list  *[]string // カンマ区切り
+	dur   *Duration
+	num   *float64
+	int   *int
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{flag: "listen", envs: []string{"LISTEN_ADDR"}, usage: "APIサーバーの待ち受けアドレス", str: &c.Server.ListenAddr},
+		{flag: "app-base-url", envs: []string{"APP_BASE_URL"}, usage: "フロントエンドのURL", str: &c.Server.AppBaseURL},
+		{flag: "public-base-url", envs: []string{"PUBLIC_BASE_URL"}, usage: "外から見たこのAPIサーバーのURL", str: &c.Server.PublicBaseURL},
+		{flag: "cors-origins", envs: []string{"CORS_ORIGINS"}, usage: "CORSで許可するオリジン (カンマ区切り、* で全許可)", list: &c.Server.CORSOrigins},
+		{flag: "trusted-proxies", envs: []string{"TRUSTED_PROXIES"}, usage: "信用するリバースプロキシ (カンマ区切り)", list: &c.Server.TrustedProxies},
+		{flag: "metrics-listen", envs: []string{"METRICS_LISTEN_ADDR"}, usage: "/metrics を出す別の待ち受けアドレス (空なら API と同じ)", str: &c.Server.MetricsListenAddr},
+		{flag: "metrics-allow", envs: []string{"METRICS_ALLOW"}, usage: "/metrics を見てよいIP・CIDR (カンマ区切り)", list: &c.Server.MetricsAllow},
+		{flag: "startup-timeout", envs: []string{"STARTUP_TIMEOUT"}, usage: "起動時に依存先を待つ最大時間 (例: 60s)", dur: &c.Server.StartupTimeout},
+		{flag: "ready-timeout", envs: []string{"READY_TIMEOUT"}, usage: "/readyz の依存先ごとのタイムアウト", dur: &c.Server.ReadyTimeout},
+		{flag: "shutdown-timeout", envs: []string{"SHUTDOWN_TIMEOUT"}, usage: "終了時に処理中のリクエストを待つ最大時間", dur: &c.Server.ShutdownTimeout},
+		{flag: "shutdown-drain-delay", envs: []string{"SHUTDOWN_DRAIN_DELAY"}, usage: "終了時に /readyz を落としてから受付を止めるまでの時間 (例: 5s)", dur: &c.Server.ShutdownDrainDelay},
+
+		{flag: "pg-host", envs: []string{"POSTGRES_HOST"}, usage: "Postgres のホスト", str: &c.Postgres.Host},
+		{flag: "pg-port", envs: []string{"POSTGRES_PORT"}, usage: "Postgres のポート", str: &c.Postgres.Port},
+		{flag: "pg-user", envs: []string{"POSTGRES_USER"}, usage: "Postgres のユーザー", str: &c.Postgres.User},
+		{flag: "pg-password", envs: []string{"POSTGRES_PASSWORD"}, usage: "Postgres のパスワード", str: &c.Postgres.Password},
+		{flag: "pg-db", envs: []string{"POSTGRES_DB"}, usage: "Postgres のデータベース名", str: &c.Postgres.DBName},
+
+		{flag: "fuseki-url", envs: []string{"FUSEKI_URL"}, usage: "Fuseki のデータセットURL", str: &c.Fuseki.URL},
+		{flag: "fuseki-user", envs: []string{"FUSEKI_USER"}, usage: "Fuseki のユーザー", str: &c.Fuseki.User},
+		{flag: "fuseki-password", envs: []string{"FUSEKI_PASSWORD"}, usage: "Fuseki のパスワード", str: &c.Fuseki.Password},
+
+		{flag: "meili-url", envs: []string{"MEILI_URL", "NEXT_PUBLIC_MEILI_URL"}, usage: "Meilisearch のURL", str: &c.Meili.URL},
+		{flag: "meili-key", envs: []string{"MEILI_MASTER_KEY", "NEXT_PUBLIC_MEILI_KEY"}, usage: "Meilisearch のAPIキー", str: &c.Meili.Key},
+
+		{flag: "base-uri", envs: []string{"BASE_URI"}, usage: "RDFリソースのベースURI", str: &c.URIs.Base},
+		{flag: "occurrence-base-uri", envs: []string{"OCCURRENCE_BASE_URI"}, usage: "記録URIの名前空間", str: &c.URIs.Occurrence},
+		{flag: "user-base-uri", envs: []string{"USER_BASE_URI"}, usage: "ユーザーURIの名前空間", str: &c.URIs.User},
+
+		{flag: "smtp-host", envs: []string{"SMTP_HOST"}, usage: "SMTPサーバー (空ならメールをログに出す)", str: &c.Mail.SMTPHost},
+		{flag: "smtp-port", envs: []string{"SMTP_PORT"}, usage: "SMTPポート", str: &c.Mail.SMTPPort},
+		{flag: "smtp-user", envs: []string{"SMTP_USER"}, usage: "SMTPユーザー", str: &c.Mail.SMTPUser},
+		{flag: "smtp-password", envs: []string{"SMTP_PASSWORD"}, usage: "SMTPパスワード", str: &c.Mail.SMTPPassword},
+		{flag: "mail-from", envs: []string{"SMTP_FROM"}, usage: "送信元アドレス", str: &c.Mail.From},
+		{flag: "mail-log-file", envs: []string{"MAIL_LOG_FILE"}, usage: "開発用メールログの出力先", str: &c.Mail.LogFile},
+
+		{flag: "rate-limit-store", envs: []string{"RATE_LIMIT_STORE"}, usage: "レート制限の保存先 (memory|postgres)", str: &c.RateLimit.Store},
+
+		{flag: "log-level", envs: []string{"LOG_LEVEL"}, usage: "ログレベル (debug|info|warn|error)", str: &c.Log.Level},
+		{flag: "log-format", envs: []string{"LOG_FORMAT"}, usage: "ログの形式 (json|text)", str: &c.Log.Format},
+		{flag: "slow-query-threshold", envs: []string{"SLOW_QUERY_THRESHOLD"}, usage: "遅いSPARQLとして記録するしきい値 (例: 500ms)", dur: &c.Log.SlowQueryThreshold},
+
+		{flag: "otlp-endpoint", envs: []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "TRACING_ENDPOINT"}, usage: "トレースの送り先 (OTLP/HTTP、空なら無効)", str: &c.Tracing.Endpoint},
+		{flag: "service-name", envs: []string{"OTEL_SERVICE_NAME"}, usage: "トレースに付けるサービス名", str: &c.Tracing.ServiceName},
+		{flag: "trace-sample-ratio", envs: []string{"TRACE_SAMPLE_RATIO"}, usage: "トレースを記録する割合 (0〜1)", num: &c.Tracing.SampleRatio},
+
+		{flag: "sparql-timeout", envs: []string{"SPARQL_TIMEOUT"}, usage: "公開SPARQLの1回あたりの最大時間 (例: 10s)", dur: &c.SPARQL.Timeout},
+		{flag: "sparql-max-results", envs: []string{"SPARQL_MAX_RESULTS"}, usage: "公開SPARQLの LIMIT の上限", int: &c.SPARQL.MaxResults},
+		{flag: "sparql-max-response-bytes", envs: []string{"SPARQL_MAX_RESPONSE_BYTES"}, usage: "公開SPARQLの結果の大きさの上限 (バイト)", int: &c.SPARQL.MaxResponseBytes},
+		{flag: "search-sync-interval", envs: []string{"SEARCH_SYNC_INTERVAL"}, usage: "検索インデックスの同期を見に行く間隔 (例: 2s)", dur: &c.Search.SyncInterval},
+		{flag: "search-sync-max-attempts", envs: []string{"SEARCH_SYNC_MAX_ATTEMPTS"}, usage: "検索インデックスの同期を諦めるまでの試行回数", int: &c.Search.SyncMaxAttempts},
+	}
+}
+
+// Load: 設定を読み込んで検証する
+// name はコマンド名 (フラグのヘルプ表示用)、required はそのコマンドで必要な接続先
+func Load(name string, args []string, required ...Section) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "設定ファイル (.yaml / .yml / .toml)")
+	flagValues := make(map[string]*string)
+	for _, s := range cfg.settings() {
+		flagValues[s.flag] = fs.String(s.flag, "", s.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	// 明示的に指定されたフラグだけで上書きする
+	var flagErr error
+	settings := cfg.settings()
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name {
+				if err := s.set(*flagValues[f.Name]); err != nil && flagErr == nil {
+					flagErr = fmt.Errorf("-%s: %w", f.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	cfg.fillDerived()
+	cfg.Args = fs.Args()
+
+	if err := cfg.Validate(required...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// MustLoad: os.Args から読み込み、失敗したらログを出して終了する (main から使う)
+// ログの出力 (slog) もここで設定する
+func MustLoad(required ...Section) *Config {
+	cfg, err := Load(filepath.Base(os.Args[0]), os.Args[1:], required...)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("❌ 致命的エラー: %v", err)
+	}
+	if err := logging.Setup(os.Stderr, cfg.Log.Level, cfg.Log.Format); err != nil {
+		log.Fatalf("❌ 致命的エラー: %v", err)
+	}
+	return cfg
+}
+
+// loadFile: 拡張子を見て YAML か TOML として読み込む (書かれていない項目はデフォルトのまま)
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("設定ファイルが読めないのだ: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalWithOptions(data, c, yaml.Strict())
+	case ".toml":
+		err = toml.NewDecoder(strings.NewReader(string(data))).DisallowUnknownFields().Decode(c)
+	default:
+		return fmt.Errorf("設定ファイルの形式が分からないのだ (.yaml / .yml / .toml のどれか): %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("設定ファイル %s の読み込みに失敗したのだ: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv: 環境変数で上書きする (空文字をセットした場合も「空にする」として扱う)
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	for _, s := range c.settings() {
+		for _, env := range s.envs {
+			if v, ok := lookup(env); ok {
+				if err := s.set(v); err != nil {
+					return fmt.Errorf("環境変数 %s: %w", env, err)
+				}
+				break
+			}
+		}
+	}
+	c.applyOIDCEnv(lookup)
+	return nil
+}
+
+// applyOIDCEnv: OIDC_PROVIDERS=orcid,mock のように並べたプロバイダーを読み込む
+// 各プロバイダーは OIDC_<NAME>_ISSUER / _CLIENT_ID / _CLIENT_SECRET / _REDIRECT_URL / _SCOPES で設定する
+// 設定ファイルに同じ名前のプロバイダーがあれば、環境変数で指定した項目だけ上書きする
+func (c *Config) applyOIDCEnv(lookup func(string) (string, bool)) {
+	names, ok := lookup("OIDC_PROVIDERS")
+	if !ok {
+		return
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		p := c.OIDC.provider(name)
+		if p == nil {
+			c.OIDC.Providers = append(c.OIDC.Providers, OIDCProviderConfig{Name: name})
+			p = &c.OIDC.Providers[len(c.OIDC.Providers)-1]
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		if v, ok := lookup(prefix + "ISSUER"); ok {
+			p.Issuer = v
+		}
+		if v, ok := lookup(prefix + "CLIENT_ID"); ok {
+			p.ClientID = v
+		}
+		if v, ok := lookup(prefix + "CLIENT_SECRET"); ok {
+			p.ClientSecret = v
+		}
+		if v, ok := lookup(prefix + "REDIRECT_URL"); ok {
+			p.RedirectURL = v
+		}
+		if v, ok := lookup(prefix + "SCOPES"); ok {
+			p.Scopes = strings.Fields(v)
+		}
+	}
+}
+
+func (o *OIDCConfig) provider(name string) *OIDCProviderConfig {
+	for i := range o.Providers {
+		if o.Providers[i].Name == name {
+			return &o.Providers[i]
+		}
+	}
+	return nil
+}
+
+// fillDerived: 他の項目から決まるデフォルト値を埋める
+func (c *Config) fillDerived() {
+	if c.URIs.Occurrence == "" {
+		c.URIs.Occurrence = c.URIs.Base + "occ/"
+	}
+	if c.URIs.User == "" {
+		c.URIs.User = c.URIs.Base + "user/"
+	}
+	if c.Server.PublicBaseURL == "" {
+		c.Server.PublicBaseURL = c.Server.LocalURL()
+	}
+
+	for i := range c.OIDC.Providers {
+		p := &c.OIDC.Providers[i]
+		if p.RedirectURL == "" {
+			p.RedirectURL = c.Server.LocalURL() + "/api/auth/oidc/" + p.Name + "/callback"
+		}
+	}
+}
+
+// LocalURL: 待ち受けアドレスから手元でアクセスするときのURLを作る (":8080" → http://localhost:8080)
+func (s ServerConfig) LocalURL() string {
+	addr := s.ListenAddr
+	if strings.HasPrefix(addr, ":") || strings.HasPrefix(addr, "0.0.0.0:") {
+		addr = "localhost:" + addr[strings.LastIndex(addr, ":")+1:]
+	}
+	return "http://" + addr
+}
+
+func (s setting) set(v string) error {
+	switch {
+	case s.str != nil:
+		*s.str = strings.TrimSpace(v)
+	case s.list != nil:
+		*s.list = splitList(v)
+	case s.dur != nil:
+		return s.dur.UnmarshalText([]byte(strings.TrimSpace(v)))
+	case s.num != nil:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return fmt.Errorf("数値じゃないのだ: %q", v)
+		}
+		*s.num = n
+	case s.int != nil:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("整数じゃないのだ: %q", v)
+		}
+		*s.int = n
+	}
+	return nil
+}
+
+// splitList: "a, b,,c" → [a b c]
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/saku-730/bio-occurrence/backend/internal/logging"
+)
+
+// Section: コマンドごとに必須になる接続先
+type Section string
+
+const (
+	SectionPostgres Section = "postgres"
+	SectionFuseki   Section = "fuseki"
+	SectionMeili    Section = "meili"
+)
+
+// Validate: 値の形をチェックし、required の接続先は必須項目が揃っているかも見る
+// まずい項目はまとめて返す (1個直すたびに起動し直さなくていいように)
+func (c *Config) Validate(required ...Section) error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// --- server ---
+	if _, port, err := net.SplitHostPort(c.Server.ListenAddr); err != nil {
+		add("server.listen_addr が不正なのだ (例: :8080): %q", c.Server.ListenAddr)
+	} else if !validPort(port) {
+		add("server.listen_addr のポートが不正なのだ: %q", c.Server.ListenAddr)
+	}
+	if err := checkHTTPURL(c.Server.AppBaseURL); err != nil {
+		add("server.app_base_url: %v", err)
+	}
+	if err := checkHTTPURL(c.Server.PublicBaseURL); err != nil {
+		add("server.public_base_url: %v", err)
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		add("server.cors_origins が空なのだ (全許可なら \"*\")")
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		if err := checkHTTPURL(origin); err != nil {
+			add("server.cors_origins: %v", err)
+		}
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if !validIPOrCIDR(proxy) {
+			add("server.trusted_proxies: IPかCIDRで書くのだ: %q", proxy)
+		}
+	}
+	if c.Server.MetricsListenAddr != "" {
+		if _, port, err := net.SplitHostPort(c.Server.MetricsListenAddr); err != nil || !validPort(port) {
+			add("server.metrics_listen_addr が不正なのだ (例: 127.0.0.1:9090): %q", c.Server.MetricsListenAddr)
+		} else if c.Server.MetricsListenAddr == c.Server.ListenAddr {
+			add("server.metrics_listen_addr は listen_addr と別にするのだ (同じでいいなら空にする): %q", c.Server.MetricsListenAddr)
+		}
+	}
+	for _, allow := range c.Server.MetricsAllow {
+		if !validIPOrCIDR(allow) {
+			add("server.metrics_allow: IPかCIDRで書くのだ: %q", allow)
+		}
+	}
+
+	if c.Server.StartupTimeout <= 0 || c.Server.ReadyTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		add("server.startup_timeout / ready_timeout / shutdown_timeout は0より大きくするのだ")
+	}
+	if c.Server.ShutdownDrainDelay < 0 {
+		add("server.shutdown_drain_delay は0以上にするのだ")
+	}
+
+	// --- 接続先 ---
+	if c.Postgres.Port != "" && !validPort(c.Postgres.Port) {
+		add("postgres.port が不正なのだ: %q", c.Postgres.Port)
+	}
+	if err := checkHTTPURL(c.Fuseki.URL); err != nil {
+		add("fuseki.url: %v", err)
+	}
+	if err := checkHTTPURL(c.Meili.URL); err != nil {
+		add("meili.url: %v", err)
+	}
+
+	for _, s := range required {
+		switch s {
+		case SectionPostgres:
+			requireSet(&errs, "postgres.host (POSTGRES_HOST)", c.Postgres.Host)
+			requireSet(&errs, "postgres.user (POSTGRES_USER)", c.Postgres.User)
+			requireSet(&errs, "postgres.password (POSTGRES_PASSWORD)", c.Postgres.Password)
+			requireSet(&errs, "postgres.db_name (POSTGRES_DB)", c.Postgres.DBName)
+		case SectionFuseki:
+			requireSet(&errs, "fuseki.user (FUSEKI_USER)", c.Fuseki.User)
+			requireSet(&errs, "fuseki.password (FUSEKI_PASSWORD)", c.Fuseki.Password)
+		case SectionMeili:
+			requireSet(&errs, "meili.key (MEILI_MASTER_KEY)", c.Meili.Key)
+		}
+	}
+
+	// --- URI ---
+	if err := checkNamespace(c.URIs.Base); err != nil {
+		add("uris.base: %v", err)
+	}
+	if err := checkNamespace(c.URIs.Occurrence); err != nil {
+		add("uris.occurrence: %v", err)
+	}
+	if err := checkNamespace(c.URIs.User); err != nil {
+		add("uris.user: %v", err)
+	}
+
+	// --- その他 ---
+	if c.Mail.SMTPHost != "" && !validPort(c.Mail.SMTPPort) {
+		add("mail.smtp_port が不正なのだ: %q", c.Mail.SMTPPort)
+	}
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "postgres" {
+		add("rate_limit.store は memory か postgres なのだ: %q", c.RateLimit.Store)
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		add("log.level: %v", err)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		add("log.format は json か text なのだ: %q", c.Log.Format)
+	}
+	if c.Log.SlowQueryThreshold < 0 {
+		add("log.slow_query_threshold は0以上にするのだ")
+	}
+
+	if c.Tracing.Endpoint != "" {
+		if err := checkHTTPURL(c.Tracing.Endpoint); err != nil {
+			add("tracing.endpoint: %v", err)
+		}
+		requireSet(&errs, "tracing.service_name (OTEL_SERVICE_NAME)", c.Tracing.ServiceName)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio は0〜1の範囲にするのだ: %v", c.Tracing.SampleRatio)
+	}
+
+	if c.SPARQL.Timeout <= 0 {
+		add("sparql.timeout は0より大きくするのだ")
+	}
+	if c.SPARQL.MaxResults <= 0 || c.SPARQL.MaxResponseBytes <= 0 {
+		add("sparql.max_results / max_response_bytes は0より大きくするのだ")
+	}
+	if c.Search.SyncInterval <= 0 || c.Search.SyncMaxAttempts <= 0 {
+		add("search.sync_interval / sync_max_attempts は0より大きくするのだ")
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range c.OIDC.Providers {
+		if p.Name == "" {
+			add("oidc.providers: name が空のプロバイダーがあるのだ")
+			continue
+		}
+		if seen[p.Name] {
+			add("oidc.providers: %q が2回出てくるのだ", p.Name)
+		}
+		seen[p.Name] = true
+		if err := checkHTTPURL(p.Issuer); err != nil {
+			add("oidc.providers[%s].issuer: %v", p.Name, err)
+		}
+		requireSet(&errs, "oidc.providers["+p.Name+"].client_id", p.ClientID)
+		if err := checkHTTPURL(p.RedirectURL); err != nil {
+			add("oidc.providers[%s].redirect_url: %v", p.Name, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("設定が正しくないのだ:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func requireSet(errs *[]error, name, value string) {
+	if value == "" {
+		*errs = append(*errs, fmt.Errorf("%s が設定されていないのだ", name))
+	}
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+// validIPOrCIDR: 127.0.0.1 や 10.0.0.0/8 の形か
+func validIPOrCIDR(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(s)
+	return err == nil
+}
+
+// checkHTTPURL: http(s)://host... の形か
+func checkHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("http(s) のURLじゃないのだ: %q", raw)
+	}
+	return nil
+}
+
+// checkNamespace: URIの名前空間は後ろにIDをくっつけるので / か # で終わっていないといけない
+func checkNamespace(raw string) error {
+	if err := checkHTTPURL(raw); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(raw, "/") && !strings.HasSuffix(raw, "#") {
+		return fmt.Errorf("/ か # で終わる必要があるのだ: %q", raw)
+	}
+	if strings.ContainsAny(raw, " <>\"{}|\\^`") {
+		return fmt.Errorf("URIに使えない文字が入っているのだ: %q", raw)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package export
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// 分類群 × 形質の行列を、系統解析のソフトが読める形で書き出す
+// NEXUS は Mesquite / PAUP* など、TNT は TNT の xread 形式
+
+// 状態の記号 (TNT が既定で読める 0-9 A-V の32個)。これより状態の多い形質は NEXUS・TNT には書けない
+const stateSymbols = "0123456789ABCDEFGHIJKLMNOPQRSTUV"
+
+// MatrixContentType: 形式ごとの Content-Type と拡張子
+func MatrixContentType(format string) (contentType, ext string) {
+	switch format {
+	case model.MatrixFormatNEXUS:
+		return "text/plain; charset=utf-8", ".nex"
+	case model.MatrixFormatTNT:
+		return "text/plain; charset=utf-8", ".tnt"
+	default:
+		return "text/csv; charset=utf-8", ".csv"
+	}
+}
+
+// WriteMatrix: format (空なら CSV) で書き出す
+func WriteMatrix(w io.Writer, m *model.TraitMatrix, format string) error {
+	switch format {
+	case model.MatrixFormatNEXUS:
+		return WriteNEXUS(w, m)
+	case model.MatrixFormatTNT:
+		return WriteTNT(w, m)
+	default:
+		return WriteMatrixCSV(w, m)
+	}
+}
+
+// WriteMatrixCSV: 1行1分類群、列は述語のID。セルは値のID (多型は | でつなぐ、不明は空)
+func WriteMatrixCSV(w io.Writer, m *model.TraitMatrix) error {
+	cw := csv.NewWriter(w)
+	header := []string{"taxon_id", "taxon_label"}
+	for _, c := range m.Characters {
+		header = append(header, c.ID)
+	}
+	cw.Write(header)
+
+	for i, t := range m.Taxa {
+		row := []string{t.ID, t.Label}
+		for j, c := range m.Characters {
+			values := make([]string, 0, len(m.Cells[i][j]))
+			for _, s := range m.Cells[i][j] {
+				values = append(values, c.States[s].ID)
+			}
+			row = append(row, strings.Join(values, "|"))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteNEXUS: TAXA ブロックと CHARACTERS ブロック (DATATYPE=STANDARD)
+// 形質と状態の名前は ID にして、ラベルはコメント [...] に入れておく
+func WriteNEXUS(w io.Writer, m *model.TraitMatrix) error {
+	chars, skipped := encodableCharacters(m)
+	names := uniqueNames(m.Taxa, func(s string) string { return s })
+
+	b := &strings.Builder{}
+	b.WriteString("#NEXUS\n")
+	fmt.Fprintf(b, "[%s]\n\n", nexusComment(matrixComment(m, skipped)))
+
+	b.WriteString("BEGIN TAXA;\n")
+	fmt.Fprintf(b, "\tDIMENSIONS NTAX=%d;\n", len(m.Taxa))
+	b.WriteString("\tTAXLABELS\n")
+	for i, t := range m.Taxa {
+		fmt.Fprintf(b, "\t\t%s [%s]\n", nexusQuote(names[i]), nexusComment(t.ID))
+	}
+	b.WriteString("\t;\nEND;\n\n")
+
+	b.WriteString("BEGIN CHARACTERS;\n")
+	fmt.Fprintf(b, "\tDIMENSIONS NCHAR=%d;\n", len(chars))
+	symbols := stateSymbols[:maxStates(m, chars)]
+	fmt.Fprintf(b, "\tFORMAT DATATYPE=STANDARD MISSING=? GAP=- SYMBOLS=\"%s\";\n", strings.Join(strings.Split(symbols, ""), " "))
+	b.WriteString("\tCHARSTATELABELS\n")
+	for n, j := range chars {
+		c := m.Characters[j]
+		states := make([]string, len(c.States))
+		labels := make([]string, len(c.States))
+		for k, st := range c.States {
+			states[k] = nexusQuote(st.ID)
+			labels[k] = st.Label
+		}
+		sep := ","
+		if n == len(chars)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(b, "\t\t%d %s / %s [%s: %s]%s\n", n+1, nexusQuote(c.ID), strings.Join(states, " "),
+			nexusComment(c.Label), nexusComment(strings.Join(labels, ", ")), sep)
+	}
+	b.WriteString("\t;\n")
+
+	b.WriteString("\tMATRIX\n")
+	for i := range m.Taxa {
+		fmt.Fprintf(b, "\t\t%s\t%s\n", nexusQuote(names[i]), matrixRow(m, i, chars, "{", "}"))
+	}
+	b.WriteString("\t;\nEND;\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteTNT: xread で行列、cnames で形質と状態の名前を書く
+// TNT の名前には空白や記号が使えないので _ に置き換える
+func WriteTNT(w io.Writer, m *model.TraitMatrix) error {
+	chars, skipped := encodableCharacters(m)
+	names := uniqueNames(m.Taxa, tntName)
+
+	b := &strings.Builder{}
+	b.WriteString("xread\n")
+	fmt.Fprintf(b, "'%s'\n", strings.ReplaceAll(matrixComment(m, skipped), "'", ""))
+	fmt.Fprintf(b, "%d %d\n", len(chars), len(m.Taxa))
+	for i := range m.Taxa {
+		fmt.Fprintf(b, "%s %s\n", names[i], matrixRow(m, i, chars, "[", "]"))
+	}
+	b.WriteString(";\n\n")
+
+	b.WriteString("cnames\n")
+	for n, j := range chars {
+		c := m.Characters[j]
+		states := make([]string, len(c.States))
+		for k, st := range c.States {
+			states[k] = tntName(st.ID)
+		}
+		fmt.Fprintf(b, "{%d %s %s;\n", n, tntName(c.ID), strings.Join(states, " "))
+	}
+	b.WriteString(";\n\nproc/;\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// encodableCharacters: 記号が足りる形質の添字と、足りずに外した形質の ID
+func encodableCharacters(m *model.TraitMatrix) ([]int, []string) {
+	var chars []int
+	var skipped []string
+	for j, c := range m.Characters {
+		if len(c.States) > len(stateSymbols) {
+			skipped = append(skipped, c.ID)
+			continue
+		}
+		chars = append(chars, j)
+	}
+	return chars, skipped
+}
+
+// maxStates: 使う記号の数 (少なくとも 0 と 1 は宣言しておく)
+func maxStates(m *model.TraitMatrix, chars []int) int {
+	n := 2
+	for _, j := range chars {
+		n = max(n, len(m.Characters[j].States))
+	}
+	return n
+}
+
+// matrixRow: 1分類群分の行。多型は open/close で囲む ({01} や [01])
+func matrixRow(m *model.TraitMatrix, i int, chars []int, open, close string) string {
+	var b strings.Builder
+	for _, j := range chars {
+		cell := m.Cells[i][j]
+		switch len(cell) {
+		case 0:
+			b.WriteByte('?')
+		case 1:
+			b.WriteByte(stateSymbols[cell[0]])
+		default:
+			b.WriteString(open)
+			for _, s := range cell {
+				b.WriteByte(stateSymbols[s])
+			}
+			b.WriteString(close)
+		}
+	}
+	return b.String()
+}
+
+// matrixComment: ファイルの先頭に残す説明
+func matrixComment(m *model.TraitMatrix, skipped []string) string {
+	parts := []string{"Taxon x trait matrix from bio-occurrence (characters: predicates, states: values)"}
+	if m.Rank != "" {
+		parts = append(parts, "taxa rolled up to "+m.Rank)
+	}
+	if len(m.Unplaced) > 0 {
+		parts = append(parts, fmt.Sprintf("%d taxa without a %s ancestor were left out: %s", len(m.Unplaced), m.Rank, strings.Join(m.Unplaced, " ")))
+	}
+	if len(skipped) > 0 {
+		parts = append(parts, fmt.Sprintf("characters with more than %d states were left out: %s", len(stateSymbols), strings.Join(skipped, " ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// uniqueNames: 分類群の名前 (ラベルが無ければ ID)。同じ名前が出たら ID を付けて区別する
+func uniqueNames(taxa []model.MatrixTaxon, clean func(string) string) []string {
+	names := make([]string, len(taxa))
+	seen := make(map[string]bool)
+	for i, t := range taxa {
+		name := t.Label
+		if name == "" {
+			name = t.ID
+		}
+		name = clean(name)
+		if seen[name] {
+			name = clean(name + " " + t.ID)
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+func nexusQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// nexusComment: コメントの中に [ ] があると閉じてしまうので ( ) にする
+func nexusComment(s string) string {
+	return strings.NewReplacer("[", "(", "]", ")").Replace(s)
+}
+
+var reTNTUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.\-]+`)
+
+func tntName(s string) string {
+	return reTNTUnsafe.ReplaceAllString(s, "_")
+}
@@ -0,0 +1,191 @@
+package export
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 記録のある分類群の系統樹を書き出す (枝の長さは無い)
+// 記録の数は、Newick では NHX のコメント、PhyloXML では property に入れる
+
+// TreeContentType: 形式ごとの Content-Type と拡張子
+func TreeContentType(format string) (contentType, ext string) {
+	if format == model.TreeFormatPhyloXML {
+		return "application/xml; charset=utf-8", ".xml"
+	}
+	return "text/plain; charset=utf-8", ".nwk"
+}
+
+// WriteTree: format (空なら Newick) で書き出す
+func WriteTree(w io.Writer, t *model.TaxonTree, format string) error {
+	if format == model.TreeFormatPhyloXML {
+		return WritePhyloXML(w, t)
+	}
+	return WriteNewick(w, t)
+}
+
+// WriteNewick: 1行の Newick。各節に [&&NHX:occurrences=子孫も含めた数:direct=その分類群の数:T=NCBI の taxid] を付ける
+func WriteNewick(w io.Writer, t *model.TaxonTree) error {
+	var b strings.Builder
+	if t.Root != nil {
+		writeNewickNode(&b, t.Root)
+	}
+	b.WriteString(";\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeNewickNode(b *strings.Builder, n *model.TaxonTreeNode) {
+	if len(n.Children) > 0 {
+		b.WriteByte('(')
+		for i, c := range n.Children {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeNewickNode(b, c)
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(newickLabel(n))
+	fmt.Fprintf(b, "[&&NHX:occurrences=%d:direct=%d", n.Total, n.Direct)
+	if taxid := ncbiTaxID(n.ID); taxid != "" {
+		b.WriteString(":T=" + taxid)
+	}
+	b.WriteByte(']')
+}
+
+// newickLabel: 名前 (無ければ ID)。空白や記号があれば ' で囲む
+func newickLabel(n *model.TaxonTreeNode) string {
+	label := n.Label
+	if label == "" {
+		label = n.ID
+	}
+	if label == "" {
+		return ""
+	}
+	if strings.ContainsAny(label, " \t()[]':;,") {
+		return "'" + strings.ReplaceAll(label, "'", "''") + "'"
+	}
+	return label
+}
+
+// ncbiTaxID: "ncbi:9606" → "9606" (NCBITaxon 以外は空)
+func ncbiTaxID(id string) string {
+	if num, ok := strings.CutPrefix(id, "ncbi:"); ok {
+		if _, err := strconv.Atoi(num); err == nil {
+			return num
+		}
+	}
+	return ""
+}
+
+// PhyloXML 1.20 の要素 (使うものだけ)
+type phyloXML struct {
+	XMLName        xml.Name       `xml:"phyloxml"`
+	Xmlns          string         `xml:"xmlns,attr"`
+	XmlnsXSI       string         `xml:"xmlns:xsi,attr"`
+	SchemaLocation string         `xml:"xsi:schemaLocation,attr"`
+	Phylogeny      phyloPhylogeny `xml:"phylogeny"`
+}
+
+type phyloPhylogeny struct {
+	Rooted      bool        `xml:"rooted,attr"`
+	Name        string      `xml:"name"`
+	Description string      `xml:"description,omitempty"`
+	Clade       *phyloClade `xml:"clade,omitempty"`
+}
+
+type phyloClade struct {
+	Name       string          `xml:"name,omitempty"`
+	Taxonomy   *phyloTaxonomy  `xml:"taxonomy,omitempty"`
+	Properties []phyloProperty `xml:"property"`
+	Clades     []*phyloClade   `xml:"clade"`
+}
+
+type phyloTaxonomy struct {
+	ID             *phyloID `xml:"id,omitempty"`
+	ScientificName string   `xml:"scientific_name,omitempty"`
+	Rank           string   `xml:"rank,omitempty"`
+}
+
+type phyloID struct {
+	Provider string `xml:"provider,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type phyloProperty struct {
+	Ref       string `xml:"ref,attr"`
+	Datatype  string `xml:"datatype,attr"`
+	AppliesTo string `xml:"applies_to,attr"`
+	Value     string `xml:",chardata"`
+}
+
+// PhyloXML の rank に書ける値 (ncbitaxon の clade などは書けないので省く)
+var phyloRanks = map[string]bool{
+	"domain": true, "superkingdom": true, "kingdom": true, "subkingdom": true,
+	"superphylum": true, "phylum": true, "subphylum": true,
+	"superclass": true, "class": true, "subclass": true, "infraclass": true,
+	"cohort": true, "subcohort": true,
+	"superorder": true, "order": true, "suborder": true,
+	"superfamily": true, "family": true, "subfamily": true,
+	"tribe": true, "subtribe": true,
+	"genus": true, "subgenus": true, "section": true, "subsection": true,
+	"species": true, "subspecies": true, "varietas": true, "strain": true,
+}
+
+// WritePhyloXML: 1つの phylogeny に木を入れる
+func WritePhyloXML(w io.Writer, t *model.TaxonTree) error {
+	doc := phyloXML{
+		Xmlns:          "http://www.phyloxml.org",
+		XmlnsXSI:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://www.phyloxml.org http://www.phyloxml.org/1.20/phyloxml.xsd",
+		Phylogeny: phyloPhylogeny{
+			Rooted: true,
+			Name:   "Taxa observed in bio-occurrence",
+		},
+	}
+	if len(t.Unplaced) > 0 {
+		doc.Phylogeny.Description = fmt.Sprintf("%d taxa not found in NCBITaxon were left out: %s", len(t.Unplaced), strings.Join(t.Unplaced, " "))
+	}
+	if t.Root != nil {
+		doc.Phylogeny.Clade = phyloCladeOf(t.Root)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func phyloCladeOf(n *model.TaxonTreeNode) *phyloClade {
+	c := &phyloClade{
+		Name: n.Label,
+		Properties: []phyloProperty{
+			{Ref: "bio:occurrences", Datatype: "xsd:integer", AppliesTo: "clade", Value: strconv.Itoa(n.Total)},
+			{Ref: "bio:direct_occurrences", Datatype: "xsd:integer", AppliesTo: "node", Value: strconv.Itoa(n.Direct)},
+		},
+	}
+	if n.ID != "" {
+		c.Taxonomy = &phyloTaxonomy{ScientificName: n.Label}
+		if taxid := ncbiTaxID(n.ID); taxid != "" {
+			c.Taxonomy.ID = &phyloID{Provider: "ncbi", Value: taxid}
+		}
+		if phyloRanks[n.Rank] {
+			c.Taxonomy.Rank = n.Rank
+		}
+	}
+	for _, child := range n.Children {
+		c.Clades = append(c.Clades, phyloCladeOf(child))
+	}
+	return c
+}
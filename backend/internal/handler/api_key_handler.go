@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type APIKeyHandler struct {
+	svc service.APIKeyService
+}
+
+func NewAPIKeyHandler(svc service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{svc: svc}
+}
+
+// POST /api/api-keys
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req model.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("userID")
+	key, rawKey, err := h.svc.Create(c.Request.Context(), userID, req, requestMeta(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 生のキーはこのレスポンスでしか返さない
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "APIキーを発行したのだ。この値は二度と表示されないので保存しておくのだ",
+		"key":     rawKey,
+		"api_key": key,
+	})
+}
+
+// GET /api/api-keys
+func (h *APIKeyHandler) List(c *gin.Context) {
+	list, err := h.svc.List(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// DELETE /api/api-keys/:id
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id が不正なのだ"})
+		return
+	}
+
+	// 他人のキーも「見つからない」として返す (存在するかどうかを教えない)
+	err = h.svc.Revoke(c.Request.Context(), c.GetString("userID"), id.String(), requestMeta(c))
+	if errors.Is(err, service.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "APIキーが見つからないのだ"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "APIキーを無効化したのだ"})
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AuditHandler struct {
+	svc service.AuditService
+}
+
+func NewAuditHandler(svc service.AuditService) *AuditHandler {
+	return &AuditHandler{svc: svc}
+}
+
+// GET /api/admin/audit?actor_id=&action=&target_uri=&from=&to=&limit=&offset=&format=csv
+func (h *AuditHandler) Query(c *gin.Context) {
+	var filter model.AuditFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// actor_id は UUID なので、そのまま DB に投げて 500 にならないよう先に弾く
+	if filter.ActorID != "" {
+		id, err := uuid.Parse(filter.ActorID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "actor_id が不正なのだ (ユーザーIDを指定する)"})
+			return
+		}
+		filter.ActorID = id.String()
+	}
+	export := c.Query("format") == "csv"
+
+	page, err := h.svc.Query(c.Request.Context(), c.GetString("userID"), requestMeta(c), filter, export)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !export {
+		c.JSON(http.StatusOK, page)
+		return
+	}
+
+	// CSV エクスポート
+	filename := "audit_" + time.Now().Format("20060102_150405") + ".csv"
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("X-Total-Count", strconv.Itoa(page.Total))
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "occurred_at", "actor_id", "action", "target_uri", "before", "after", "ip", "request_id"})
+	for _, e := range page.Entries {
+		w.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.OccurredAt.Format(time.RFC3339),
+			e.ActorID,
+			e.Action,
+			e.TargetURI,
+			summaryJSON(e.Before),
+			summaryJSON(e.After),
+			e.IP,
+			e.RequestID,
+		})
+	}
+	w.Flush()
+}
+
+func summaryJSON(summary map[string]interface{}) string {
+	if summary == nil {
+		return ""
+	}
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
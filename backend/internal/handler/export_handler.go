@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/export"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"github.com/saku-730/bio-occurrence/backend/internal/sparql"
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExportHandler struct {
+	svc service.ExportService
+}
+
+func NewExportHandler(svc service.ExportService) *ExportHandler {
+	return &ExportHandler{svc: svc}
+}
+
+// GET /api/export/matrix?format=csv|nexus|tnt&rank=family&taxon=ncbi:9604&predicate=RO:0000053
+// ログインしていれば自分の非公開の記録も行列に入る
+func (h *ExportHandler) Matrix(c *gin.Context) {
+	var filter model.TraitMatrixFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := h.svc.TraitMatrix(c.Request.Context(), filter, c.GetString("userID"))
+	if errors.Is(err, service.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "taxon not found"})
+		return
+	}
+	if errors.Is(err, sparql.ErrInvalidTerm) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 書き出しに失敗したときにエラーを JSON で返せるように、いったんメモリに書く
+	var buf bytes.Buffer
+	if err := export.WriteMatrix(&buf, m, filter.Format); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	contentType, ext := export.MatrixContentType(filter.Format)
+	filename := "trait_matrix_" + time.Now().Format("20060102_150405") + ext
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// GET /api/export/tree?format=newick|phyloxml&taxon=ncbi:9604&owner=ユーザーID
+// 記録のある分類群を ncbitaxon でつないだ系統樹 (記録の数を節に付ける)
+func (h *ExportHandler) Tree(c *gin.Context) {
+	var filter model.TaxonTreeFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tree, err := h.svc.TaxonTree(c.Request.Context(), filter, c.GetString("userID"))
+	if errors.Is(err, service.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "taxon not found"})
+		return
+	}
+	if errors.Is(err, sparql.ErrInvalidTerm) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := export.WriteTree(&buf, tree, filter.Format); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	contentType, ext := export.TreeContentType(filter.Format)
+	filename := "taxon_tree_" + time.Now().Format("20060102_150405") + ext
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
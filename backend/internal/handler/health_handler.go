@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/saku-730/bio-occurrence/backend/internal/infrastructure"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	checks   []infrastructure.DependencyCheck
+	timeout  time.Duration // 依存先1つあたりの待ち時間
+	draining atomic.Bool   // 終了処理中なら readyz を落として、ロードバランサーに外してもらう
+}
+
+func NewHealthHandler(checks []infrastructure.DependencyCheck, timeout time.Duration) *HealthHandler {
+	return &HealthHandler{checks: checks, timeout: timeout}
+}
+
+// StartDraining: SIGTERM を受けたら呼ぶ。以後 /readyz は 503 を返す
+func (h *HealthHandler) StartDraining() {
+	h.draining.Store(true)
+}
+
+type dependencyStatus struct {
+	Status    string `json:"status"` // "ok" | "error"
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// GET /healthz
+// プロセスが生きていれば常に200 (依存先は見ない。見ると依存先が落ちたときに再起動ループになる)
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// GET /readyz
+// Fuseki・Postgres・Meilisearch を並列に確認し、全部OKなら200、1つでもダメなら503
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	results := make(map[string]dependencyStatus, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, dep := range h.checks {
+		wg.Add(1)
+		go func(dep infrastructure.DependencyCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := dep.Check(ctx)
+			st := dependencyStatus{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				st.Status = "error"
+				st.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[dep.Name] = st
+			mu.Unlock()
+		}(dep)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, st := range results {
+		if st.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+			break
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "dependencies": results})
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"github.com/saku-730/bio-occurrence/backend/internal/sparql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LinkedDataHandler struct {
+	svc        service.LinkedDataService
+	appBaseURL string // HTML を求められたときに飛ばすフロントエンドのURL
+}
+
+func NewLinkedDataHandler(svc service.LinkedDataService, appBaseURL string) *LinkedDataHandler {
+	return &LinkedDataHandler{svc: svc, appBaseURL: appBaseURL}
+}
+
+// GET /occ/:id
+// Linked Data の慣習どおり、記録URI そのものは 303 で文書 (<id>.ttl など) に飛ばし、
+// 文書URL のほうで Accept に関係なく拡張子の形式で返す
+func (h *LinkedDataHandler) Resolve(c *gin.Context) {
+	id, ext, hasExt := strings.Cut(c.Param("id"), ".")
+
+	var format service.LinkedDataFormat
+	if hasExt {
+		f, ok := service.LinkedDataFormatByExt(ext)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		format = f
+	} else {
+		f, ok := service.NegotiateLinkedData(c.GetHeader("Accept"))
+		if !ok {
+			c.JSON(http.StatusNotAcceptable, gin.H{"error": service.ErrNotAcceptable.Error()})
+			return
+		}
+		format = f
+	}
+
+	userID := c.GetString("userID")
+
+	// 画面はフロントエンドにあるので、存在確認だけして飛ばす
+	if format.Ext == "html" {
+		if err := h.svc.CheckVisible(c.Request.Context(), userID, id); err != nil {
+			h.respondError(c, err)
+			return
+		}
+		q := url.Values{}
+		q.Set("id", id)
+		c.Header("Vary", "Accept")
+		c.Redirect(http.StatusSeeOther, h.appBaseURL+"/occurrences/detail?"+q.Encode())
+		return
+	}
+
+	if !hasExt {
+		if err := h.svc.CheckVisible(c.Request.Context(), userID, id); err != nil {
+			h.respondError(c, err)
+			return
+		}
+		// 相対URLなので /occ/<id> からは /occ/<id>.ttl に解決される
+		c.Header("Vary", "Accept")
+		c.Redirect(http.StatusSeeOther, url.PathEscape(id)+"."+format.Ext)
+		return
+	}
+
+	result, err := h.svc.Describe(c.Request.Context(), userID, id, format)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Header("Link", `<`+url.PathEscape(id)+`>; rel="describes"`)
+	c.Data(http.StatusOK, result.ContentType, result.Body)
+}
+
+func (h *LinkedDataHandler) respondError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrNotFound) || errors.Is(err, sparql.ErrInvalidTerm) {
+		// URIにできないIDはそもそも存在しない
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -1,21 +1,26 @@
 package handler
 
 import (
+	"github.com/saku-730/bio-occurrence/backend/internal/jsonld"
 	"github.com/saku-730/bio-occurrence/backend/internal/model"
 	"github.com/saku-730/bio-occurrence/backend/internal/service"
-	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"github.com/saku-730/bio-occurrence/backend/internal/sparql"
+	"encoding/json"
+	"errors"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 type OccurrenceHandler struct {
-	svc service.OccurrenceService
+	svc        service.OccurrenceService
+	uris       model.BaseURIs // JSON-LD でユーザーの URI を出すのに使う
+	contextURL string         // JSON-LD の @context (絶対URL)
 }
 
-func NewOccurrenceHandler(svc service.OccurrenceService) *OccurrenceHandler {
-	return &OccurrenceHandler{svc: svc}
+func NewOccurrenceHandler(svc service.OccurrenceService, uris model.BaseURIs, publicBaseURL string) *OccurrenceHandler {
+	return &OccurrenceHandler{svc: svc, uris: uris, contextURL: jsonld.ContextURL(publicBaseURL)}
 }
 
 // POST /api/occurrences
@@ -32,7 +37,15 @@ func (h *OccurrenceHandler) Create(c *gin.Context) {
 		return
 	}
 
-	id, err := h.svc.Register(userID.(string), req)
+	id, err := h.svc.Register(c.Request.Context(), userID.(string), req, requestMeta(c))
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, sparql.ErrInvalidTerm) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -41,23 +54,51 @@ func (h *OccurrenceHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "登録成功", "id": id})
 }
 
-// GET /api/occurrences
+// GET /api/occurrences?limit=&cursor=&sort=
+// 本文は {total, items, next_cursor}。総数と次のページはヘッダー (X-Total-Count / Link / X-Next-Cursor) にも付ける
+// sort=owner は持ち主のユーザー名順 (同じ名前なら URI 順)
 func (h *OccurrenceHandler) GetAll(c *gin.Context) {
+	var filter model.OccurrenceListFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// ★修正: 任意認証でユーザーIDを取得して渡す
 	userID := h.getOptionalUserID(c)
 	
-	list, err := h.svc.GetAll(userID)
+	page, err := h.svc.GetAll(c.Request.Context(), userID, filter)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, list)
+
+	c.Header("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		c.Header("X-Next-Cursor", page.NextCursor)
+		setNextLink(c, "cursor", page.NextCursor)
+	}
+	if wantsJSONLD(c) {
+		h.respondJSONLD(c, jsonld.OccurrenceList(h.uris, h.contextURL, page.Items, page.Total))
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 // GET /api/occurrences/:id
+// 非公開の記録は持ち主以外には 404
 func (h *OccurrenceHandler) GetDetail(c *gin.Context) {
 	id := c.Param("id")
-	detail, err := h.svc.GetDetail(id)
+	detail, err := h.svc.GetDetail(c.Request.Context(), id, c.GetString("userID"))
+	if errors.Is(err, sparql.ErrInvalidTerm) {
+		// URIにできないIDはそもそも存在しない
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -66,6 +107,10 @@ func (h *OccurrenceHandler) GetDetail(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
+	if wantsJSONLD(c) {
+		h.respondJSONLD(c, jsonld.Occurrence(h.uris, h.contextURL, detail))
+		return
+	}
 	c.JSON(http.StatusOK, detail)
 }
 
@@ -84,7 +129,15 @@ func (h *OccurrenceHandler) Update(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.Modify(userID.(string), id, req); err != nil {
+	if err := h.svc.Modify(c.Request.Context(), userID.(string), id, req, requestMeta(c)); err != nil {
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, sparql.ErrInvalidTerm) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -101,62 +154,94 @@ func (h *OccurrenceHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.Remove(userID.(string), id); err != nil {
+	if err := h.svc.Remove(c.Request.Context(), userID.(string), id, requestMeta(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "削除成功"})
 }
 
-// GET /api/taxons/:id
-func (h *OccurrenceHandler) GetTaxonStats(c *gin.Context) {
-	id := c.Param("id")
-	stats, err := h.svc.GetTaxonStats(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// GET /api/search?q=&taxon=&trait=&limit=&offset=&sort=&facets=family,trait,owner,visibility
+func (h *OccurrenceHandler) Search(c *gin.Context) {
+	var filter model.OccurrenceSearchFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, stats)
-}
-
-// GET /api/search
-func (h *OccurrenceHandler) Search(c *gin.Context) {
-	query := c.Query("q")
-	taxonQuery := c.Query("taxon")
 	
 	userID := h.getOptionalUserID(c)
 
 	// Service経由で検索実行 (userIDも渡す)
-	docs, err := h.svc.Search(query, taxonQuery, userID)
+	page, err := h.svc.Search(c.Request.Context(), filter, userID)
+	if errors.Is(err, service.ErrInvalidTrait) || errors.Is(err, sparql.ErrInvalidTerm) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, docs)
+	// 件数は Meilisearch の見積もりなので、次のページは「満杯で返ってきたか」でも判定する
+	c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	offset := max(filter.Offset, 0)
+	if len(page.Docs) > 0 && int64(offset+len(page.Docs)) < page.Total {
+		setNextLink(c, "offset", strconv.Itoa(offset+len(page.Docs)))
+	}
+
+	if wantsJSONLD(c) {
+		h.respondJSONLD(c, jsonld.SearchResults(h.uris, h.contextURL, page.Docs, int(page.Total)))
+		return
+	}
+	// いつも {total, hits, facets} で返す (facets は facets= を付けたときだけ)
+	c.JSON(http.StatusOK, page)
+}
+
+// GET /api/contexts/occurrence.jsonld
+func (h *OccurrenceHandler) JSONLDContext(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Render(http.StatusOK, jsonLDRender{data: jsonld.Context})
 }
 
 // ---------------------------------------------------
 // Helper Methods
 // ---------------------------------------------------
 
-// getOptionalUserID: トークンがあればユーザーIDを返し、なければ空文字を返す
-func (h *OccurrenceHandler) getOptionalUserID(c *gin.Context) string {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		return ""
-	}
+// wantsJSONLD: Accept で application/ld+json を application/json より優先しているか
+// どちらで返すかがヘッダーで変わるので Vary も付けておく
+func wantsJSONLD(c *gin.Context) bool {
+	c.Header("Vary", "Accept")
+	return c.NegotiateFormat(gin.MIMEJSON, jsonld.MediaType) == jsonld.MediaType
+}
 
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		return ""
-	}
+// setNextLink: 今のクエリの key だけ差し替えた URL を Link: rel="next" で返す
+func setNextLink(c *gin.Context, key, value string) {
+	q := c.Request.URL.Query()
+	q.Set(key, value)
+	c.Writer.Header().Add("Link", `<`+c.Request.URL.Path+`?`+q.Encode()+`>; rel="next"`)
+}
 
-	// トークンを検証してIDを取り出す
-	claims, err := utils.ParseToken(parts[1])
-	if err != nil {
-		return "" // 無効なトークンなら未ログイン扱い
-	}
+// respondJSONLD: JSON-LD で返す (@context は Link ヘッダーでも知らせる)
+func (h *OccurrenceHandler) respondJSONLD(c *gin.Context, doc jsonld.Node) {
+	c.Writer.Header().Add("Link", `<`+h.contextURL+`>; rel="http://www.w3.org/ns/json-ld#context"; type="`+jsonld.MediaType+`"`)
+	c.Render(http.StatusOK, jsonLDRender{data: doc})
+}
 
-	return claims.UserID
+// jsonLDRender: render.JSON と同じだけど Content-Type を application/ld+json にする
+type jsonLDRender struct {
+	data interface{}
+}
+
+func (r jsonLDRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.data)
+}
+
+func (r jsonLDRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", jsonld.MediaType+"; charset=utf-8")
+}
+
+// getOptionalUserID: OptionalAuth ミドルウェアでログイン済みならユーザーIDを返し、なければ空文字を返す
+func (h *OccurrenceHandler) getOptionalUserID(c *gin.Context) string {
+	return c.GetString("userID")
 }
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCHandler struct {
+	svc        service.OIDCService
+	appBaseURL string // ログイン後に戻すフロントエンドのURL
+}
+
+func NewOIDCHandler(svc service.OIDCService, appBaseURL string) *OIDCHandler {
+	return &OIDCHandler{svc: svc, appBaseURL: appBaseURL}
+}
+
+// GET /api/auth/oidc
+func (h *OIDCHandler) Providers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.svc.Providers()})
+}
+
+// GET /api/auth/oidc/:provider/login
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, err := h.svc.BeginLogin(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// GET /api/auth/oidc/:provider/callback
+// 成功したら通常のJWTを発行して、フロントエンドに URL フラグメントで渡す
+// (フラグメントはサーバーに送られないので、アクセスログにトークンが残らない)
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if errParam := c.Query("error"); errParam != "" {
+		h.redirectWithError(c, errParam)
+		return
+	}
+
+	user, err := h.svc.CompleteLogin(c.Request.Context(), c.Param("provider"), c.Query("code"), c.Query("state"), requestMeta(c))
+	if errors.Is(err, service.ErrOIDCEmailUnverified) {
+		slog.WarnContext(c.Request.Context(), "oidc login rejected", "provider", c.Param("provider"), "error", err)
+		h.redirectWithError(c, "email_unverified")
+		return
+	}
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "oidc login failed", "provider", c.Param("provider"), "error", err)
+		h.redirectWithError(c, "login_failed")
+		return
+	}
+
+	token, err := utils.GenerateToken(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "トークン生成失敗"})
+		return
+	}
+
+	fragment := url.Values{}
+	fragment.Set("token", token)
+	c.Redirect(http.StatusFound, h.appBaseURL+"/auth/callback#"+fragment.Encode())
+}
+
+func (h *OIDCHandler) redirectWithError(c *gin.Context, code string) {
+	q := url.Values{}
+	q.Set("error", code)
+	c.Redirect(http.StatusFound, h.appBaseURL+"/auth/callback?"+q.Encode())
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProfileHandler struct {
+	svc service.ProfileService
+}
+
+func NewProfileHandler(svc service.ProfileService) *ProfileHandler {
+	return &ProfileHandler{svc: svc}
+}
+
+// GET /api/me
+func (h *ProfileHandler) GetMe(c *gin.Context) {
+	user, err := h.svc.GetMe(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// PUT /api/me
+func (h *ProfileHandler) UpdateMe(c *gin.Context) {
+	var req model.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.svc.UpdateMe(c.Request.Context(), c.GetString("userID"), req, requestMeta(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "プロフィールを更新したのだ", "user": user})
+}
+
+// PUT /api/me/password
+func (h *ProfileHandler) ChangePassword(c *gin.Context) {
+	var req model.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.svc.ChangePassword(c.Request.Context(), c.GetString("userID"), req, requestMeta(c)); err != nil {
+		if errors.Is(err, service.ErrWrongPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "パスワードを変更したのだ"})
+}
+
+// GET /api/users/:id
+func (h *ProfileHandler) GetPublicProfile(c *gin.Context) {
+	profile, err := h.svc.GetPublicProfile(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if profile == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
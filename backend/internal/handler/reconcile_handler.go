@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReconcileHandler struct {
+	svc service.ReconcileService
+}
+
+func NewReconcileHandler(svc service.ReconcileService) *ReconcileHandler {
+	return &ReconcileHandler{svc: svc}
+}
+
+// POST /api/taxa/match {"names": ["Homo sapiens L.", ...], "limit": 5}
+// 学名ごとの候補を names と同じ順で返す
+func (h *ReconcileHandler) MatchNames(c *gin.Context) {
+	var req model.NameMatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.svc.MatchNames(c.Request.Context(), req.Names, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// GET/POST /api/reconcile (OpenRefine の Reconciliation Service API)
+// queries が無ければサービスの説明 (manifest)、あれば {"q0": {"result": [...]}, ...} を返す
+// callback を付ければ JSONP で返すのだ
+func (h *ReconcileHandler) Reconcile(c *gin.Context) {
+	raw := c.Query("queries")
+	if raw == "" {
+		raw = c.PostForm("queries")
+	}
+	if raw == "" {
+		c.JSONP(http.StatusOK, reconcileManifest)
+		return
+	}
+
+	var queries map[string]model.ReconcileQuery
+	if err := json.Unmarshal([]byte(raw), &queries); err != nil {
+		c.JSONP(http.StatusBadRequest, gin.H{"error": "queries is not valid JSON: " + err.Error()})
+		return
+	}
+	if len(queries) > model.NameMatchMaxNames {
+		c.JSONP(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many queries (max %d)", model.NameMatchMaxNames)})
+		return
+	}
+	for key, q := range queries {
+		if len(q.Query) > 500 {
+			c.JSONP(http.StatusBadRequest, gin.H{"error": key + ": query is too long"})
+			return
+		}
+	}
+
+	results, err := h.svc.Reconcile(c.Request.Context(), queries)
+	if err != nil {
+		c.JSONP(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSONP(http.StatusOK, results)
+}
+
+// OpenRefine に見せるサービスの説明
+// 候補の id は NCBITaxon の番号だけなので、identifierSpace に続けると ncbitaxon の IRI になる
+var reconcileManifest = gin.H{
+	"versions":        []string{"0.2"},
+	"name":            "bio-occurrence NCBITaxon name reconciliation",
+	"identifierSpace": "http://purl.obolibrary.org/obo/NCBITaxon_",
+	"schemaSpace":     "http://purl.obolibrary.org/obo/ncbitaxon#",
+	"defaultTypes":    []model.ReconcileType{service.ReconcileTaxonType},
+	"view": gin.H{
+		"url": "https://www.ncbi.nlm.nih.gov/Taxonomy/Browser/wwwtax.cgi?id={{id}}",
+	},
+}
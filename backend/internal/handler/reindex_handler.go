@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReindexHandler struct {
+	svc service.ReindexService
+}
+
+func NewReindexHandler(svc service.ReindexService) *ReindexHandler {
+	return &ReindexHandler{svc: svc}
+}
+
+// POST /api/admin/reindex
+// 作り直しは時間がかかるので、始めたらすぐ 202 を返す (進み具合は GET で見る)
+func (h *ReindexHandler) Start(c *gin.Context) {
+	err := h.svc.Start(c.Request.Context(), c.GetString("userID"), requestMeta(c))
+	if errors.Is(err, service.ErrReindexRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "検索インデックスの作り直しを始めたのだ"})
+}
+
+// GET /api/admin/reindex
+func (h *ReindexHandler) Status(c *gin.Context) {
+	status := h.svc.Status()
+	if status == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "このサーバーではまだ作り直していないのだ"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestMeta: 監査ログ用にリクエスト元の情報を取り出す
+func requestMeta(c *gin.Context) model.RequestMeta {
+	return model.RequestMeta{
+		IP:        c.ClientIP(),
+		RequestID: c.GetString("requestID"),
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchSyncHandler struct {
+	svc service.SearchSyncService
+}
+
+func NewSearchSyncHandler(svc service.SearchSyncService) *SearchSyncHandler {
+	return &SearchSyncHandler{svc: svc}
+}
+
+// GET /api/admin/search-outbox?status=pending|failed&limit=
+func (h *SearchSyncHandler) List(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != model.SearchOutboxPending && status != model.SearchOutboxFailed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status は pending か failed なのだ"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := h.svc.ListOutbox(c.Request.Context(), status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// POST /api/admin/search-outbox/:id/retry
+// 諦めた (failed) 操作をもう一度やり直させる
+func (h *SearchSyncHandler) Retry(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id が不正なのだ"})
+		return
+	}
+
+	err = h.svc.RetryOutbox(c.Request.Context(), c.GetString("userID"), requestMeta(c), id)
+	if errors.Is(err, service.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "failed の操作が見つからないのだ"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "再試行に回したのだ"})
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"github.com/saku-730/bio-occurrence/backend/internal/sparql"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 受け付けるクエリの長さの上限
+const maxSPARQLQueryBytes = 64 << 10
+
+type SPARQLHandler struct {
+	svc service.SPARQLService
+}
+
+func NewSPARQLHandler(svc service.SPARQLService) *SPARQLHandler {
+	return &SPARQLHandler{svc: svc}
+}
+
+// GET/POST /api/sparql
+// SPARQL 1.1 Protocol と同じく ?query= / フォーム / application/sparql-query の本文で受け取る
+func (h *SPARQLHandler) Query(c *gin.Context) {
+	query, err := readSPARQLQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query が空なのだ"})
+		return
+	}
+
+	result, err := h.svc.Query(c.Request.Context(), c.GetString("userID"), query, c.GetHeader("Accept"))
+	var statusErr *repository.SPARQLStatusError
+	switch {
+	case err == nil:
+	case errors.Is(err, sparql.ErrQueryRejected):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrNotAcceptable):
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrSPARQLResultTooLarge):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "問い合わせが時間内に終わらなかったのだ"})
+		return
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusServiceUnavailable:
+		// Fuseki 側のタイムアウトは 503 で返ってくる
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "問い合わせが時間内に終わらなかったのだ"})
+		return
+	case errors.As(err, &statusErr) && statusErr.StatusCode < 500:
+		// 構文エラーなどは Fuseki のメッセージをそのまま返す
+		c.JSON(http.StatusBadRequest, gin.H{"error": statusErr.Message})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, result.ContentType, result.Body)
+}
+
+func readSPARQLQuery(c *gin.Context) (string, error) {
+	if c.Request.Method == http.MethodGet {
+		return c.Query("query"), nil
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSPARQLQueryBytes)
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	switch mediaType {
+	case "application/sparql-query":
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return "", errors.New("クエリが長すぎるのだ")
+		}
+		return string(body), nil
+	case "application/x-www-form-urlencoded":
+		if err := c.Request.ParseForm(); err != nil {
+			return "", errors.New("クエリが長すぎるのだ")
+		}
+		return c.Request.PostForm.Get("query"), nil
+	default:
+		return "", errors.New("Content-Type は application/sparql-query か application/x-www-form-urlencoded にしてほしいのだ")
+	}
+}
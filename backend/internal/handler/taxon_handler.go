@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"github.com/saku-730/bio-occurrence/backend/internal/sparql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TaxonHandler struct {
+	svc service.TaxonService
+}
+
+func NewTaxonHandler(svc service.TaxonService) *TaxonHandler {
+	return &TaxonHandler{svc: svc}
+}
+
+// GET /api/taxa/:id (ncbi:9606 / NCBITaxon:9606 / 学名)
+// ログインしていれば自分の非公開の記録も数に入り、自分の記録の一覧も付く
+func (h *TaxonHandler) GetProfile(c *gin.Context) {
+	profile, err := h.svc.GetProfile(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if errors.Is(err, service.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if errors.Is(err, sparql.ErrInvalidTerm) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
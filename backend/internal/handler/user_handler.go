@@ -4,7 +4,11 @@ import (
 	"github.com/saku-730/bio-occurrence/backend/internal/model"
 	"github.com/saku-730/bio-occurrence/backend/internal/service"
 	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,7 +29,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user, err := h.svc.Register(req)
+	user, err := h.svc.Register(c.Request.Context(), req, requestMeta(c))
 	if err != nil {
 		// 重複エラーかどうか判定してステータスコードを変えるとより親切
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -45,7 +49,14 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.svc.Login(req)
+	user, err := h.svc.Login(c.Request.Context(), req, requestMeta(c))
+	var locked *service.LoginLockedError
+	if errors.As(err, &locked) {
+		retryAfter := int(math.Ceil(time.Until(locked.Until).Seconds()))
+		c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		// 認証失敗は 401 Unauthorized
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
@@ -64,3 +75,76 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		"token":   token, 
 	})
 }
+
+// POST /api/auth/forgot
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req model.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.svc.RequestPasswordReset(c.Request.Context(), req, requestMeta(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "メール送信に失敗したのだ"})
+		return
+	}
+
+	// 登録の有無に関わらず同じレスポンスを返す
+	c.JSON(http.StatusOK, gin.H{"message": "登録されていれば、パスワード再設定メールを送信したのだ"})
+}
+
+// POST /api/auth/reset
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req model.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.svc.ResetPassword(c.Request.Context(), req, requestMeta(c)); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "パスワードを再設定したのだ"})
+}
+
+// POST /api/auth/verify
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req model.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.svc.VerifyEmail(c.Request.Context(), req, requestMeta(c)); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "メールアドレスを確認したのだ"})
+}
+
+// POST /api/auth/verify/resend
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.svc.ResendVerification(c.Request.Context(), userID.(string), requestMeta(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "確認メールを再送したのだ"})
+}
@@ -0,0 +1,113 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 起動時リトライの間隔 (1秒から倍々で、最大15秒)
+const (
+	retryBaseDelay = 1 * time.Second
+	retryMaxDelay  = 15 * time.Second
+)
+
+// DependencyCheck: 外部の依存先 (Fuseki・Postgres・Meilisearch) が使えるかを確かめるもの
+type DependencyCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// healthClient: ヘルスチェック用 (タイムアウトは呼び出し側の ctx で決める)
+var healthClient = &http.Client{}
+
+// PostgresCheck: Ping が通るか
+func PostgresCheck(db *sql.DB) DependencyCheck {
+	return DependencyCheck{
+		Name:  "postgres",
+		Check: db.PingContext,
+	}
+}
+
+// FusekiCheck: データセットの /query に ASK {} を投げて答えが返ってくるか
+func FusekiCheck(queryURL, user, pass string) DependencyCheck {
+	return DependencyCheck{
+		Name: "fuseki",
+		Check: func(ctx context.Context) error {
+			form := url.Values{"query": {"ASK {}"}}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, queryURL, strings.NewReader(form.Encode()))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Accept", "application/sparql-results+json")
+			req.SetBasicAuth(user, pass)
+			return doHealthRequest(req)
+		},
+	}
+}
+
+// MeiliCheck: Meilisearch の /health (認証不要) が available を返すか
+func MeiliCheck(baseURL string) DependencyCheck {
+	return DependencyCheck{
+		Name: "meilisearch",
+		Check: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/health", nil)
+			if err != nil {
+				return err
+			}
+			return doHealthRequest(req)
+		},
+	}
+}
+
+func doHealthRequest(req *http.Request) error {
+	resp, err := healthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// WaitFor: 依存先が使えるようになるまで、間隔を倍々に空けながらリトライする
+// コンテナを一斉に起動したとき、DBより先にAPIが立ち上がっても落ちないようにするため
+// timeout を過ぎても繋がらなければ最後のエラーを返す
+func WaitFor(dep DependencyCheck, timeout, attemptTimeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	delay := retryBaseDelay
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), attemptTimeout)
+		err := dep.Check(ctx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("dependency ready", "dependency", dep.Name, "attempt", attempt)
+			}
+			return nil
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("%s に接続できなかったのだ (%d回試行): %w", dep.Name, attempt, err)
+		}
+		slog.Warn("dependency not ready, retrying", "dependency", dep.Name, "attempt", attempt, "retry_in", delay, "error", err)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package infrastructure
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer: メール送信の抽象 (本番は SMTP、開発中はログ/ファイル出力)
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer: SMTP サーバー経由で送る
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPMailer(host, port, user, pass, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: user,
+		Password: pass,
+		From:     from,
+	}
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	msg := buildMessage(m.From, to, subject, body)
+	if err := smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("smtp send failed: %w", err)
+	}
+	return nil
+}
+
+// LogMailer: 開発用。実際には送らず、ログ (と指定があればファイル) に書き出す
+type LogMailer struct {
+	FilePath string // 空ならログ出力のみ
+	mu       sync.Mutex
+}
+
+func NewLogMailer(filePath string) *LogMailer {
+	return &LogMailer{FilePath: filePath}
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	msg := buildMessage("noreply@localhost", to, subject, body)
+	// 開発用なので本文 (リンク) もそのまま出す。宛先は伏せ字になる
+	slog.Info("mail not sent (log mailer)", "to", to, "subject", subject, "body", body)
+
+	if m.FilePath == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.FilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open mail log failed: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "----- %s -----\n%s\n", time.Now().Format(time.RFC3339), msg)
+	return err
+}
+
+// buildMessage: 最低限のヘッダーをつけた RFC 5322 形式のメッセージを作る
+// ヘッダーインジェクション防止のため改行は取り除き、件名は日本語でも大丈夫なようにエンコードする
+func buildMessage(from, to, subject, body string) string {
+	stripCRLF := strings.NewReplacer("\r", "", "\n", "")
+
+	var sb strings.Builder
+	sb.WriteString("From: " + stripCRLF.Replace(from) + "\r\n")
+	sb.WriteString("To: " + stripCRLF.Replace(to) + "\r\n")
+	sb.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", stripCRLF.Replace(subject)) + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(body)
+	return sb.String()
+}
@@ -0,0 +1,119 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProviderConfig: 外部IdP (ORCID・大学のSSO・開発用モック) ごとの設定
+type OIDCProviderConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // 例: http://localhost:8080/api/auth/oidc/orcid/callback
+	Scopes       []string // 省略時は openid, profile, email
+}
+
+// OIDCClaims: ID トークンから取り出す値
+type OIDCClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	GivenName         string `json:"given_name"`
+	FamilyName        string `json:"family_name"`
+}
+
+// OIDCProvider: Relying Party としての通信を担当する
+// Discovery は最初に使われたときに行う (起動時に IdP が落ちていてもサーバーは立ち上がるように)
+type OIDCProvider struct {
+	Config OIDCProviderConfig
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCProvider(cfg OIDCProviderConfig) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	return &OIDCProvider{Config: cfg}
+}
+
+// IsORCID: ORCID のプロバイダーか (sub がそのまま ORCID iD になる)
+func (p *OIDCProvider) IsORCID() bool {
+	return p.Config.Name == "orcid" || strings.Contains(p.Config.IssuerURL, "orcid.org")
+}
+
+// AuthCodeURL: 認可エンドポイントへのURLを作る (PKCE S256 + nonce)
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+// Exchange: 認可コードをトークンに交換し、ID トークンを検証してクレームを返す
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCClaims, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("id_token が返ってこなかった")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("id_token verification failed: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+
+	var claims OIDCClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("claims decode failed: %w", err)
+	}
+	claims.Subject = idToken.Subject
+	return &claims, nil
+}
+
+// discover: .well-known/openid-configuration を読んで設定を組み立てる (成功したら以後キャッシュ)
+func (p *OIDCProvider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth != nil {
+		return nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.Config.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("oidc discovery failed (%s): %w", p.Config.Name, err)
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     p.Config.ClientID,
+		ClientSecret: p.Config.ClientSecret,
+		RedirectURL:  p.Config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.Config.Scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.Config.ClientID})
+	return nil
+}
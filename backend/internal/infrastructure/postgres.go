@@ -18,12 +18,8 @@ func NewPostgresDB(host, port, user, password, dbname string) *sql.DB {
 		log.Fatalf("❌ Failed to connect to Postgres: %v", err)
 	}
 
-	// 接続確認（Ping）
-	// コンテナ起動直後は接続できないことがあるので、数回リトライするロジックを入れると親切だけど、
-	// 今回はシンプルにPingしてダメなら落ちるようにするのだ
-	if err := db.Ping(); err != nil {
-		log.Fatalf("❌ Postgres Ping failed: %v", err)
-	}
+	// 接続確認はここではしない
+	// コンテナ起動直後は繋がらないことがあるので、呼び出し側で WaitFor(PostgresCheck(db), ...) してリトライするのだ
 
 	// 接続プールの設定（おまじない）
 	db.SetMaxOpenConns(25)
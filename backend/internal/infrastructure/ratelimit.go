@@ -0,0 +1,321 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// ログイン失敗によるロックの設定
+// 5回連続で失敗したら1分ロックし、以後失敗するたびにロック時間を倍にしていく (最大1時間)
+const (
+	lockoutThreshold  = 5
+	lockoutBaseLock   = 1 * time.Minute
+	lockoutMaxLock    = 1 * time.Hour
+	lockoutFailureTTL = 24 * time.Hour // これだけ失敗が無ければカウントをリセット
+)
+
+// bucketTTL: これだけ触られていないバケットは満タンに戻っているので消してよい (一番長い予算の Per より長くする)
+const bucketTTL = 1 * time.Hour
+
+// RateLimitResult: トークンバケットから1つ取り出した結果
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // 拒否されたとき、次の1トークンが溜まるまでの時間
+	Reset      time.Duration // バケットが満タンに戻るまでの時間
+}
+
+// RateLimitStore: レート制限とログインロックの状態を保存する場所
+// 開発・単一プロセスならメモリ、複数台構成なら Postgres を使う
+type RateLimitStore interface {
+	// Take: key のバケットから1トークン消費する (capacity 個まで、per 時間で満タンに回復)
+	Take(key string, capacity int, per time.Duration) (*RateLimitResult, error)
+
+	// LockedUntil: ログインがロックされていればその期限を返す (ロックされていなければゼロ値)
+	LockedUntil(key string) (time.Time, error)
+	// RecordFailure: ログイン失敗を記録し、ロックされた場合はその期限を返す
+	RecordFailure(key string) (time.Time, error)
+	// ResetFailures: ログイン成功時に失敗回数を消す
+	ResetFailures(key string) error
+
+	// Prune: 満タンに戻ったバケットと期限切れの失敗記録を消す
+	Prune() error
+}
+
+// PruneRateLimits: every ごとに store.Prune を呼ぶ (ctx が閉じたら戻る)
+// キーはIPやユーザーごとに増えていくので、放っておくとテーブルが膨らみ続けるのだ
+func PruneRateLimits(ctx context.Context, store RateLimitStore, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := store.Prune(); err != nil {
+				slog.Error("rate limit prune failed", "error", err)
+			}
+		}
+	}
+}
+
+// lockDuration: 連続失敗回数に応じたロック時間 (閾値未満なら0)
+func lockDuration(failures int) time.Duration {
+	if failures < lockoutThreshold {
+		return 0
+	}
+	d := lockoutBaseLock * time.Duration(math.Pow(2, float64(failures-lockoutThreshold)))
+	if d > lockoutMaxLock || d <= 0 {
+		d = lockoutMaxLock
+	}
+	return d
+}
+
+// newResult: 残りトークン数から結果を組み立てる
+func newResult(allowed bool, tokens float64, capacity int, per time.Duration) *RateLimitResult {
+	rate := float64(capacity) / per.Seconds() // 1秒あたりの回復量
+	res := &RateLimitResult{
+		Allowed:   allowed,
+		Limit:     capacity,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((float64(capacity) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return res
+}
+
+// ---------------------------------------------------
+// メモリ実装
+// ---------------------------------------------------
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type loginFailure struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	failures  map[string]*loginFailure
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]*bucket),
+		failures:  make(map[string]*loginFailure),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, capacity int, per time.Duration) (*RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(capacity), updated: now}
+		s.buckets[key] = b
+	}
+
+	// 経過時間分を回復させる
+	rate := float64(capacity) / per.Seconds()
+	b.tokens = math.Min(float64(capacity), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return newResult(false, b.tokens, capacity, per), nil
+	}
+	b.tokens--
+	return newResult(true, b.tokens, capacity, per), nil
+}
+
+func (s *MemoryRateLimitStore) LockedUntil(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.failures[key]; ok && f.lockedUntil.After(time.Now()) {
+		return f.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryRateLimitStore) RecordFailure(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	f, ok := s.failures[key]
+	if !ok || now.Sub(f.lastFailure) > lockoutFailureTTL {
+		f = &loginFailure{}
+		s.failures[key] = f
+	}
+	f.count++
+	f.lastFailure = now
+	if d := lockDuration(f.count); d > 0 {
+		f.lockedUntil = now.Add(d)
+	}
+	return f.lockedUntil, nil
+}
+
+func (s *MemoryRateLimitStore) ResetFailures(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+func (s *MemoryRateLimitStore) Prune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(time.Now())
+	return nil
+}
+
+// sweep: Take のついでに時々掃除して、Prune を呼ばなくてもメモリが増え続けないようにする
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.prune(now)
+}
+
+// prune: 満タンに戻ったバケットや古い失敗記録を消す (mu を取った状態で呼ぶ)
+func (s *MemoryRateLimitStore) prune(now time.Time) {
+	s.lastSweep = now
+
+	for k, b := range s.buckets {
+		if now.Sub(b.updated) > bucketTTL {
+			delete(s.buckets, k)
+		}
+	}
+	for k, f := range s.failures {
+		if now.Sub(f.lastFailure) > lockoutFailureTTL && !f.lockedUntil.After(now) {
+			delete(s.failures, k)
+		}
+	}
+}
+
+// ---------------------------------------------------
+// Postgres 実装 (複数台のAPIサーバーで状態を共有する)
+// ---------------------------------------------------
+
+type PostgresRateLimitStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRateLimitStore(db *sql.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+// Take: 回復と消費を1つの UPSERT で行うので、同時アクセスでも数え間違えない
+// (DO UPDATE の中ではロック済みの最新行を参照するため)
+func (s *PostgresRateLimitStore) Take(key string, capacity int, per time.Duration) (*RateLimitResult, error) {
+	rate := float64(capacity) / per.Seconds()
+
+	// 経過時間分を回復させたトークン数
+	const refilled = `LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - rate_limit_buckets.updated_at)) * $3::float8)`
+
+	query := `
+		INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+		VALUES ($1, $2::float8 - 1, TRUE, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN ` + refilled + ` >= 1 THEN ` + refilled + ` - 1 ELSE ` + refilled + ` END,
+			allowed = ` + refilled + ` >= 1,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING tokens, allowed
+	`
+	var tokens float64
+	var allowed bool
+	if err := s.db.QueryRow(query, key, capacity, rate).Scan(&tokens, &allowed); err != nil {
+		return nil, fmt.Errorf("rate limit query failed: %w", err)
+	}
+	return newResult(allowed, tokens, capacity, per), nil
+}
+
+func (s *PostgresRateLimitStore) LockedUntil(key string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	query := `SELECT locked_until FROM login_failures WHERE key = $1 AND locked_until > CURRENT_TIMESTAMP`
+	err := s.db.QueryRow(query, key).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+func (s *PostgresRateLimitStore) RecordFailure(key string) (time.Time, error) {
+	query := `
+		INSERT INTO login_failures (key, failures, last_failure_at)
+		VALUES ($1, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_failures.last_failure_at < CURRENT_TIMESTAMP - $2::interval THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			last_failure_at = CURRENT_TIMESTAMP
+		RETURNING failures
+	`
+	var failures int
+	if err := s.db.QueryRow(query, key, fmt.Sprintf("%d seconds", int(lockoutFailureTTL.Seconds()))).Scan(&failures); err != nil {
+		return time.Time{}, fmt.Errorf("record login failure failed: %w", err)
+	}
+
+	d := lockDuration(failures)
+	if d == 0 {
+		return time.Time{}, nil
+	}
+
+	lockedUntil := time.Now().Add(d)
+	if _, err := s.db.Exec(`UPDATE login_failures SET locked_until = $2 WHERE key = $1`, key, lockedUntil); err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil, nil
+}
+
+func (s *PostgresRateLimitStore) ResetFailures(key string) error {
+	_, err := s.db.Exec(`DELETE FROM login_failures WHERE key = $1`, key)
+	return err
+}
+
+// Prune: 失敗記録はロック中のものを残す (ロックが外れる前に消すと、失敗回数が0から数え直しになってしまう)
+func (s *PostgresRateLimitStore) Prune() error {
+	if _, err := s.db.Exec(
+		`DELETE FROM rate_limit_buckets WHERE updated_at < CURRENT_TIMESTAMP - $1::interval`,
+		fmt.Sprintf("%d seconds", int(bucketTTL.Seconds())),
+	); err != nil {
+		return fmt.Errorf("prune rate limit buckets failed: %w", err)
+	}
+
+	query := `
+		DELETE FROM login_failures
+		WHERE last_failure_at < CURRENT_TIMESTAMP - $1::interval
+		  AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+	`
+	if _, err := s.db.Exec(query, fmt.Sprintf("%d seconds", int(lockoutFailureTTL.Seconds()))); err != nil {
+		return fmt.Errorf("prune login failures failed: %w", err)
+	}
+	return nil
+}
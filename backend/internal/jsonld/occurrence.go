@@ -0,0 +1,158 @@
+package jsonld
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"strings"
+)
+
+// 記録 API の JSON-LD 表現
+// フィールド名は普段の JSON と揃えて、@context で Darwin Core / Dublin Core / schema.org の語彙に対応させるのだ
+
+const (
+	MediaType = "application/ld+json"
+
+	// ContextPath: @context を公開しているパス (文書には ContextURL で絶対URLにして書く)
+	ContextPath = "/api/contexts/occurrence.jsonld"
+
+	// Bioschemas の Taxon プロファイル (schema:Taxon を使う側の目印)
+	bioschemasTaxon = "https://bioschemas.org/profiles/Taxon/1.0-RELEASE"
+)
+
+// Node: JSON-LD のノード (形質の述語 IRI をそのままキーにするので map にしている)
+type Node map[string]interface{}
+
+// Context: 公開する @context 文書
+var Context = Node{
+	"@context": Node{
+		"@version": 1.1,
+
+		"dwc":     "http://rs.tdwg.org/dwc/terms/",
+		"dcterms": "http://purl.org/dc/terms/",
+		"schema":  "https://schema.org/",
+		"rdfs":    "http://www.w3.org/2000/01/rdf-schema#",
+		"xsd":     "http://www.w3.org/2001/XMLSchema#",
+		"obo":     "http://purl.obolibrary.org/obo/",
+
+		"id":       "@id",
+		"type":     "@type",
+		"included": "@included",
+
+		"Occurrence":  "dwc:Occurrence",
+		"Observation": "schema:Observation",
+		"Taxon":       "schema:Taxon",
+		"Person":      "schema:Person",
+		"ItemList":    "schema:ItemList",
+
+		"taxon":       Node{"@id": "dwc:scientificNameID", "@type": "@id"},
+		"taxon_label": "dwc:scientificName",
+		"remarks":     "dwc:occurrenceRemarks",
+		"owner":       Node{"@id": "dcterms:creator", "@type": "@id"},
+		"created_at":  Node{"@id": "dcterms:created", "@type": "xsd:dateTime"},
+		"keywords":    "schema:keywords",
+		"name":        "schema:name",
+		"label":       "rdfs:label",
+		"conforms_to": Node{"@id": "dcterms:conformsTo", "@type": "@id"},
+
+		"items": Node{"@id": "schema:itemListElement", "@container": "@list"},
+		"total": "schema:numberOfItems",
+	},
+}
+
+// ContextURL: 文書に書く @context の URL
+// 文書だけ取り出して読まれても (ハーベスターなど) 辿れるように、公開URLからの絶対URLにする
+func ContextURL(publicBaseURL string) string {
+	return strings.TrimSuffix(publicBaseURL, "/") + ContextPath
+}
+
+// Occurrence: 記録の詳細
+// 形質は RDF と同じく「述語 IRI: 値」で持たせ、述語のラベルは included に入れる
+func Occurrence(uris model.BaseURIs, contextURL string, d *model.OccurrenceDetail) Node {
+	n := occurrenceNode(uris, d.ID, d.TaxonID, d.TaxonName, d.Remarks, d.OwnerID, d.OwnerName, d.CreatedAt)
+
+	var included []Node
+	seenPred := make(map[string]bool)
+	for _, t := range d.Traits {
+		pred := utils.ExpandTermID(t.PredicateID)
+		value := Node{"id": utils.ExpandTermID(t.ValueID)}
+		if t.ValueLabel != "" {
+			value["label"] = t.ValueLabel
+		}
+		values, _ := n[pred].([]Node)
+		n[pred] = append(values, value)
+
+		if !seenPred[pred] && t.PredicateLabel != "" {
+			included = append(included, Node{"id": pred, "label": t.PredicateLabel})
+			seenPred[pred] = true
+		}
+	}
+	if len(included) > 0 {
+		n["included"] = included
+	}
+
+	n["@context"] = contextURL
+	return n
+}
+
+// OccurrenceList: 記録の一覧 (total はページに関係ない全件数)
+func OccurrenceList(uris model.BaseURIs, contextURL string, items []model.OccurrenceListItem, total int) Node {
+	nodes := make([]Node, 0, len(items))
+	for _, it := range items {
+		nodes = append(nodes, occurrenceNode(uris, it.ID, "", it.TaxonName, it.Remarks, it.OwnerID, it.OwnerName, it.CreatedAt))
+	}
+	return itemList(contextURL, nodes, total)
+}
+
+// SearchResults: 全文検索の結果
+func SearchResults(uris model.BaseURIs, contextURL string, docs []repository.OccurrenceDocument, total int) Node {
+	nodes := make([]Node, 0, len(docs))
+	for _, d := range docs {
+		// 検索のドキュメントの id は URI の最後の UUID だけなので、詳細と同じ URI に戻す
+		n := occurrenceNode(uris, uris.OccurrenceURI(d.ID), d.TaxonID, d.TaxonLabel, d.Remarks, d.OwnerID, d.OwnerName, d.CreatedAt)
+		if len(d.Traits) > 0 {
+			n["keywords"] = d.Traits
+		}
+		nodes = append(nodes, n)
+	}
+	return itemList(contextURL, nodes, total)
+}
+
+func itemList(contextURL string, nodes []Node, total int) Node {
+	return Node{
+		"@context": contextURL,
+		"type":     "ItemList",
+		"total":    total,
+		"items":    nodes,
+	}
+}
+
+func occurrenceNode(uris model.BaseURIs, id, taxonID, taxonName, remarks, ownerID, ownerName, createdAt string) Node {
+	n := Node{
+		"id":          id,
+		"type":        []string{"Occurrence", "Observation"},
+		"taxon_label": taxonName,
+	}
+	if taxonID != "" {
+		n["taxon"] = Node{
+			"id":          utils.ExpandTermID(taxonID),
+			"type":        "Taxon",
+			"name":        taxonName,
+			"conforms_to": bioschemasTaxon,
+		}
+	}
+	if remarks != "" {
+		n["remarks"] = remarks
+	}
+	if ownerID != "" {
+		owner := Node{"id": uris.UserURI(ownerID), "type": "Person"}
+		if ownerName != "" {
+			owner["name"] = ownerName
+		}
+		n["owner"] = owner
+	}
+	if createdAt != "" {
+		n["created_at"] = createdAt
+	}
+	return n
+}
@@ -0,0 +1,65 @@
+package jsonld
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"net/url"
+	"testing"
+)
+
+var testURIs = model.BaseURIs{
+	Base:       "http://my-db.org/",
+	Occurrence: "http://my-db.org/occ/",
+	User:       "http://my-db.org/user/",
+}
+
+var testContextURL = ContextURL("https://api.my-db.org/")
+
+// 検索結果の id も、詳細・Linked Data と同じ記録の URI (絶対 IRI) になっていること
+func TestSearchResultsUseOccurrenceURI(t *testing.T) {
+	const uuid = "0b7c2f0e-5d7a-4c8e-9a55-1f1f4c3e2a10"
+	uri := testURIs.OccurrenceURI(uuid)
+
+	doc := SearchResults(testURIs, testContextURL, []repository.OccurrenceDocument{{ID: uuid, TaxonID: "ncbi:9606", TaxonLabel: "Homo sapiens"}}, 1)
+	items := doc["items"].([]Node)
+	if len(items) != 1 {
+		t.Fatalf("items = %d, want 1", len(items))
+	}
+	id, _ := items[0]["id"].(string)
+
+	u, err := url.Parse(id)
+	if err != nil || !u.IsAbs() {
+		t.Fatalf("id = %q, want an absolute IRI", id)
+	}
+	if id != uri {
+		t.Errorf("id = %q, want %q", id, uri)
+	}
+
+	// 詳細 (repository は記録の URI をそのまま ID に入れる) と同じになる
+	detail := Occurrence(testURIs, testContextURL, &model.OccurrenceDetail{ID: uri, TaxonName: "Homo sapiens"})
+	if detail["id"] != id {
+		t.Errorf("detail id = %v, search id = %q", detail["id"], id)
+	}
+}
+
+// @context は文書だけ取り出されても辿れる絶対URLになっていること
+func TestContextIsAbsolute(t *testing.T) {
+	const want = "https://api.my-db.org/api/contexts/occurrence.jsonld"
+	for _, base := range []string{"https://api.my-db.org", "https://api.my-db.org/"} {
+		if got := ContextURL(base); got != want {
+			t.Errorf("ContextURL(%q) = %q, want %q", base, got, want)
+		}
+	}
+
+	docs := map[string]Node{
+		"detail": Occurrence(testURIs, testContextURL, &model.OccurrenceDetail{ID: testURIs.OccurrenceURI("1")}),
+		"list":   OccurrenceList(testURIs, testContextURL, []model.OccurrenceListItem{{ID: testURIs.OccurrenceURI("1")}}, 1),
+		"search": SearchResults(testURIs, testContextURL, []repository.OccurrenceDocument{{ID: "1"}}, 1),
+	}
+	for name, doc := range docs {
+		ctx, _ := doc["@context"].(string)
+		if u, err := url.Parse(ctx); err != nil || !u.IsAbs() || ctx != want {
+			t.Errorf("%s: @context = %q, want %q", name, ctx, want)
+		}
+	}
+}
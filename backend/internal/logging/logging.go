@@ -0,0 +1,164 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ログは log/slog で出す (本番は JSON、手元では text にもできる)
+// slog.InfoContext(ctx, ...) のように ctx を渡すと、リクエストIDとトレースIDが自動で付く
+
+type ctxKey struct{}
+
+// WithRequestID: リクエストIDを ctx に入れる (RequestID ミドルウェアが呼ぶ)
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// RequestID: ctx に入っているリクエストID (無ければ空)
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Setup: ログの出力形式とレベルを決めて slog のデフォルトにする
+// 標準の log パッケージの出力もこのハンドラーに流れる
+func Setup(w io.Writer, level, format string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redactAttr}
+	var h slog.Handler
+	switch format {
+	case "json", "":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("ログの形式は json か text なのだ: %q", format)
+	}
+
+	slog.SetDefault(slog.New(&contextHandler{Handler: h}))
+	return nil
+}
+
+// ParseLevel: debug / info / warn / error
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("ログレベルは debug / info / warn / error のどれかなのだ: %q", level)
+	}
+	return lvl, nil
+}
+
+// contextHandler: ctx のリクエストIDを request_id、トレースIDを trace_id として付ける
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// ---------------------------------------------------
+// 伏せ字 (パスワード・トークン・個人情報をログに残さない)
+// ---------------------------------------------------
+
+const redacted = "[REDACTED]"
+
+// 値を丸ごと伏せるキー (部分一致、小文字で比較)
+var secretKeys = []string{"password", "passwd", "secret", "token", "authorization", "api_key", "apikey", "cookie"}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	if key == "email" || key == "to" {
+		return slog.String(a.Key, RedactEmail(a.Value.String()))
+	}
+	if a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, redactString(a.Value.String()))
+	}
+	return a
+}
+
+var (
+	reEmail       = regexp.MustCompile(`([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})`)
+	reURLUserinfo = regexp.MustCompile(`(https?://)[^/@\s]+@`)
+	reBearer      = regexp.MustCompile(`(?i)\b(Bearer|Basic|ApiKey)\s+[A-Za-z0-9._~+/=-]+`)
+	reAPIKey      = regexp.MustCompile(`\bbio_[A-Za-z0-9_-]{8,}`)
+)
+
+// redactString: 文字列の中に紛れ込んだメールアドレス・URLの認証情報・トークンを伏せる
+func redactString(s string) string {
+	s = reEmail.ReplaceAllString(s, "$1***@$2")
+	s = reURLUserinfo.ReplaceAllString(s, "$1"+redacted+"@")
+	s = reBearer.ReplaceAllString(s, "$1 "+redacted)
+	s = reAPIKey.ReplaceAllString(s, "bio_"+redacted)
+	return s
+}
+
+// RedactEmail: taro@example.com → t***@example.com
+func RedactEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return redactString(email)
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// SPARQL の文字列リテラル ("..." / '...')。備考やラベルなどユーザーの入力が入るので中身は伏せる
+var reSPARQLLiteral = regexp.MustCompile(`"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'`)
+
+// RedactSPARQL: ログに出すSPARQLからリテラルの中身を伏せ、長すぎる場合は切り詰める
+func RedactSPARQL(query string, max int) string {
+	q := reSPARQLLiteral.ReplaceAllStringFunc(query, func(lit string) string {
+		return lit[:1] + "***" + lit[:1]
+	})
+	q = strings.Join(strings.Fields(q), " ") // 改行・インデントを詰めて1行にする
+	return Truncate(q, max)
+}
+
+// Truncate: max バイトを超えたら切って "…" を付ける (UTF-8 の途中では切らない)
+func Truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…"
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus のメトリクス (/metrics で公開する)
+// 名前は bio_ から始める
+
+const namespace = "bio"
+
+// HTTP: ルート (/api/occurrences/:id のようなテンプレート) ごとの処理時間
+var HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: "http",
+	Name:      "request_duration_seconds",
+	Help:      "HTTP request latency by route and status.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+// SPARQL: Fuseki への query / update
+var (
+	sparqlDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "sparql",
+		Name:      "request_duration_seconds",
+		Help:      "SPARQL request latency against Fuseki.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"operation"})
+
+	sparqlErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "sparql",
+		Name:      "errors_total",
+		Help:      "SPARQL requests that failed (transport error or HTTP status >= 400).",
+	}, []string{"operation"})
+)
+
+// 検索: Meilisearch の search / index / delete
+var (
+	searchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "meili",
+		Name:      "request_duration_seconds",
+		Help:      "Meilisearch call latency.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	searchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "meili",
+		Name:      "errors_total",
+		Help:      "Meilisearch calls that failed.",
+	}, []string{"operation"})
+)
+
+// 業務メトリクス: 記録の登録・更新・削除の件数
+var occurrenceChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "occurrences",
+	Name:      "changes_total",
+	Help:      "Occurrences created, updated or deleted.",
+}, []string{"action"})
+
+// 検索インデックスの同期: search_outbox の1行を処理した結果
+var searchSyncResults = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "search_sync",
+	Name:      "operations_total",
+	Help:      "Search outbox operations processed, by result (synced, retry, failed).",
+}, []string{"result"})
+
+// search_outbox の処理結果 (searchSyncResults の result ラベル)
+const (
+	SearchSynced = "synced"
+	SearchRetry  = "retry"
+	SearchFailed = "failed"
+)
+
+// 記録の操作 (occurrenceChanges の action ラベル)
+const (
+	OccurrenceCreated = "created"
+	OccurrenceUpdated = "updated"
+	OccurrenceDeleted = "deleted"
+)
+
+// ObserveSPARQL: defer metrics.ObserveSPARQL("query", time.Now(), &err) のように使う
+func ObserveSPARQL(operation string, start time.Time, err *error) {
+	sparqlDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil && *err != nil {
+		sparqlErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveSearch: defer metrics.ObserveSearch("search", time.Now(), &err) のように使う
+func ObserveSearch(operation string, start time.Time, err *error) {
+	searchDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil && *err != nil {
+		searchErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// OccurrenceChanged: 記録の登録・更新・削除が成功したら呼ぶ
+func OccurrenceChanged(action string) {
+	occurrenceChanges.WithLabelValues(action).Inc()
+}
+
+// SearchSyncProcessed: search_outbox の1行を処理したら呼ぶ
+func SearchSyncProcessed(result string) {
+	searchSyncResults.WithLabelValues(result).Inc()
+}
+
+// RegisterDBStats: Postgres のコネクションプールの状態 (使用中・待ち時間など) を公開する
+func RegisterDBStats(db *sql.DB, dbName string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
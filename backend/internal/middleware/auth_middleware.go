@@ -1,43 +1,121 @@
 package middleware
 
 import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
 	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"context"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// 認証方式 (コンテキストの "authMethod" に入る)
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
+// APIKeyAuthenticator: APIキーを検証できるもの (service.APIKeyService が満たす)
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, rawKey string) (*model.APIKey, error)
+}
+
 // 認証ミドルウェア
-func AuthRequired() gin.HandlerFunc {
+// Bearer トークン (JWT) か、"Authorization: ApiKey ..." / "X-API-Key" ヘッダーのAPIキーを受け付ける
+func AuthRequired(keyAuth APIKeyAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 1. ヘッダーから Authorization を取得
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "認証トークンが必要なのだ"})
+		ok, errMsg := authenticate(c, keyAuth)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": errMsg})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		// 2. "Bearer <token>" の形式かチェック
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "トークンの形式が不正なのだ"})
-			c.Abort()
-			return
+// 任意認証ミドルウェア
+// 認証情報があって正しければユーザーIDをセットし、無い・不正な場合は未ログイン扱いで先に進む
+func OptionalAuth(keyAuth APIKeyAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(c, keyAuth)
+		c.Next()
+	}
+}
+
+// スコープ確認ミドルウェア
+// APIキーで認証された場合だけスコープを確認する (JWTでのログインは全権限)
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, exists := c.Get("apiKey"); exists {
+			if key, ok := v.(*model.APIKey); ok && !key.HasScope(scope) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "このAPIキーには '" + scope + "' 権限が無いのだ"})
+				c.Abort()
+				return
+			}
 		}
+		c.Next()
+	}
+}
 
-		// 3. トークンを検証
-		tokenString := parts[1]
-		claims, err := utils.ParseToken(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "無効なトークンなのだ"})
+// ログインセッション限定ミドルウェア
+// APIキーの管理などはAPIキー自身では操作させない
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("authMethod") == AuthMethodAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "この操作はログインが必要なのだ (APIキー不可)"})
 			c.Abort()
 			return
 		}
-
-		// 4. 成功！ユーザーIDをコンテキストに保存（後でハンドラーで使うため）
-		c.Set("userID", claims.UserID)
 		c.Next()
 	}
 }
+
+// authenticate: ヘッダーを見て認証し、成功したらコンテキストにユーザー情報をセットする
+// 戻り値は (成功したか, 失敗時のエラーメッセージ)
+func authenticate(c *gin.Context, keyAuth APIKeyAuthenticator) (bool, string) {
+	// 1. APIキー (X-API-Key または Authorization: ApiKey ...)
+	rawKey := c.GetHeader("X-API-Key")
+
+	authHeader := c.GetHeader("Authorization")
+	parts := strings.Split(authHeader, " ")
+	if rawKey == "" && len(parts) == 2 && parts[0] == "ApiKey" {
+		rawKey = parts[1]
+	}
+
+	if rawKey != "" {
+		if keyAuth == nil {
+			return false, "APIキー認証は無効なのだ"
+		}
+		key, err := keyAuth.Authenticate(c.Request.Context(), rawKey)
+		if err != nil || key == nil {
+			return false, "無効なAPIキーなのだ"
+		}
+		c.Set("userID", key.UserID)
+		c.Set("apiKey", key)
+		c.Set("authMethod", AuthMethodAPIKey)
+		return true, ""
+	}
+
+	// 2. ヘッダーから Authorization を取得
+	if authHeader == "" {
+		return false, "認証トークンが必要なのだ"
+	}
+
+	// 3. "Bearer <token>" の形式かチェック
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return false, "トークンの形式が不正なのだ"
+	}
+
+	// 4. トークンを検証
+	claims, err := utils.ParseToken(parts[1])
+	if err != nil {
+		return false, "無効なトークンなのだ"
+	}
+
+	// 5. 成功！ユーザーIDをコンテキストに保存（後でハンドラーで使うため）
+	c.Set("userID", claims.UserID)
+	c.Set("authMethod", AuthMethodJWT)
+	return true, ""
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IP制限ミドルウェア (/metrics など、外に見せたくないものを API と同じポートで出すとき用)
+// allow は IP か CIDR (config で形はチェック済み)。ClientIP を使うので信用するプロキシ経由なら元のIPで判定する
+func IPAllowlist(allow []string) gin.HandlerFunc {
+	var nets []*net.IPNet
+	for _, a := range allow {
+		if ip := net.ParseIP(a); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, n, err := net.ParseCIDR(a); err == nil {
+			nets = append(nets, n)
+		}
+	}
+
+	return func(c *gin.Context) {
+		ip := net.ParseIP(c.ClientIP())
+		for _, n := range nets {
+			if ip != nil && n.Contains(ip) {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied: このアドレスからは見られないのだ"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/saku-730/bio-occurrence/backend/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// メトリクスミドルウェア
+// ルートはパスそのものではなくテンプレート (/api/occurrences/:id) で数える (IDごとにラベルが増えないように)
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched" // 404 はまとめる
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
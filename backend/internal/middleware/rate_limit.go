@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitBudget: ルートごとの上限 (Per の間に Capacity 回まで。バケットは少しずつ回復する)
+type RateLimitBudget struct {
+	Name     string
+	Capacity int
+	Per      time.Duration
+}
+
+// レート制限ミドルウェア (トークンバケット)
+// 認証済みならAPIキー/ユーザー単位、未ログインならIP単位で数える。
+// 認証情報を使うので AuthRequired / OptionalAuth より後ろに置くこと
+func RateLimit(store infrastructure.RateLimitStore, budget RateLimitBudget) gin.HandlerFunc {
+	return rateLimit(store, budget, clientIdentity)
+}
+
+// RateLimitByIP: ログインしていてもIP単位で数えるレート制限
+// 認証より前 (APIキーの照合で DB を叩く前) に置いて、1つのIPからの大量アクセスを止める用なのだ
+func RateLimitByIP(store infrastructure.RateLimitStore, budget RateLimitBudget) gin.HandlerFunc {
+	return rateLimit(store, budget, func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	})
+}
+
+func rateLimit(store infrastructure.RateLimitStore, budget RateLimitBudget, identity func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := budget.Name + ":" + identity(c)
+
+		res, err := store.Take(key, budget.Capacity, budget.Per)
+		if err != nil {
+			// ストアが落ちていても API 自体は止めない
+			slog.ErrorContext(c.Request.Context(), "rate limit store error", "budget", budget.Name, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "リクエストが多すぎるのだ。少し待ってから再度試すのだ"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientIdentity: レート制限を数える単位
+func clientIdentity(c *gin.Context) string {
+	if v, exists := c.Get("apiKey"); exists {
+		if key, ok := v.(*model.APIKey); ok {
+			return "key:" + key.ID
+		}
+	}
+	if userID := c.GetString("userID"); userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds: ヘッダー用に秒へ切り上げ (0秒にはしない)
+func ceilSeconds(d time.Duration) int {
+	s := int(math.Ceil(d.Seconds()))
+	if s < 1 {
+		return 1
+	}
+	return s
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/saku-730/bio-occurrence/backend/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 受け付けるリクエストIDの形 (ログに変な文字を混ぜられないように)
+var reRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// リクエストIDミドルウェア
+// X-Request-ID が付いていればそれを使い、無ければ発行してレスポンスにも付ける
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !reRequestID.MatchString(id) {
+			id = uuid.New().String()
+		}
+		c.Set("requestID", id)
+		c.Header("X-Request-ID", id)
+
+		// サービス・リポジトリのログにも付くように、リクエストの ctx にも入れる
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SuperuserChecker: ユーザーがスーパーユーザーか確認できるもの (service.AuthService が満たす)
+type SuperuserChecker interface {
+	IsSuperuser(ctx context.Context, userID string) (bool, error)
+}
+
+// スーパーユーザー専用ミドルウェア (AuthRequired の後ろに置く)
+func SuperuserRequired(checker SuperuserChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, err := checker.IsSuperuser(c.Request.Context(), c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied: スーパーユーザー専用なのだ"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// APIキーのスコープ
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// api_keys テーブルの形
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"` // JSONには含めない
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope: 指定のスコープを持っているか
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIキー作成リクエスト
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=255"`
+	Scopes        []string `json:"scopes"`          // 省略時は read のみ
+	ExpiresInDays int      `json:"expires_in_days"` // 0 なら無期限
+}
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// 監査ログのアクション名
+const (
+	AuditOccurrenceCreate = "occurrence.create"
+	AuditOccurrenceUpdate = "occurrence.update"
+	AuditOccurrenceDelete = "occurrence.delete"
+
+	AuditAuthRegister       = "auth.register"
+	AuditAuthLogin          = "auth.login"
+	AuditAuthLoginFailed    = "auth.login_failed"
+	AuditAuthLoginLocked    = "auth.login_locked"
+	AuditAuthOIDCLogin      = "auth.oidc_login"
+	AuditAuthResetRequested = "auth.password_reset_requested"
+	AuditAuthPasswordReset  = "auth.password_reset"
+	AuditAuthPasswordChange = "auth.password_change"
+	AuditAuthEmailVerified  = "auth.email_verified"
+	AuditAuthVerifyResent   = "auth.verification_resent"
+	AuditAccountUpdate      = "account.profile_update"
+	AuditAPIKeyCreate       = "account.api_key_create"
+	AuditAPIKeyRevoke       = "account.api_key_revoke"
+
+	// スーパーユーザーが他人のデータ・管理機能を操作した場合はこの接頭辞をつける
+	AuditAdminPrefix      = "admin."
+	AuditAdminQuery       = "admin.audit_query"
+	AuditAdminSearchRetry = "admin.search_outbox_retry"
+	AuditAdminReindex     = "admin.search_reindex"
+)
+
+// RequestMeta: 監査ログに残すリクエスト元の情報 (ハンドラーで取り出してサービスに渡す)
+type RequestMeta struct {
+	IP        string
+	RequestID string
+}
+
+// audit_logs テーブルの形
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	ActorID    string                 `json:"actor_id"`
+	Action     string                 `json:"action"`
+	TargetURI  string                 `json:"target_uri"`
+	Before     map[string]interface{} `json:"before"`
+	After      map[string]interface{} `json:"after"`
+	IP         string                 `json:"ip"`
+	RequestID  string                 `json:"request_id"`
+}
+
+// 監査ログの検索条件
+type AuditFilter struct {
+	ActorID   string     `form:"actor_id"`
+	Action    string     `form:"action"` // 前方一致 (例: "auth." で認証系すべて)
+	TargetURI string     `form:"target_uri"`
+	From      *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To        *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit     int        `form:"limit"`
+	Offset    int        `form:"offset"`
+}
+
+// 監査ログの検索結果
+type AuditPage struct {
+	Total   int          `json:"total"`
+	Entries []AuditEntry `json:"entries"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// トークンの用途
+const (
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeEmailVerify   = "email_verify"
+)
+
+// auth_tokens テーブルの形 (生のトークンは保存せず、ハッシュだけ持つ)
+type AuthToken struct {
+	ID        string
+	UserID    string
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,29 @@
+package model
+
+// BaseURIs: RDF のリソースに使う URI の名前空間 (設定ファイルの uris セクション)
+// 例: Base=http://my-db.org/ なら 記録は http://my-db.org/occ/<uuid>、ユーザーは http://my-db.org/user/<uuid>
+type BaseURIs struct {
+	Base       string
+	Occurrence string
+	User       string
+}
+
+// OccurrenceURI: 記録のURI
+func (u BaseURIs) OccurrenceURI(id string) string {
+	return u.Occurrence + id
+}
+
+// UserURI: ユーザーのURI (dcterms:creator や監査ログの対象に使う)
+func (u BaseURIs) UserURI(id string) string {
+	return u.User + id
+}
+
+// ResourceURI: ユーザーが自由入力したラベルなどのリソース (例: <Base>user_taxon/xxx)
+func (u BaseURIs) ResourceURI(kind, name string) string {
+	return u.Base + kind + "/" + name
+}
+
+// OntologyGraph: 取り込んだオントロジーを入れる名前付きグラフ (例: <Base>ontology/ncbitaxon)
+func (u BaseURIs) OntologyGraph(name string) string {
+	return u.Base + "ontology/" + name
+}
@@ -0,0 +1,93 @@
+package model
+
+// 形質行列の書き出し形式
+const (
+	MatrixFormatCSV   = "csv"
+	MatrixFormatNEXUS = "nexus"
+	MatrixFormatTNT   = "tnt"
+)
+
+// 形質行列でまとめられる階級 (TraitMatrixFilter.Rank の binding と揃える)
+var MatrixRanks = []string{"kingdom", "phylum", "class", "order", "family", "genus", "species"}
+
+// TraitMatrixFilter: GET /api/export/matrix の条件
+type TraitMatrixFilter struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv nexus tnt"`
+	// 分類群をこの階級の祖先にまとめる (空ならまとめずに記録の分類群のまま)
+	Rank string `form:"rank" binding:"omitempty,oneof=kingdom phylum class order family genus species"`
+	// この分類群と子孫の記録だけ (ID でも学名でもよい)
+	Taxon string `form:"taxon"`
+	// 形質にする述語 (省くと記録にあるすべての述語)
+	Predicates []string `form:"predicate" collection_format:"csv"`
+}
+
+// TaxonTraitState: 分類群ごと・述語と値ごとの記録の数 (形質行列の元)
+type TaxonTraitState struct {
+	TaxonID        string
+	TaxonLabel     string
+	PredicateID    string
+	PredicateLabel string
+	ValueID        string
+	ValueLabel     string
+	Count          int
+}
+
+// TraitMatrix: 分類群 × 形質の行列
+// 述語が形質、値が状態になる。同じ分類群の記録で値が分かれていれば多型として全部持つ
+type TraitMatrix struct {
+	Rank       string
+	Taxa       []MatrixTaxon
+	Characters []MatrixCharacter
+	// Cells[分類群][形質] = 状態の番号 (Characters[i].States の添字)。空なら不明
+	Cells [][][]int
+	// Rank の祖先が見つからず、行列に入れられなかった分類群
+	Unplaced []string
+}
+
+type MatrixTaxon struct {
+	ID    string
+	Label string
+}
+
+type MatrixCharacter struct {
+	ID     string // 述語のID
+	Label  string
+	States []MatrixState
+}
+
+type MatrixState struct {
+	ID    string // 値のID
+	Label string
+}
+
+// 系統樹の書き出し形式
+const (
+	TreeFormatNewick   = "newick"
+	TreeFormatPhyloXML = "phyloxml"
+)
+
+// TaxonTreeFilter: GET /api/export/tree の条件
+type TaxonTreeFilter struct {
+	Format string `form:"format" binding:"omitempty,oneof=newick phyloxml"`
+	// この分類群と子孫の記録だけ (ID でも学名でもよい)
+	Taxon string `form:"taxon"`
+	// この人の記録だけ
+	Owner string `form:"owner"`
+}
+
+// TaxonTree: 記録のある分類群を ncbitaxon の上下関係でつないだ木
+// 子が1つだけで自分の記録も無い節は、子とまとめて省いてある
+type TaxonTree struct {
+	Root *TaxonTreeNode // 記録が無ければ nil
+	// ncbitaxon に無くて木に置けなかった分類群
+	Unplaced []string
+}
+
+type TaxonTreeNode struct {
+	ID       string
+	Label    string
+	Rank     string
+	Direct   int // この分類群そのものの記録の数
+	Total    int // 子孫も含めた記録の数
+	Children []*TaxonTreeNode
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// user_identities テーブルの形 (外部IdPのアカウントとの紐付け)
+type UserIdentity struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	ORCID     string    `json:"orcid"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDC の認可リクエスト中に保持しておく値
+type OIDCLoginState struct {
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
@@ -31,6 +31,7 @@ type OccurrenceListItem struct {
 
 type OccurrenceDetail struct {
 	ID        string  `json:"id"`
+	TaxonID   string  `json:"taxon_id"`
 	TaxonName string  `json:"taxon_label"`
 	Remarks   string  `json:"remarks"`
 	Traits    []Trait `json:"traits"`
@@ -39,8 +40,93 @@ type OccurrenceDetail struct {
 	CreatedAt string `json:"created_at"`
 }
 
-type TaxonStats struct {
-	TaxonID    string   `json:"taxon_id"`
-	TotalCount string   `json:"total_count"`
-	Traits     []string `json:"traits"`
+// OccurrenceVisibility: 記録を見せてよいかの判定に使う情報
+type OccurrenceVisibility struct {
+	OwnerID string
+	Public  bool
+}
+
+// OccurrenceRecord: 記録1件分の中身と公開範囲 (検索インデックスの作り直しで使う)
+type OccurrenceRecord struct {
+	OccurrenceDetail
+	Public bool
+}
+
+// 一覧・検索の並び順 (先頭に - を付けると降順)
+const (
+	OccurrenceSortCreated = "created"
+	OccurrenceSortTaxon   = "taxon"
+	OccurrenceSortOwner   = "owner"
+)
+
+// SplitOccurrenceSort: "-created" → ("created", true)
+func SplitOccurrenceSort(sort string) (field string, desc bool) {
+	if len(sort) > 0 && sort[0] == '-' {
+		return sort[1:], true
+	}
+	return sort, false
+}
+
+// OccurrenceListFilter: GET /api/occurrences の条件
+type OccurrenceListFilter struct {
+	Limit  int    `form:"limit"`
+	Cursor string `form:"cursor"` // 前のページの next_cursor
+	Sort   string `form:"sort" binding:"omitempty,oneof=created -created taxon -taxon owner -owner"`
+}
+
+// OccurrenceCursor: 一覧のページの区切り (前のページの最後の行の並び替えキーとID)
+type OccurrenceCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"id"`
+}
+
+// OccurrenceListPage: 一覧の1ページ分 (Total は絞り込みに合う全件数)
+type OccurrenceListPage struct {
+	Total      int                  `json:"total"`
+	Items      []OccurrenceListItem `json:"items"`
+	Next       *OccurrenceCursor    `json:"-"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// 検索の絞り込み欄 (facets=) に指定できる項目
+// 階級 (model.FacetRanks) のほかに、分類群・形質・持ち主・公開範囲で数えられる
+const (
+	SearchFacetTaxon      = "taxon"
+	SearchFacetTrait      = "trait"
+	SearchFacetOwner      = "owner"
+	SearchFacetVisibility = "visibility"
+)
+
+// OccurrenceSearchFilter: GET /api/search の条件 (sort を省くとキーワードの関連度順)
+type OccurrenceSearchFilter struct {
+	Query  string   `form:"q"`
+	Taxon  string   `form:"taxon"`
+	Limit  int      `form:"limit"`
+	Offset int      `form:"offset"`
+	Sort   string   `form:"sort" binding:"omitempty,oneof=created -created taxon -taxon owner -owner"`
+	Facets []string `form:"facets" collection_format:"csv" binding:"dive,omitempty,oneof=taxon trait owner visibility kingdom phylum class order family genus"`
+
+	// trait=RO:0000053:PATO:0000014 (述語:値) か trait=PATO:0000014 (値だけ)
+	// 複数の trait= は AND、1つの中の | は OR、先頭の ! は NOT (どれにも当てはまらない)
+	Traits []string `form:"trait"`
+}
+
+// TraitClause: 形質の条件1つ (trait= 1個分)。Terms のどれかに当てはまる記録 (Negate なら、どれにも当てはまらない記録)
+type TraitClause struct {
+	Negate bool
+	Terms  []TraitTerm
+}
+
+// TraitTerm: 述語 (空なら問わない) と値
+// 値は下位クラスまで広げて ValueIDs に入れる ("色" で探すと "赤" も当たる)
+type TraitTerm struct {
+	PredicateID string
+	ValueID     string
+	ValueIDs    []string
+}
+
+// TraitKey: 検索インデックスで述語と値の組を表す文字列
+func TraitKey(predicateID, valueID string) string {
+	return predicateID + "=" + valueID
 }
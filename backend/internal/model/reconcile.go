@@ -0,0 +1,84 @@
+package model
+
+// 学名の照合 (古い表計算ファイルの学名を NCBITaxon の ID に結びつける)
+
+// 照合の種類 (上ほど確か)
+const (
+	NameMatchExact   = "exact"   // rdfs:label と同じ
+	NameMatchSynonym = "synonym" // skos:altLabel と同じ
+	NameMatchFuzzy   = "fuzzy"   // classification インデックスのあいまい検索
+)
+
+const (
+	NameMatchMaxNames     = 200 // 1回で照合できる学名の数
+	NameMatchDefaultLimit = 5   // 1つの学名に返す候補の数
+	NameMatchMaxLimit     = 20
+)
+
+// NameMatchRequest: POST /api/taxa/match
+type NameMatchRequest struct {
+	Names []string `json:"names" binding:"required,min=1,max=200,dive,max=500"`
+	Limit int      `json:"limit" binding:"omitempty,min=1,max=20"`
+}
+
+// NameMatchResult: 学名1つ分の結果 (候補はスコアの高い順)
+type NameMatchResult struct {
+	Query      string          `json:"query"`
+	Normalized string          `json:"normalized"` // 著者名などを外してそろえた学名 (これで照合する)
+	Candidates []NameCandidate `json:"candidates"`
+}
+
+// NameCandidate: 照合の候補
+type NameCandidate struct {
+	ID          string  `json:"id"` // ncbi:9606 の形
+	Label       string  `json:"label"`
+	MatchedName string  `json:"matched_name"` // 当たった名前 (別名で当たったときは別名)
+	MatchType   string  `json:"match_type"`   // NameMatch*
+	Score       float64 `json:"score"`        // 0〜1
+}
+
+// TaxonNameHit: 名前がそのまま一致した分類群 (repository が返す)
+type TaxonNameHit struct {
+	Name    string // 当たった名前
+	TaxonID string
+	Label   string // rdfs:label
+	Synonym bool   // skos:altLabel で当たった
+}
+
+// ClassificationHit: classification インデックスのあいまい検索の結果1件
+type ClassificationHit struct {
+	TaxonID  string // ncbi:9606 の形
+	Label    string
+	Synonyms []string
+	Ranking  float64 // Meilisearch の _rankingScore (0〜1)
+}
+
+// 以下は OpenRefine の Reconciliation Service API (0.2) の形
+// https://www.w3.org/community/reports/reconciliation/CG-FINAL-specs-0.2-20230410/
+
+// ReconcileType: 照合する対象の型 (ここでは分類群だけ)
+type ReconcileType struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ReconcileQuery: queries={"q0": {...}, ...} の1つ分 (type・properties は見ない)
+type ReconcileQuery struct {
+	Query string `json:"query"`
+	Type  string `json:"type,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// ReconcileCandidate: 候補1件。id は NCBITaxon の番号だけ (identifierSpace に続けると IRI になる)
+type ReconcileCandidate struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Type  []ReconcileType `json:"type"`
+	Score float64         `json:"score"` // 0〜100
+	Match bool            `json:"match"` // 確かなので自動で結びつけてよい
+}
+
+// ReconcileResult: 1つの query への答え
+type ReconcileResult struct {
+	Result []ReconcileCandidate `json:"result"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// ReindexReport: 検索インデックスの作り直しの進み具合と結果
+// Missing / Stale は作り直す前のインデックスと Fuseki を比べたずれ (同期の取りこぼしの目安)
+type ReindexReport struct {
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	Indexed  int `json:"indexed"`  // Fuseki から読んで新しいインデックスに入れた件数
+	Previous int `json:"previous"` // 作り直す前のインデックスの件数
+
+	Missing       int      `json:"missing"` // Fuseki にあるのに古いインデックスに無かった
+	MissingSample []string `json:"missing_sample"`
+	Stale         int      `json:"stale"` // 古いインデックスにあるのに Fuseki に無かった
+	StaleSample   []string `json:"stale_sample"`
+
+	UnresolvedOwners []string `json:"unresolved_owners"` // Postgres にいない持ち主 (名前なしで入れた)
+
+	Error string `json:"error,omitempty"`
+}
+
+// LineageReport: 分類を読み込み直したあとの系統の付け直しの結果
+type LineageReport struct {
+	Version   string `json:"version"`   // 付け直しに使った分類の版 (ncbitaxon グラフを読み込んだ日時)
+	Taxa      int    `json:"taxa"`      // 系統を引き直した分類群の数
+	Documents int    `json:"documents"` // 書き換えた記録の数
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// search_outbox の操作 (記録の変更のきっかけ)
+const (
+	SearchOpIndex  = "index"
+	SearchOpDelete = "delete"
+)
+
+// search_outbox の状態 (反映できた行は消すので done は無い)
+const (
+	SearchOutboxPending = "pending"
+	SearchOutboxFailed  = "failed"
+)
+
+// SearchOutboxEntry: Meilisearch にまだ反映していない変更
+type SearchOutboxEntry struct {
+	ID            int64     `json:"id"`
+	Operation     string    `json:"operation"`
+	OccurrenceURI string    `json:"occurrence_uri"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// SearchOutboxPage: 管理画面用の一覧 (件数は状態ごとの総数)
+type SearchOutboxPage struct {
+	Pending int                 `json:"pending"`
+	Failed  int                 `json:"failed"`
+	Entries []SearchOutboxEntry `json:"entries"`
+}
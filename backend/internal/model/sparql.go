@@ -0,0 +1,7 @@
+package model
+
+// SPARQLResult: 公開 SPARQL エンドポイントの結果 (Fuseki の返した形式のまま返す)
+type SPARQLResult struct {
+	ContentType string
+	Body        []byte
+}
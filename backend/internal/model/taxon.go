@@ -0,0 +1,67 @@
+package model
+
+// 検索の絞り込み欄に出す上位の階級 (NCBITaxon の has_rank の値、上から順)
+var FacetRanks = []string{"kingdom", "phylum", "class", "order", "family", "genus"}
+
+// TaxonAncestor: 分類群の系統 (祖先) の1段
+type TaxonAncestor struct {
+	ID    string `json:"id"` // ncbi:9606 の形
+	Label string `json:"label"`
+	Rank  string `json:"rank,omitempty"` // "family" など (no rank / clade は空)
+}
+
+// Taxon: ncbitaxon のグラフにある分類群の情報
+type Taxon struct {
+	ID       string
+	Label    string
+	Rank     string
+	Synonyms []string // skos:altLabel
+}
+
+// TaxonOccurrenceSummary: 分類群 (子孫も含む) の記録のまとめ
+type TaxonOccurrenceSummary struct {
+	Count int
+	First string // いちばん古い記録の日時 (dcterms:created)
+	Last  string
+	Name  string // 記録に書かれた学名 (ncbitaxon に無い分類群の名前の代わり)
+}
+
+// TaxonProfile: GET /api/taxa/:id
+// 記録の数・日付・形質は、見てよい記録 (公開のものと自分のもの) だけで数える
+type TaxonProfile struct {
+	ID       string          `json:"id"`
+	Label    string          `json:"label"`
+	Synonyms []string        `json:"synonyms"`
+	Rank     string          `json:"rank,omitempty"`
+	Lineage  []TaxonAncestor `json:"lineage"`  // 根から親まで (自分は含まない)
+	Children []TaxonChild    `json:"children"` // 記録のある直下の分類群 (記録の多い順)
+
+	OccurrenceCount int              `json:"occurrence_count"` // 子孫の記録も含む
+	FirstObserved   string           `json:"first_observed,omitempty"`
+	LastObserved    string           `json:"last_observed,omitempty"`
+	Traits          []TraitFrequency `json:"traits"`
+
+	// ログインしているときだけ、自分の記録 (子孫も含む、新しい順)
+	MyOccurrences []OccurrenceListItem `json:"my_occurrences,omitempty"`
+}
+
+// TaxonChild: 直下の分類群と、その子孫まで含めた記録の数
+type TaxonChild struct {
+	ID              string `json:"id"`
+	Label           string `json:"label"`
+	Rank            string `json:"rank,omitempty"`
+	OccurrenceCount int    `json:"occurrence_count"`
+}
+
+// TraitFrequency: 述語ごとの、値ごとの記録の数 (多い順)
+type TraitFrequency struct {
+	PredicateID    string            `json:"predicate_id"`
+	PredicateLabel string            `json:"predicate_label"`
+	Values         []TraitValueCount `json:"values"`
+}
+
+type TraitValueCount struct {
+	ValueID    string `json:"value_id"`
+	ValueLabel string `json:"value_label"`
+	Count      int    `json:"count"`
+}
@@ -4,19 +4,28 @@ import "time"
 
 // データベースのユーザーテーブルの形
 type User struct {
-	ID           string    `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // JSONには含めない（隠す）
-	IsSuperuser  bool      `json:is_superuser`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	PasswordHash  string    `json:"-"` // JSONには含めない（隠す）
+	IsSuperuser   bool      `json:"is_superuser"`
+	EmailVerified bool      `json:"email_verified"` // メールアドレス確認済みか
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// プロフィール・設定
+	DisplayName       string `json:"display_name"`
+	Affiliation       string `json:"affiliation"`
+	ORCID             string `json:"orcid"`
+	DefaultLicense    string `json:"default_license"`
+	DefaultVisibility string `json:"default_visibility"` // private, public
+	PreferredLanguage string `json:"preferred_language"` // ja, en
 }
 
 // フロントから送られてくる登録リクエストの形
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required,email"` // メアド形式チェックもつける
+	Email    string `json:"email" binding:"required,email"`    // メアド形式チェックもつける
 	Password string `json:"password" binding:"required,min=8"` // 8文字以上必須
 }
 
@@ -25,3 +34,48 @@ type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
 }
+
+// パスワードリセットのメール送信リクエスト
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// パスワード再設定リクエスト (メールで届いたトークンと新しいパスワード)
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// メールアドレス確認リクエスト
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// プロフィール更新リクエスト (省略した項目は変更しない)
+type UpdateProfileRequest struct {
+	Username          *string `json:"username" binding:"omitempty,min=1,max=255"`
+	DisplayName       *string `json:"display_name" binding:"omitempty,max=255"`
+	Affiliation       *string `json:"affiliation" binding:"omitempty,max=255"`
+	ORCID             *string `json:"orcid"`
+	DefaultLicense    *string `json:"default_license" binding:"omitempty,oneof=CC0-1.0 CC-BY-4.0 CC-BY-SA-4.0 CC-BY-NC-4.0 CC-BY-NC-SA-4.0"`
+	DefaultVisibility *string `json:"default_visibility" binding:"omitempty,oneof=private public"`
+	PreferredLanguage *string `json:"preferred_language" binding:"omitempty,oneof=ja en"`
+}
+
+// パスワード変更リクエスト (現在のパスワードで本人確認する)
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// 公開プロフィール (メールアドレスなどは含めない)
+type PublicProfile struct {
+	ID                    string               `json:"id"`
+	Username              string               `json:"username"`
+	DisplayName           string               `json:"display_name"`
+	Affiliation           string               `json:"affiliation"`
+	ORCID                 string               `json:"orcid"`
+	PublicOccurrenceCount int                  `json:"public_occurrence_count"`
+	RecentOccurrences     []OccurrenceListItem `json:"recent_occurrences"`
+	CreatedAt             time.Time            `json:"created_at"`
+}
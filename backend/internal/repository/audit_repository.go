@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type AuditRepository interface {
+	Insert(ctx context.Context, entry *model.AuditEntry) error
+	Query(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, int, error)
+}
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Insert(ctx context.Context, entry *model.AuditEntry) error {
+	before, err := marshalSummary(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalSummary(entry.After)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_logs (actor_id, action, target_uri, before_summary, after_summary, ip, request_id)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, $6, $7)
+		RETURNING id, occurred_at
+	`
+	err = r.db.QueryRowContext(ctx, query, entry.ActorID, entry.Action, entry.TargetURI, before, after, entry.IP, entry.RequestID).
+		Scan(&entry.ID, &entry.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("insert audit log failed: %w", err)
+	}
+	return nil
+}
+
+// Query: 条件に合う監査ログを新しい順に返す (件数は limit/offset を無視した総数)
+func (r *auditRepository) Query(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, int, error) {
+	var conds []string
+	var args []interface{}
+	addCond := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.ActorID != "" {
+		addCond("actor_id = $%d::uuid", filter.ActorID)
+	}
+	if filter.Action != "" {
+		// LIKE の特殊文字はエスケープしてから前方一致にする
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.Action)
+		addCond("action LIKE $%d", escaped+"%")
+	}
+	if filter.TargetURI != "" {
+		addCond("target_uri = $%d", filter.TargetURI)
+	}
+	if filter.From != nil {
+		addCond("occurred_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		addCond("occurred_at < $%d", *filter.To)
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_logs "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`
+		SELECT id, occurred_at, COALESCE(actor_id::text, ''), action, target_uri, before_summary, after_summary, ip, request_id
+		FROM audit_logs
+		%s
+		ORDER BY occurred_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		var e model.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.OccurredAt, &e.ActorID, &e.Action, &e.TargetURI, &before, &after, &e.IP, &e.RequestID); err != nil {
+			return nil, 0, err
+		}
+		if len(before) > 0 {
+			json.Unmarshal(before, &e.Before)
+		}
+		if len(after) > 0 {
+			json.Unmarshal(after, &e.After)
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// marshalSummary: nil なら SQL の NULL にする
+func marshalSummary(summary map[string]interface{}) (interface{}, error) {
+	if summary == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return nil, fmt.Errorf("marshal audit summary failed: %w", err)
+	}
+	return string(b), nil
+}
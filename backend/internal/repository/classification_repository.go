@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/metrics"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ClassificationRepository: cmd/indexer が作る classification インデックス (ncbitaxon の名前と別名) を引く
+// インデックスの設定は cmd/indexer がするので、ここでは読むだけなのだ
+type ClassificationRepository interface {
+	// SearchTaxa: 名前ごとにあいまい検索した結果を、queries と同じ順で返す (空の名前は結果も空)
+	SearchTaxa(ctx context.Context, queries []string, limit int) ([][]model.ClassificationHit, error)
+}
+
+// classification インデックスのドキュメント (cmd/indexer の TermDoc のうち使うものだけ)
+type classificationDocument struct {
+	ID           string   `json:"id"` // "NCBITaxon_9606"
+	Label        string   `json:"label"`
+	Synonyms     []string `json:"synonyms"`
+	RankingScore float64  `json:"_rankingScore"`
+}
+
+type classificationRepository struct {
+	client    meilisearch.ServiceManager
+	indexName string
+}
+
+func NewClassificationRepository(url, key string) ClassificationRepository {
+	client := meilisearch.New(url,
+		meilisearch.WithAPIKey(key),
+		meilisearch.WithCustomClient(&http.Client{Transport: tracing.Transport(nil)}),
+	)
+	return &classificationRepository{
+		client:    client,
+		indexName: "classification",
+	}
+}
+
+func (r *classificationRepository) SearchTaxa(ctx context.Context, queries []string, limit int) (hits [][]model.ClassificationHit, err error) {
+	ctx, span := tracing.StartClient(ctx, "meilisearch multi-search",
+		attribute.String("db.system.name", "meilisearch"),
+		attribute.String("db.operation.name", "multi-search"),
+		attribute.String("db.collection.name", r.indexName),
+		attribute.Int("meilisearch.queries", len(queries)),
+	)
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveSearch("multi-search", time.Now(), &err)
+
+	// 空の q は全件が返ってしまうので、名前のあるものだけまとめて投げる
+	hits = make([][]model.ClassificationHit, len(queries))
+	req := &meilisearch.MultiSearchRequest{}
+	var positions []int
+	for i, q := range queries {
+		if strings.TrimSpace(q) == "" {
+			continue
+		}
+		req.Queries = append(req.Queries, &meilisearch.SearchRequest{
+			IndexUID:             r.indexName,
+			Query:                q,
+			Limit:                int64(limit),
+			Filter:               "ontology = 'NCBITaxon'",
+			AttributesToRetrieve: []string{"id", "label", "synonyms"},
+			ShowRankingScore:     true,
+		})
+		positions = append(positions, i)
+	}
+	if len(req.Queries) == 0 {
+		return hits, nil
+	}
+
+	res, err := r.client.MultiSearchWithContext(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("meilisearch classification search failed: %w", err)
+	}
+	if len(res.Results) != len(positions) {
+		return nil, fmt.Errorf("meilisearch returned %d results for %d queries", len(res.Results), len(positions))
+	}
+
+	for n, result := range res.Results {
+		var docs []classificationDocument
+		if err := result.Hits.Decode(&docs); err != nil {
+			return nil, fmt.Errorf("meilisearch decode failed: %w", err)
+		}
+		list := make([]model.ClassificationHit, 0, len(docs))
+		for _, d := range docs {
+			list = append(list, model.ClassificationHit{
+				TaxonID:  "ncbi:" + strings.TrimPrefix(d.ID, "NCBITaxon_"),
+				Label:    d.Label,
+				Synonyms: d.Synonyms,
+				Ranking:  d.RankingScore,
+			})
+		}
+		hits[positions[n]] = list
+	}
+	return hits, nil
+}
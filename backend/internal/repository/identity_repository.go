@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type IdentityRepository interface {
+	FindByProviderSubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error)
+	Create(ctx context.Context, identity *model.UserIdentity) error
+	SaveLoginState(ctx context.Context, state *model.OIDCLoginState) error
+	ConsumeLoginState(ctx context.Context, state string) (*model.OIDCLoginState, error)
+}
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) FindByProviderSubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	identity := &model.UserIdentity{}
+
+	query := `
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), COALESCE(orcid, ''), created_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.ORCID, &identity.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (r *identityRepository) Create(ctx context.Context, identity *model.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, orcid)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))
+		RETURNING id, created_at
+	`
+	err := r.db.QueryRowContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.ORCID).
+		Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create identity failed: %w", err)
+	}
+	return nil
+}
+
+func (r *identityRepository) SaveLoginState(ctx context.Context, state *model.OIDCLoginState) error {
+	// ついでに期限切れのものを掃除しておく
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := r.db.ExecContext(ctx, query, state.State, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt); err != nil {
+		return fmt.Errorf("save login state failed: %w", err)
+	}
+	return nil
+}
+
+// ConsumeLoginState: state を取り出して削除する (1回しか使えない)
+func (r *identityRepository) ConsumeLoginState(ctx context.Context, state string) (*model.OIDCLoginState, error) {
+	s := &model.OIDCLoginState{}
+
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state = $1 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING state, provider, nonce, code_verifier, expires_at
+	`
+	err := r.db.QueryRowContext(ctx, query, state).Scan(&s.State, &s.Provider, &s.Nonce, &s.CodeVerifier, &s.ExpiresAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -1,29 +1,62 @@
 package repository
 
 import (
+	"github.com/saku-730/bio-occurrence/backend/internal/logging"
+	"github.com/saku-730/bio-occurrence/backend/internal/metrics"
 	"github.com/saku-730/bio-occurrence/backend/internal/model"
-	"bytes"
+	"github.com/saku-730/bio-occurrence/backend/internal/sparql"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
-	"text/template"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type OccurrenceRepository interface {
-	Create(uri string, userID string, req model.OccurrenceRequest) error
-	FindAll(currentUserID string) ([]model.OccurrenceListItem, error)
-	FindByID(uri string) (*model.OccurrenceDetail, error)
-	Update(uri string, userID string, req model.OccurrenceRequest) error
-	Delete(uri string) error
-	GetTaxonStats(taxonURI string, rawID string) (*model.TaxonStats, error)
-	GetDescendantIDs(label string) ([]string, error)
-	GetTaxonIDByLabel(label string) (string, error)
+	Create(ctx context.Context, uri string, userID string, req model.OccurrenceRequest) error
+	// FindAll: ownerNames (持ち主ID → 名前) は sort が owner のときだけ使う
+	FindAll(ctx context.Context, currentUserID string, sort string, after *model.OccurrenceCursor, limit int, ownerNames map[string]string) (*model.OccurrenceListPage, error)
+	// FindOwnerIDs: 見てよい記録の持ち主の ID (重複なし)
+	FindOwnerIDs(ctx context.Context, currentUserID string) ([]string, error)
+	FindByID(ctx context.Context, uri string) (*model.OccurrenceDetail, error)
+	FindVisibility(ctx context.Context, uri string) (*model.OccurrenceVisibility, error)
+	FindPage(ctx context.Context, after string, limit int) ([]model.OccurrenceRecord, error)
+	Describe(ctx context.Context, uri string, accept string) (*model.SPARQLResult, error)
+	Update(ctx context.Context, uri string, userID string, req model.OccurrenceRequest) error
+	Delete(ctx context.Context, uri string) error
+	GetTaxonIDByLabel(ctx context.Context, label string) (string, error)
+	FindTaxaByNames(ctx context.Context, names []string) ([]model.TaxonNameHit, error)
+	GetTaxonLineage(ctx context.Context, taxonID string) ([]model.TaxonAncestor, error)
+	GetTaxonomyVersion(ctx context.Context) (string, error)
+	FindTaxonIDs(ctx context.Context) ([]string, error)
+	GetTraitValueDescendantIDs(ctx context.Context, valueID string) ([]string, error)
+
+	// 分類群のページ用 (記録は子孫の分類群のものも含める)
+	GetTaxon(ctx context.Context, taxonID string) (*model.Taxon, error)
+	SummarizeTaxonOccurrences(ctx context.Context, taxonID string, currentUserID string) (*model.TaxonOccurrenceSummary, error)
+	CountTaxonChildren(ctx context.Context, taxonID string, currentUserID string) ([]model.TaxonChild, error)
+	CountTaxonTraits(ctx context.Context, taxonID string, currentUserID string) ([]model.TraitFrequency, error)
+	FindByTaxonAndOwner(ctx context.Context, taxonID string, ownerID string, limit int) ([]model.OccurrenceListItem, error)
+
+	// 書き出し用
+	FindTaxonTraitStates(ctx context.Context, taxonID string, currentUserID string) ([]model.TaxonTraitState, error)
+	CountOccurrencesByTaxon(ctx context.Context, taxonID string, ownerID string, currentUserID string) (map[string]int, error)
+	FindPublicByOwner(ctx context.Context, ownerID string, limit int) ([]model.OccurrenceListItem, error)
+	CountPublicByOwner(ctx context.Context, ownerID string) (int, error)
 }
 
 type occurrenceRepository struct {
@@ -31,104 +64,312 @@ type occurrenceRepository struct {
 	queryURL  string
 	username  string
 	password  string
+	uris      model.BaseURIs
+	slowQuery time.Duration // これより遅いクエリは warn でログに残す (0なら無効)
 	client    *http.Client
 }
 
-func NewOccurrenceRepository(baseURL, user, pass string) OccurrenceRepository {
+func NewOccurrenceRepository(baseURL, user, pass string, uris model.BaseURIs, slowQuery time.Duration) OccurrenceRepository {
 	return &occurrenceRepository{
 		updateURL: baseURL + "/update",
 		queryURL:  baseURL + "/query",
 		username:  user,
 		password:  pass,
-		client:    &http.Client{Timeout: 60 * time.Second},
+		uris:      uris,
+		slowQuery: slowQuery,
+		client:    &http.Client{Timeout: 60 * time.Second, Transport: tracing.Transport(nil)},
 	}
 }
 
-func (r *occurrenceRepository) Create(uri string, userID string, req model.OccurrenceRequest) error {
-	sparql, err := r.buildInsertSPARQL(uri, userID, req)
+// 記録の保存に使う語彙
+var (
+	iriType              = sparql.MustIRI("http://www.w3.org/1999/02/22-rdf-syntax-ns#type")
+	iriLabel             = sparql.MustIRI("http://www.w3.org/2000/01/rdf-schema#label")
+	iriOccurrence        = sparql.MustIRI("http://rs.tdwg.org/dwc/terms/Occurrence")
+	iriScientificNameID  = sparql.MustIRI("http://rs.tdwg.org/dwc/terms/scientificNameID")
+	iriScientificName    = sparql.MustIRI("http://rs.tdwg.org/dwc/terms/scientificName")
+	iriOccurrenceRemarks = sparql.MustIRI("http://rs.tdwg.org/dwc/terms/occurrenceRemarks")
+	iriCreator           = sparql.MustIRI("http://purl.org/dc/terms/creator")
+	iriCreated           = sparql.MustIRI("http://purl.org/dc/terms/created")
+	iriVisibility        = sparql.MustIRI("http://my-db.org/data/visibility")
+)
+
+func (r *occurrenceRepository) Create(ctx context.Context, uri string, userID string, req model.OccurrenceRequest) error {
+	query, err := r.buildInsertSPARQL(uri, userID, req)
 	if err != nil {
 		return err
 	}
-	return r.sendUpdate(sparql)
+	return r.sendUpdate(ctx, query)
+}
+
+// 一覧の並び替えキー (未設定の値は空文字にしてカーソルで比べられるようにする)
+// 持ち主の名前は Postgres にあるので、?ownerName はクエリの中で VALUES にして渡す (ownerNameValues)
+var listSortKeys = map[string]string{
+	model.OccurrenceSortCreated: `COALESCE(STR(?created), "")`,
+	model.OccurrenceSortTaxon:   `STR(?taxonName)`,
+	model.OccurrenceSortOwner:   `COALESCE(STR(?ownerName), "")`,
+}
+
+// FindAll: 見てよい記録を sort の順に limit 件 (after があればその続きから)
+// 同じキーの行は URI で並べるので、ページの境目で抜けたり重なったりしないのだ
+func (r *occurrenceRepository) FindAll(ctx context.Context, currentUserID string, sort string, after *model.OccurrenceCursor, limit int, ownerNames map[string]string) (*model.OccurrenceListPage, error) {
+	filter, err := r.visibleFilter(currentUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	field, desc := model.SplitOccurrenceSort(sort)
+	sortKey, ok := listSortKeys[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort: %s", sort)
+	}
+	order, cmp := "ASC", ">"
+	if desc {
+		order, cmp = "DESC", "<"
+	}
+	cursor := ""
+	if after != nil {
+		cursor = sparql.Format("FILTER (?sortKey "+cmp+" %s || (?sortKey = %s && STR(?id) "+cmp+" %s))",
+			sparql.String(after.Key), sparql.String(after.Key), sparql.String(after.ID))
+	}
+	owners := ""
+	if field == model.OccurrenceSortOwner {
+		owners = r.ownerNameValues(ownerNames)
+	}
+
+	// filter・sortKey・cursor は上で組み立てた式なので、ここだけは文字列のまま埋め込む
+	// 件数はカーソルを外した同じ条件で数える
+	build := func(selectClause, cursor string) string {
+		return `
+			PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
+			PREFIX dcterms: <http://purl.org/dc/terms/>
+			PREFIX ex: <http://my-db.org/data/>
+
+			` + selectClause + `
+			WHERE {
+				?id a dwc:Occurrence ;
+					dwc:scientificName ?taxonName .
+				OPTIONAL { ?id dwc:occurrenceRemarks ?remarks }
+				OPTIONAL { ?id dcterms:creator ?creator ` + owners + ` }
+				OPTIONAL { ?id ex:visibility ?vis }
+				OPTIONAL { ?id dcterms:created ?created }
+
+				FILTER (` + filter + `)
+				BIND (` + sortKey + ` AS ?sortKey)
+				` + cursor + `
+			}
+		`
+	}
+
+	// 次のページがあるか分かるように1件多く取る
+	query := build("SELECT ?id ?taxonName ?remarks ?creator ?created ?sortKey", cursor) +
+		fmt.Sprintf("ORDER BY %[1]s(?sortKey) %[1]s(STR(?id))\nLIMIT %[2]d\n", order, limit+1)
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.OccurrenceListPage{Items: []model.OccurrenceListItem{}}
+	for i, b := range results {
+		if i == limit {
+			last := results[limit-1]
+			page.Next = &model.OccurrenceCursor{Sort: sort, Key: last["sortKey"].Value, ID: last["id"].Value}
+			break
+		}
+		page.Items = append(page.Items, toListItem(b))
+	}
+
+	countRows, err := r.sendQuery(ctx, build("SELECT (COUNT(DISTINCT ?id) AS ?total)", ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(countRows) > 0 {
+		page.Total, _ = strconv.Atoi(countRows[0]["total"].Value)
+	}
+	return page, nil
+}
+
+// ownerNameValues: ?creator に持ち主の名前 ?ownerName を付ける OPTIONAL (名前が分からない人は付かない)
+// ?creator が決まった後で結びつけるように、creator の OPTIONAL の中に入れて使う
+func (r *occurrenceRepository) ownerNameValues(ownerNames map[string]string) string {
+	ids := make([]string, 0, len(ownerNames))
+	for id := range ownerNames {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var rows strings.Builder
+	for _, id := range ids {
+		creator, err := sparql.NewIRI(r.uris.UserURI(id))
+		if err != nil {
+			continue
+		}
+		rows.WriteString(sparql.Format("(%s %s) ", creator, sparql.String(ownerNames[id])))
+	}
+	if rows.Len() == 0 {
+		return ""
+	}
+	return "OPTIONAL { VALUES (?creator ?ownerName) { " + rows.String() + "} }"
+}
+
+func (r *occurrenceRepository) FindOwnerIDs(ctx context.Context, currentUserID string) ([]string, error) {
+	filter, err := r.visibleFilter(currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	// filter は visibleFilter で組み立てた式なので、そのまま埋め込む
+	query := `
+		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
+		PREFIX dcterms: <http://purl.org/dc/terms/>
+		PREFIX ex: <http://my-db.org/data/>
+
+		SELECT DISTINCT ?creator
+		WHERE {
+			?id a dwc:Occurrence ;
+				dcterms:creator ?creator .
+			OPTIONAL { ?id ex:visibility ?vis }
+			FILTER (` + filter + `)
+		}
+	`
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(results))
+	for _, b := range results {
+		if id := toListItem(b).OwnerID; id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
 }
 
-func (r *occurrenceRepository) FindAll(currentUserID string) ([]model.OccurrenceListItem, error) {
+// visibleFilter: 見てよい記録 (公開のものか、自分のもの) だけを残す FILTER の式 (?vis と ?creator を使う)
+// visibility が無い古いデータは公開扱い
+func (r *occurrenceRepository) visibleFilter(currentUserID string) (string, error) {
 	filter := "(!BOUND(?vis) || ?vis = \"public\")"
 	if currentUserID != "" {
-		filter += fmt.Sprintf(" || (BOUND(?creator) && str(?creator) = \"http://my-db.org/user/%s\")", currentUserID)
+		owner, err := r.ownerFilter(currentUserID)
+		if err != nil {
+			return "", err
+		}
+		filter += " || " + owner
+	}
+	return filter, nil
+}
+
+// ownerFilter: その人の記録だけを残す FILTER の式
+func (r *occurrenceRepository) ownerFilter(userID string) (string, error) {
+	creator, err := sparql.NewIRI(r.uris.UserURI(userID))
+	if err != nil {
+		return "", err
+	}
+	return sparql.Format("(BOUND(?creator) && ?creator = %s)", creator), nil
+}
+
+// FindPublicByOwner: 指定ユーザーの公開データを新しい順に取得 (公開プロフィール用)
+func (r *occurrenceRepository) FindPublicByOwner(ctx context.Context, ownerID string, limit int) ([]model.OccurrenceListItem, error) {
+	creator, err := sparql.NewIRI(r.uris.UserURI(ownerID))
+	if err != nil {
+		return nil, err
 	}
 
-	query := fmt.Sprintf(`
+	query := sparql.Format(`
 		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
 		PREFIX dcterms: <http://purl.org/dc/terms/>
 		PREFIX ex: <http://my-db.org/data/>
-		
+
 		SELECT ?id ?taxonName ?remarks ?creator ?created
 		WHERE {
+			BIND(%s AS ?creator)
 			?id a dwc:Occurrence ;
-				dwc:scientificName ?taxonName .
+				dwc:scientificName ?taxonName ;
+				dcterms:creator ?creator .
 			OPTIONAL { ?id dwc:occurrenceRemarks ?remarks }
-			OPTIONAL { ?id dcterms:creator ?creator }
 			OPTIONAL { ?id ex:visibility ?vis }
 			OPTIONAL { ?id dcterms:created ?created }
 
-			FILTER (%s)
+			FILTER (!BOUND(?vis) || ?vis = "public")
 		}
 		ORDER BY DESC(?created)
-		LIMIT 100
-	`, filter)
-	
-	results, err := r.sendQuery(query)
+		LIMIT %s
+	`, creator, sparql.Integer(limit))
+
+	results, err := r.sendQuery(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 
-	var list []model.OccurrenceListItem
+	list := []model.OccurrenceListItem{}
 	for _, b := range results {
-		creatorURI := safeValue(b, "creator")
-		ownerID := ""
-		if creatorURI != "" {
-			parts := strings.Split(creatorURI, "/")
-			ownerID = parts[len(parts)-1]
-		}
-
-		list = append(list, model.OccurrenceListItem{
-			ID:        b["id"].Value,
-			TaxonName: b["taxonName"].Value,
-			Remarks:   safeValue(b, "remarks"),
-			OwnerID:   ownerID,
-			OwnerName: "",
-			CreatedAt: safeValue(b, "created"),
-		})
+		list = append(list, toListItem(b))
 	}
 	return list, nil
 }
 
-func (r *occurrenceRepository) FindByID(uri string) (*model.OccurrenceDetail, error) {
-	query := fmt.Sprintf(`
+// CountPublicByOwner: 指定ユーザーの公開データの件数
+func (r *occurrenceRepository) CountPublicByOwner(ctx context.Context, ownerID string) (int, error) {
+	creator, err := sparql.NewIRI(r.uris.UserURI(ownerID))
+	if err != nil {
+		return 0, err
+	}
+
+	query := sparql.Format(`
+		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
+		PREFIX dcterms: <http://purl.org/dc/terms/>
+		PREFIX ex: <http://my-db.org/data/>
+
+		SELECT (COUNT(DISTINCT ?id) AS ?count)
+		WHERE {
+			?id a dwc:Occurrence ;
+				dcterms:creator %s .
+			OPTIONAL { ?id ex:visibility ?vis }
+			FILTER (!BOUND(?vis) || ?vis = "public")
+		}
+	`, creator)
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return strconv.Atoi(safeValue(results[0], "count"))
+}
+
+func (r *occurrenceRepository) FindByID(ctx context.Context, uri string) (*model.OccurrenceDetail, error) {
+	subject, err := sparql.NewIRI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	query := sparql.Format(`
 		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
 		PREFIX ro: <http://purl.obolibrary.org/obo/RO_>
 		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
 		PREFIX dcterms: <http://purl.org/dc/terms/>
 		PREFIX ex: <http://my-db.org/data/>
 
-		SELECT ?taxonName ?remarks ?pred ?predLabel ?val ?valLabel ?creator ?vis ?created
+		SELECT ?taxonName ?taxonID ?remarks ?pred ?predLabel ?val ?valLabel ?creator ?vis ?created
 		WHERE {
-			<%s> dwc:scientificName ?taxonName .
-			OPTIONAL { <%s> dwc:occurrenceRemarks ?remarks }
-			OPTIONAL { <%s> dcterms:creator ?creator }
-			OPTIONAL { <%s> ex:visibility ?vis }
-			OPTIONAL { <%s> dcterms:created ?created }
+			%[1]s dwc:scientificName ?taxonName .
+			OPTIONAL { %[1]s dwc:scientificNameID ?taxonID }
+			OPTIONAL { %[1]s dwc:occurrenceRemarks ?remarks }
+			OPTIONAL { %[1]s dcterms:creator ?creator }
+			OPTIONAL { %[1]s ex:visibility ?vis }
+			OPTIONAL { %[1]s dcterms:created ?created }
 			
 			OPTIONAL {
-				<%s> ?pred ?val .
+				%[1]s ?pred ?val .
 				OPTIONAL { ?pred rdfs:label ?predLabel }
 				OPTIONAL { ?val rdfs:label ?valLabel }
 			}
 		}
-	`, uri, uri, uri, uri, uri, uri)
+	`, subject)
 
-	results, err := r.sendQuery(query)
+	results, err := r.sendQuery(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -145,6 +386,7 @@ func (r *occurrenceRepository) FindByID(uri string) (*model.OccurrenceDetail, er
 
 	detail := &model.OccurrenceDetail{
 		ID:        uri,
+		TaxonID:   utils.ShortenTermID(safeValue(results[0], "taxonID")),
 		TaxonName: results[0]["taxonName"].Value,
 		Remarks:   safeValue(results[0], "remarks"),
 		OwnerID:   ownerID,
@@ -152,329 +394,962 @@ func (r *occurrenceRepository) FindByID(uri string) (*model.OccurrenceDetail, er
 		Traits:    []model.Trait{},
 	}
 
-	ignoredPredicates := map[string]bool{
-		"http://www.w3.org/1999/02/22-rdf-syntax-ns#type": true,
-		"http://rs.tdwg.org/dwc/terms/scientificName": true,
-		"http://rs.tdwg.org/dwc/terms/scientificNameID": true,
-		"http://rs.tdwg.org/dwc/terms/occurrenceRemarks": true,
-		"http://purl.org/dc/terms/creator": true,
-		"http://purl.org/dc/terms/created": true,
-		"http://my-db.org/data/visibility": true,
-	}
-
 	seen := make(map[string]bool)
 	for _, b := range results {
-		predURI := b["pred"].Value
-		if predURI == "" || ignoredPredicates[predURI] {
-			continue
-		}
-
-		valURI := b["val"].Value
-		key := predURI + valURI
-
-		if !seen[key] {
-			detail.Traits = append(detail.Traits, model.Trait{
-				PredicateID:    shortenID(predURI),
-				PredicateLabel: safeValue(b, "predLabel"),
-				ValueID:        shortenID(valURI),
-				ValueLabel:     safeValue(b, "valLabel"),
-			})
-			seen[key] = true
-		}
+		appendTrait(detail, b, seen)
 	}
 	return detail, nil
 }
 
-func (r *occurrenceRepository) Update(uri string, userID string, req model.OccurrenceRequest) error {
-	deleteSparql := fmt.Sprintf("DELETE WHERE { <%s> ?p ?o }", uri)
-	if err := r.sendUpdate(deleteSparql); err != nil {
-		return fmt.Errorf("failed to delete old data: %w", err)
-	}
-	
-	sparql, err := r.buildInsertSPARQL(uri, userID, req)
+// FindPage: 記録を URI 順に limit 件ずつ取る (after より後ろから)。検索インデックスの作り直し用
+func (r *occurrenceRepository) FindPage(ctx context.Context, after string, limit int) ([]model.OccurrenceRecord, error) {
+	// 1. まず URI だけを順に取る (形質の行数に引きずられて件数がずれないように)
+	query := sparql.Format(`
+		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
+
+		SELECT DISTINCT ?id
+		WHERE {
+			?id a dwc:Occurrence ;
+				dwc:scientificName ?taxonName .
+			FILTER (STR(?id) > %s)
+		}
+		ORDER BY STR(?id)
+		LIMIT %s
+	`, sparql.String(after), sparql.Integer(limit))
+
+	idRows, err := r.sendQuery(ctx, query)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(idRows) == 0 {
+		return nil, nil
 	}
-	return r.sendUpdate(sparql)
-}
-
-func (r *occurrenceRepository) Delete(uri string) error {
-	sparql := fmt.Sprintf("DELETE WHERE { <%s> ?p ?o }", uri)
-	return r.sendUpdate(sparql)
-}
 
-func (r *occurrenceRepository) GetTaxonStats(taxonURI string, rawID string) (*model.TaxonStats, error) {
-	if strings.HasPrefix(rawID, "ncbi:") {
-		taxonURI = resolveURI(rawID, "", "user_taxon")
+	var values strings.Builder
+	for _, b := range idRows {
+		subject, err := sparql.NewIRI(b["id"].Value)
+		if err != nil {
+			return nil, err
+		}
+		values.WriteString(subject.SPARQL())
+		values.WriteString(" ")
 	}
 
-	query := fmt.Sprintf(`
+	// 2. そのページの記録の中身をまとめて取る (values は検証済みの IRI を並べたもの)
+	query = fmt.Sprintf(`
 		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
-		PREFIX ro: <http://purl.obolibrary.org/obo/RO_>
 		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+		PREFIX dcterms: <http://purl.org/dc/terms/>
+		PREFIX ex: <http://my-db.org/data/>
 
-		SELECT (COUNT(?occ) AS ?count) (GROUP_CONCAT(DISTINCT ?traitLabel; separator=",") AS ?traits)
+		SELECT ?id ?taxonName ?taxonID ?remarks ?creator ?vis ?created ?pred ?predLabel ?val ?valLabel
 		WHERE {
-			?occ dwc:scientificNameID <%s> .
+			VALUES ?id { %s}
+			?id dwc:scientificName ?taxonName .
+			OPTIONAL { ?id dwc:scientificNameID ?taxonID }
+			OPTIONAL { ?id dwc:occurrenceRemarks ?remarks }
+			OPTIONAL { ?id dcterms:creator ?creator }
+			OPTIONAL { ?id ex:visibility ?vis }
+			OPTIONAL { ?id dcterms:created ?created }
+
 			OPTIONAL {
-				?occ ?pred ?val .
-				?val rdfs:label ?traitLabel .
+				?id ?pred ?val .
+				OPTIONAL { ?pred rdfs:label ?predLabel }
+				OPTIONAL { ?val rdfs:label ?valLabel }
 			}
 		}
-	`, taxonURI)
+	`, values.String())
 
-	results, err := r.sendQuery(query)
+	results, err := r.sendQuery(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 
-	stats := &model.TaxonStats{TaxonID: rawID, TotalCount: "0", Traits: []string{}}
-	if len(results) > 0 {
-		stats.TotalCount = results[0]["count"].Value
-		traitsStr := results[0]["traits"].Value
-		if traitsStr != "" {
-			stats.Traits = strings.Split(traitsStr, ",")
+	var records []model.OccurrenceRecord
+	index := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, b := range results {
+		uri := b["id"].Value
+		i, ok := index[uri]
+		if !ok {
+			creatorURI := safeValue(b, "creator")
+			ownerID := ""
+			if creatorURI != "" {
+				parts := strings.Split(creatorURI, "/")
+				ownerID = parts[len(parts)-1]
+			}
+			vis := safeValue(b, "vis")
+			records = append(records, model.OccurrenceRecord{
+				OccurrenceDetail: model.OccurrenceDetail{
+					ID:        uri,
+					TaxonID:   utils.ShortenTermID(safeValue(b, "taxonID")),
+					TaxonName: b["taxonName"].Value,
+					Remarks:   safeValue(b, "remarks"),
+					OwnerID:   ownerID,
+					CreatedAt: safeValue(b, "created"),
+					Traits:    []model.Trait{},
+				},
+				Public: vis == "" || vis == "public",
+			})
+			i = len(records) - 1
+			index[uri] = i
 		}
+		appendTrait(&records[i].OccurrenceDetail, b, seen)
 	}
-	return stats, nil
+
+	// 結果の順番は保証されないので URI 順に並べ直す
+	sort.Slice(records, func(a, b int) bool { return records[a].ID < records[b].ID })
+	return records, nil
 }
 
-// ★修正: 名前から子孫IDを取得 (推論検索用)
-// label だけでなく altLabel (別名) も検索する！
-func (r *occurrenceRepository) GetDescendantIDs(label string) ([]string, error) {
-	query := fmt.Sprintf(`
-		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
-		PREFIX skos: <http://www.w3.org/2004/02/skos/core#>
+// 記録そのものの項目 (形質としては扱わない述語)
+var ignoredPredicates = map[string]bool{
+	"http://www.w3.org/1999/02/22-rdf-syntax-ns#type": true,
+	"http://rs.tdwg.org/dwc/terms/scientificName":     true,
+	"http://rs.tdwg.org/dwc/terms/scientificNameID":   true,
+	"http://rs.tdwg.org/dwc/terms/occurrenceRemarks":  true,
+	"http://purl.org/dc/terms/creator":                true,
+	"http://purl.org/dc/terms/created":                true,
+	"http://my-db.org/data/visibility":                true,
+}
+
+// appendTrait: ?pred ?predLabel ?val ?valLabel の1行を形質として足す (同じ組は1回だけ)
+func appendTrait(detail *model.OccurrenceDetail, b map[string]bindingValue, seen map[string]bool) {
+	predURI := b["pred"].Value
+	if predURI == "" || ignoredPredicates[predURI] {
+		return
+	}
+
+	valURI := b["val"].Value
+	key := detail.ID + " " + predURI + " " + valURI
+	if seen[key] {
+		return
+	}
+	detail.Traits = append(detail.Traits, model.Trait{
+		PredicateID:    utils.ShortenTermID(predURI),
+		PredicateLabel: safeValue(b, "predLabel"),
+		ValueID:        utils.ShortenTermID(valURI),
+		ValueLabel:     safeValue(b, "valLabel"),
+	})
+	seen[key] = true
+}
+
+// FindVisibility: 記録の持ち主と公開範囲 (記録がなければ nil)
+func (r *occurrenceRepository) FindVisibility(ctx context.Context, uri string) (*model.OccurrenceVisibility, error) {
+	subject, err := sparql.NewIRI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	query := sparql.Format(`
 		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
-		
-		SELECT DISTINCT (?uri AS ?id)
-		WHERE {
-		  # 1. オントロジーから「その名前の概念」と「子孫」を探す
-		  GRAPH <http://my-db.org/ncbitaxon> {
-			# ★修正: UNIONを使って別名も検索
-			{ ?root rdfs:label ?name } UNION { ?root skos:altLabel ?name }
-			FILTER (lcase(str(?name)) = lcase("%s"))
-			
-			?uri rdfs:subClassOf* ?root .
-		  }
+		PREFIX dcterms: <http://purl.org/dc/terms/>
+		PREFIX ex: <http://my-db.org/data/>
 
-		  # 2. 実際にオカレンスデータで使われているIDだけに絞る
-		  ?occ dwc:scientificNameID ?uri .
+		SELECT ?creator ?vis
+		WHERE {
+			%[1]s a dwc:Occurrence .
+			OPTIONAL { %[1]s dcterms:creator ?creator }
+			OPTIONAL { %[1]s ex:visibility ?vis }
 		}
-		LIMIT 100000
-	`, label)
+		LIMIT 1
+	`, subject)
 
-	results, err := r.sendQuery(query)
+	results, err := r.sendQuery(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	if len(results) == 0 {
+		return nil, nil
+	}
 
-	var ids []string
+	ownerID := ""
+	if creatorURI := safeValue(results[0], "creator"); creatorURI != "" {
+		parts := strings.Split(creatorURI, "/")
+		ownerID = parts[len(parts)-1]
+	}
+	// visibility が無い古いデータは公開扱い (FindAll と同じ)
+	vis := safeValue(results[0], "vis")
+	return &model.OccurrenceVisibility{OwnerID: ownerID, Public: vis == "" || vis == "public"}, nil
+}
 
-	for _, b := range results {
-		if val, ok := b["id"]; ok {
-			uri := val.Value
-			// ★変更: IDのフォーマット揺れ（ncbi: vs NCBITaxon:）を吸収するため、両方のパターンを追加するのだ！
-			if strings.Contains(uri, "NCBITaxon_") {
-				parts := strings.Split(uri, "NCBITaxon_")
-				if len(parts) > 1 {
-					idNum := parts[1]
-					ids = append(ids, "ncbi:"+idNum)       // 推奨フォーマット
-					ids = append(ids, "NCBITaxon:"+idNum)  // フロントエンドからの登録データ用
-				}
-			} else if strings.Contains(uri, "ncbi_") {
-				parts := strings.Split(uri, "ncbi_")
-				if len(parts) > 1 {
-					idNum := parts[1]
-					ids = append(ids, "ncbi:"+idNum)
-					ids = append(ids, "NCBITaxon:"+idNum)
-				}
-			}
+// Describe: 記録1件のトリプルと、述語・目的語のラベルを CONSTRUCT で取り出す
+// accept には Fuseki が返せる RDF の形式 (text/turtle など) を渡す
+func (r *occurrenceRepository) Describe(ctx context.Context, uri string, accept string) (*model.SPARQLResult, error) {
+	subject, err := sparql.NewIRI(uri)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := sparql.NewIRI(r.uris.OntologyGraph("ncbitaxon"))
+	if err != nil {
+		return nil, err
+	}
+
+	query := sparql.Format(`
+		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+
+		CONSTRUCT {
+			%[1]s ?p ?o .
+			?p rdfs:label ?pLabel .
+			?o rdfs:label ?oLabel .
+		}
+		WHERE {
+			%[1]s ?p ?o .
+			OPTIONAL { ?p rdfs:label ?pLabel }
+			# 分類群のラベルは取り込んだオントロジーのグラフにある
+			OPTIONAL { { ?o rdfs:label ?oLabel } UNION { GRAPH %[2]s { ?o rdfs:label ?oLabel } } }
 		}
+	`, subject, graph)
+
+	return r.sendConstruct(ctx, query, accept)
+}
+
+func (r *occurrenceRepository) Update(ctx context.Context, uri string, userID string, req model.OccurrenceRequest) error {
+	// 先に INSERT を組み立てておく (入力が不正なら古いデータを消す前に止める)
+	insert, err := r.buildInsertSPARQL(uri, userID, req)
+	if err != nil {
+		return err
 	}
-	return ids, nil
+
+	if err := r.Delete(ctx, uri); err != nil {
+		return fmt.Errorf("failed to delete old data: %w", err)
+	}
+	return r.sendUpdate(ctx, insert)
 }
 
+func (r *occurrenceRepository) Delete(ctx context.Context, uri string) error {
+	subject, err := sparql.NewIRI(uri)
+	if err != nil {
+		return err
+	}
+	return r.sendUpdate(ctx, sparql.Format("DELETE WHERE { %s ?p ?o }", subject))
+}
 
 // ★修正: 名前からIDを引く (検索用)
 // label だけでなく altLabel も検索！
-func (r *occurrenceRepository) GetTaxonIDByLabel(label string) (string, error) {
-	log.Printf("🔍 [GetTaxonIDByLabel] Start looking up: '%s'", label)
+func (r *occurrenceRepository) GetTaxonIDByLabel(ctx context.Context, label string) (string, error) {
+	graph, err := sparql.NewIRI(r.uris.OntologyGraph("ncbitaxon"))
+	if err != nil {
+		return "", err
+	}
 
-	query := fmt.Sprintf(`
+	query := sparql.Format(`
 		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
 		PREFIX skos: <http://www.w3.org/2004/02/skos/core#>
 		
 		SELECT ?uri
 		WHERE {
-		  GRAPH <http://my-db.org/ontology/ncbitaxon> {
+		  GRAPH %s {
 			{ ?uri rdfs:label ?name } UNION { ?uri skos:altLabel ?name }
-			FILTER (lcase(str(?name)) = lcase("%s"))
+			FILTER (lcase(str(?name)) = lcase(%s))
 		  }
 		}
 		LIMIT 1
-	`, label)
+	`, graph, sparql.String(label))
 
-	results, err := r.sendQuery(query)
+	results, err := r.sendQuery(ctx, query)
 	if err != nil {
-		log.Printf("❌ [GetTaxonIDByLabel] Query failed: %v", err)
 		return "", err
 	}
-	
-	log.Printf("✅ [GetTaxonIDByLabel] Found %d results", len(results))
-
 	if len(results) == 0 {
-		log.Printf("   -> No ID found for '%s'", label)
+		slog.DebugContext(ctx, "taxon label not found", "label", label)
 		return "", nil
 	}
 
 	uri := safeValue(results[0], "uri")
-	log.Printf("   -> Raw URI found: %s", uri)
-
 	if strings.Contains(uri, "NCBITaxon_") {
 		parts := strings.Split(uri, "NCBITaxon_")
 		if len(parts) > 1 {
 			id := "ncbi:" + parts[1]
-			log.Printf("   -> Converted ID: %s", id)
+			slog.DebugContext(ctx, "taxon label resolved", "label", label, "uri", uri, "taxon_id", id)
 			return id, nil
 		}
 	}
 	return "", nil
 }
 
-// ---------------------------------------------------
-// Helper
-// ---------------------------------------------------
-
-func (r *occurrenceRepository) buildInsertSPARQL(uri string, userID string, req model.OccurrenceRequest) (string, error) {
-	visibility := "private"
-	if req.IsPublic {
-		visibility = "public"
+// FindTaxaByNames: rdfs:label か skos:altLabel が names のどれかとそのまま一致する分類群 (学名の照合用)
+// lcase で比べると全件なめることになるので、大文字小文字は呼ぶ側でそろえておくのだ
+func (r *occurrenceRepository) FindTaxaByNames(ctx context.Context, names []string) ([]model.TaxonNameHit, error) {
+	if len(names) == 0 {
+		return nil, nil
 	}
-	
-	taxonID := req.TaxonID
-	if taxonID == "" { taxonID = "ncbi:unknown" }
-	taxonLabel := req.TaxonLabel
-	if taxonLabel == "" { taxonLabel = "未同定" }
-
-	now := time.Now().Format(time.RFC3339)
-
-	const tpl = `
-PREFIX ex: <http://my-db.org/data/>
-PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
-PREFIX dcterms: <http://purl.org/dc/terms/>
-PREFIX ro: <http://purl.obolibrary.org/obo/RO_>
-PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
-PREFIX xsd: <http://www.w3.org/2001/XMLSchema#>
-
-INSERT DATA {
-  <{{.URI}}> 
-    a dwc:Occurrence ;
-    dwc:scientificNameID <{{.TaxonURI}}> ;
-    dwc:scientificName "{{.TaxonLabel}}" ;
-    dcterms:creator <http://my-db.org/user/{{.UserID}}> ;
-    ex:visibility "{{.Visibility}}" ;
-    dcterms:created "{{.CreatedAt}}"^^xsd:dateTime ;
-    dwc:occurrenceRemarks "{{.Remarks}}" .
-
-  {{range .Traits}}
-  <{{$.URI}}> <{{.PredURI}}> <{{.ValURI}}> .
-  <{{.PredURI}}> rdfs:label "{{.PredLabel}}" .
-  <{{.ValURI}}> rdfs:label "{{.ValLabel}}" .
-  {{end}}
-}
-`
-	type TraitSafe struct {
-		PredURI, PredLabel, ValURI, ValLabel string
+	graph, err := sparql.NewIRI(r.uris.OntologyGraph("ncbitaxon"))
+	if err != nil {
+		return nil, err
 	}
 
-	var safeTraits []TraitSafe
-	for _, t := range req.Traits {
-		safeTraits = append(safeTraits, TraitSafe{
-			PredURI:   resolveURI(t.PredicateID, t.PredicateLabel, "user_prop"),
-			PredLabel: t.PredicateLabel,
-			ValURI:    resolveURI(t.ValueID, t.ValueLabel, "user_val"),
-			ValLabel:  t.ValueLabel,
-		})
+	// 学名は利用者の入力なので、Format の書式には入れずにつなげる
+	values := make([]string, len(names))
+	for i, n := range names {
+		values[i] = sparql.String(n).SPARQL()
 	}
+	query := `
+		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+		PREFIX skos: <http://www.w3.org/2004/02/skos/core#>
 
-	data := struct {
-		URI, TaxonURI, TaxonLabel, Remarks, UserID, Visibility, CreatedAt string
-		Traits                                                            []TraitSafe
-	}{
-		URI:        uri,
-		TaxonURI:   resolveURI(taxonID, taxonLabel, "user_taxon"),
-		TaxonLabel: taxonLabel,
-		Remarks:    req.Remarks,
-		UserID:     userID,
-		Visibility: visibility,
-		CreatedAt:  now,
-		Traits:     safeTraits,
-	}
+		SELECT ?name ?uri ?label ?synonym
+		WHERE {
+		  VALUES ?name { ` + strings.Join(values, " ") + ` }
+		  GRAPH ` + graph.SPARQL() + ` {
+			{ ?uri rdfs:label ?name . BIND(false AS ?synonym) }
+			UNION { ?uri skos:altLabel ?name . BIND(true AS ?synonym) }
+			OPTIONAL { ?uri rdfs:label ?label }
+		  }
+		  FILTER (STRSTARTS(STR(?uri), "http://purl.obolibrary.org/obo/NCBITaxon_"))
+		}
+	`
 
-	t, err := template.New("sparql").Parse(tpl)
+	results, err := r.sendQuery(ctx, query)
 	if err != nil {
-		return "", err
-	}
-	var buf bytes.Buffer
-	if err := t.Execute(&buf, data); err != nil {
-		return "", err
+		return nil, err
 	}
-	return buf.String(), nil
-}
 
-func resolveURI(id, label, userType string) string {
-	if id != "" {
-		if strings.HasPrefix(id, "http") { return id }
-		safeID := strings.ReplaceAll(id, ":", "_")
-		if strings.HasPrefix(id, "ncbi:") {
-			safeID = strings.Replace(safeID, "ncbi_", "NCBITaxon_", 1)
-		}
-		return "http://purl.obolibrary.org/obo/" + safeID
+	hits := make([]model.TaxonNameHit, 0, len(results))
+	for _, b := range results {
+		hits = append(hits, model.TaxonNameHit{
+			Name:    safeValue(b, "name"),
+			TaxonID: utils.ShortenTermID(safeValue(b, "uri")),
+			Label:   safeValue(b, "label"),
+			Synonym: safeValue(b, "synonym") == "true",
+		})
 	}
-	encodedLabel := url.PathEscape(label)
-	return fmt.Sprintf("http://my-db.org/%s/%s", userType, encodedLabel)
+	return hits, nil
 }
 
-func shortenID(uri string) string {
-	if strings.Contains(uri, "/obo/") {
-		parts := strings.Split(uri, "/obo/")
-		id := parts[len(parts)-1]
-		id = strings.Replace(id, "NCBITaxon_", "ncbi:", 1)
-		return strings.ReplaceAll(id, "_", ":")
+// GetTaxonLineage: 分類群の祖先を上 (根) から順に返す (自分自身も含む)
+// NCBITaxon 以外の分類群 (名前だけで登録されたもの) は系統が無いので空
+func (r *occurrenceRepository) GetTaxonLineage(ctx context.Context, taxonID string) ([]model.TaxonAncestor, error) {
+	if !isNCBITaxonID(taxonID) {
+		return nil, nil
 	}
-	return uri
-}
-
-func (r *occurrenceRepository) sendUpdate(sparql string) error {
-	req, err := http.NewRequest("POST", r.updateURL, strings.NewReader(sparql))
+	taxon, err := sparql.NewIRI(utils.ExpandTermID(taxonID))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/sparql-update")
-	r.setBasicAuth(req)
-
-	resp, err := r.client.Do(req)
+	graph, err := sparql.NewIRI(r.uris.OntologyGraph("ncbitaxon"))
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// 深さ = その祖先のさらに祖先の数 (根が 1)
+	query := sparql.Format(`
+		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+		PREFIX ncbitaxon: <http://purl.obolibrary.org/obo/ncbitaxon#>
+
+		SELECT ?anc ?label ?rank ?depth
+		WHERE {
+		  GRAPH %[2]s {
+			{
+			  SELECT ?anc (COUNT(DISTINCT ?up) AS ?depth)
+			  WHERE {
+				%[1]s rdfs:subClassOf* ?anc .
+				?anc rdfs:subClassOf* ?up .
+			  }
+			  GROUP BY ?anc
+			}
+			OPTIONAL { ?anc rdfs:label ?label }
+			OPTIONAL { ?anc ncbitaxon:has_rank ?rank }
+		  }
+		}
+		ORDER BY ?depth
+	`, taxon, graph)
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var lineage []model.TaxonAncestor
+	seen := make(map[string]bool)
+	for _, b := range results {
+		id := utils.ShortenTermID(b["anc"].Value)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		lineage = append(lineage, model.TaxonAncestor{
+			ID:    id,
+			Label: safeValue(b, "label"),
+			Rank:  rankName(safeValue(b, "rank")),
+		})
+	}
+	return lineage, nil
+}
+
+// GetTraitValueDescendantIDs: 形質の値とその下位クラス (rdfs:subClassOf*) のうち、記録で使われているID
+// 上下関係は PATO・ENVO などのオントロジーのグラフから引く (分類群の ncbitaxon は除く)
+func (r *occurrenceRepository) GetTraitValueDescendantIDs(ctx context.Context, valueID string) ([]string, error) {
+	value, err := sparql.NewIRI(utils.ExpandTermID(valueID))
+	if err != nil {
+		return nil, err
+	}
+	taxonGraph, err := sparql.NewIRI(r.uris.OntologyGraph("ncbitaxon"))
+	if err != nil {
+		return nil, err
+	}
+
+	// cmd/loader は名前なしのグラフに、cmd/importer はオントロジーごとのグラフに入れるので、
+	// ontology/ の下のグラフをまとめて見る。値そのものはオントロジーに無くても入れる
+	query := sparql.Format(`
+		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
+
+		SELECT DISTINCT ?sub
+		WHERE {
+		  {
+			BIND(%[1]s AS ?sub)
+		  } UNION {
+			GRAPH ?g { ?sub rdfs:subClassOf+ %[1]s }
+			FILTER (STRSTARTS(STR(?g), %[2]s) && ?g != %[3]s)
+		  }
+		  FILTER EXISTS { ?occ a dwc:Occurrence ; ?pred ?sub }
+		}
+		LIMIT 10000
+	`, value, sparql.String(r.uris.OntologyGraph("")), taxonGraph)
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, b := range results {
+		ids = append(ids, utils.ShortenTermID(b["sub"].Value))
+	}
+	return ids, nil
+}
+
+// isNCBITaxonID: ncbitaxon のグラフに載っている (はずの) 分類群のIDか
+func isNCBITaxonID(taxonID string) bool {
+	return strings.HasPrefix(taxonID, "ncbi:") || strings.HasPrefix(taxonID, "NCBITaxon:")
+}
+
+// GetTaxon: ncbitaxon のグラフから分類群の名前・階級・別名を引く (載っていなければ nil)
+func (r *occurrenceRepository) GetTaxon(ctx context.Context, taxonID string) (*model.Taxon, error) {
+	if !isNCBITaxonID(taxonID) {
+		return nil, nil
+	}
+	taxon, err := sparql.NewIRI(utils.ExpandTermID(taxonID))
+	if err != nil {
+		return nil, err
+	}
+	graph, err := sparql.NewIRI(r.uris.OntologyGraph("ncbitaxon"))
+	if err != nil {
+		return nil, err
+	}
+
+	// 別名の数だけ行が掛け算にならないように UNION で1行ずつ取る
+	query := sparql.Format(`
+		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+		PREFIX skos: <http://www.w3.org/2004/02/skos/core#>
+		PREFIX ncbitaxon: <http://purl.obolibrary.org/obo/ncbitaxon#>
+
+		SELECT ?label ?rank ?synonym
+		WHERE {
+		  GRAPH %[2]s {
+			{ %[1]s rdfs:label ?label }
+			UNION { %[1]s ncbitaxon:has_rank ?rank }
+			UNION { %[1]s skos:altLabel ?synonym }
+		  }
+		}
+	`, taxon, graph)
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	t := &model.Taxon{ID: utils.ShortenTermID(taxon.Value()), Synonyms: []string{}}
+	for _, b := range results {
+		if v := safeValue(b, "label"); v != "" {
+			t.Label = v
+		}
+		if v := safeValue(b, "rank"); v != "" {
+			t.Rank = rankName(v)
+		}
+		if v := safeValue(b, "synonym"); v != "" {
+			t.Synonyms = append(t.Synonyms, v)
+		}
+	}
+	sort.Strings(t.Synonyms)
+	return t, nil
+}
+
+// 分類群の記録を数えるクエリの共通の PREFIX
+const taxonScopePrefixes = `
+		PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
+		PREFIX dcterms: <http://purl.org/dc/terms/>
+		PREFIX ex: <http://my-db.org/data/>
+		PREFIX ncbitaxon: <http://purl.obolibrary.org/obo/ncbitaxon#>
+`
+
+// taxonScope: 分類群 taxonID とその子孫の記録 (?id、記録の分類群は ?t) のうち filter に合うものを選ぶ WHERE の中身
+// taxonID が空ならすべての分類群の記録
+// 子孫かどうかは記録の分類群から上にたどって調べる (上の階級から下に広げると子孫が何百万にもなるので)
+// IRI に %xx が入ることがあるので、返した文字列を Format の書式に混ぜないこと
+func (r *occurrenceRepository) taxonScope(taxonID, filter string) (string, error) {
+	scope := `
+			?id a dwc:Occurrence ;
+				dwc:scientificNameID ?t .
+			OPTIONAL { ?id dcterms:creator ?creator }
+			OPTIONAL { ?id ex:visibility ?vis }
+	`
+	if taxonID != "" {
+		taxon, err := sparql.NewIRI(utils.ExpandTermID(taxonID))
+		if err != nil {
+			return "", err
+		}
+		graph, err := sparql.NewIRI(r.uris.OntologyGraph("ncbitaxon"))
+		if err != nil {
+			return "", err
+		}
+		scope += sparql.Format("FILTER (?t = %[1]s || EXISTS { GRAPH %[2]s { ?t rdfs:subClassOf+ %[1]s } })\n", taxon, graph)
+	}
+	return scope + "FILTER (" + filter + ")\n", nil
+}
+
+// SummarizeTaxonOccurrences: 分類群 (子孫も含む) の見てよい記録の数と、いちばん古い・新しい日時
+func (r *occurrenceRepository) SummarizeTaxonOccurrences(ctx context.Context, taxonID string, currentUserID string) (*model.TaxonOccurrenceSummary, error) {
+	filter, err := r.visibleFilter(currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := r.taxonScope(taxonID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := taxonScopePrefixes + `
+		SELECT (COUNT(DISTINCT ?id) AS ?count) (MIN(?created) AS ?first) (MAX(?created) AS ?last) (SAMPLE(?taxonName) AS ?name)
+		WHERE {
+			` + scope + `
+			OPTIONAL { ?id dcterms:created ?created }
+			OPTIONAL { ?id dwc:scientificName ?taxonName }
+		}
+	`
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	summary := &model.TaxonOccurrenceSummary{}
+	if len(results) > 0 {
+		summary.Count, _ = strconv.Atoi(safeValue(results[0], "count"))
+		summary.First = safeValue(results[0], "first")
+		summary.Last = safeValue(results[0], "last")
+		summary.Name = safeValue(results[0], "name")
+	}
+	return summary, nil
+}
+
+// CountTaxonChildren: 直下の分類群ごとの、見てよい記録の数 (子孫の記録も含む)
+// 記録の無い子は出さない (属の下の種などは何百もあるので)
+func (r *occurrenceRepository) CountTaxonChildren(ctx context.Context, taxonID string, currentUserID string) ([]model.TaxonChild, error) {
+	children := []model.TaxonChild{}
+	if !isNCBITaxonID(taxonID) {
+		return children, nil
+	}
+	filter, err := r.visibleFilter(currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := r.taxonScope(taxonID, filter)
+	if err != nil {
+		return nil, err
+	}
+	taxon, err := sparql.NewIRI(utils.ExpandTermID(taxonID))
+	if err != nil {
+		return nil, err
+	}
+	graph, err := sparql.NewIRI(r.uris.OntologyGraph("ncbitaxon"))
+	if err != nil {
+		return nil, err
+	}
+
+	query := taxonScopePrefixes + `
+		SELECT ?child (SAMPLE(?childLabel) AS ?label) (SAMPLE(?childRank) AS ?rank) (COUNT(DISTINCT ?id) AS ?count)
+		WHERE {
+			` + scope + sparql.Format(`
+			GRAPH %[2]s {
+				?t rdfs:subClassOf* ?child .
+				?child rdfs:subClassOf %[1]s .
+				OPTIONAL { ?child rdfs:label ?childLabel }
+				OPTIONAL { ?child ncbitaxon:has_rank ?childRank }
+			}
+		}
+		GROUP BY ?child
+		ORDER BY DESC(?count) ?child
+	`, taxon, graph)
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range results {
+		count, _ := strconv.Atoi(safeValue(b, "count"))
+		children = append(children, model.TaxonChild{
+			ID:              utils.ShortenTermID(b["child"].Value),
+			Label:           safeValue(b, "label"),
+			Rank:            rankName(safeValue(b, "rank")),
+			OccurrenceCount: count,
+		})
+	}
+	return children, nil
+}
+
+// CountTaxonTraits: 分類群 (子孫も含む) の見てよい記録で、述語・値ごとに記録を数える
+func (r *occurrenceRepository) CountTaxonTraits(ctx context.Context, taxonID string, currentUserID string) ([]model.TraitFrequency, error) {
+	filter, err := r.visibleFilter(currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := r.taxonScope(taxonID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := taxonScopePrefixes + `
+		SELECT ?pred ?val (SAMPLE(?pl) AS ?predLabel) (SAMPLE(?vl) AS ?valLabel) (COUNT(DISTINCT ?id) AS ?count)
+		WHERE {
+			` + scope + `
+			?id ?pred ?val .
+			FILTER (?pred NOT IN (` + traitPredicateExclusion() + `))
+			OPTIONAL { ?pred rdfs:label ?pl }
+			OPTIONAL { ?val rdfs:label ?vl }
+		}
+		GROUP BY ?pred ?val
+		ORDER BY DESC(?count) ?pred ?val
+	`
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// 述語ごとにまとめる (述語の順番は、いちばん多い値が多い順)
+	traits := []model.TraitFrequency{}
+	index := make(map[string]int)
+	for _, b := range results {
+		predID := utils.ShortenTermID(b["pred"].Value)
+		i, ok := index[predID]
+		if !ok {
+			traits = append(traits, model.TraitFrequency{
+				PredicateID:    predID,
+				PredicateLabel: safeValue(b, "predLabel"),
+				Values:         []model.TraitValueCount{},
+			})
+			i = len(traits) - 1
+			index[predID] = i
+		}
+		count, _ := strconv.Atoi(safeValue(b, "count"))
+		traits[i].Values = append(traits[i].Values, model.TraitValueCount{
+			ValueID:    utils.ShortenTermID(b["val"].Value),
+			ValueLabel: safeValue(b, "valLabel"),
+			Count:      count,
+		})
+	}
+	return traits, nil
+}
+
+// traitPredicateExclusion: 記録そのものの項目 (ignoredPredicates) を NOT IN で外すための IRI の並び
+func traitPredicateExclusion() string {
+	excluded := make([]string, 0, len(ignoredPredicates))
+	for uri := range ignoredPredicates {
+		excluded = append(excluded, "<"+uri+">")
+	}
+	sort.Strings(excluded)
+	return strings.Join(excluded, ", ")
+}
+
+// FindTaxonTraitStates: 分類群ごと・述語と値ごとの、見てよい記録の数 (形質行列の書き出し用)
+// taxonID を指定すると、その分類群と子孫の記録だけ
+func (r *occurrenceRepository) FindTaxonTraitStates(ctx context.Context, taxonID string, currentUserID string) ([]model.TaxonTraitState, error) {
+	filter, err := r.visibleFilter(currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := r.taxonScope(taxonID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := taxonScopePrefixes + `
+		SELECT ?t ?pred ?val (SAMPLE(?taxonName) AS ?taxonLabel) (SAMPLE(?pl) AS ?predLabel) (SAMPLE(?vl) AS ?valLabel) (COUNT(DISTINCT ?id) AS ?count)
+		WHERE {
+			` + scope + `
+			?id dwc:scientificName ?taxonName .
+			?id ?pred ?val .
+			FILTER (?pred NOT IN (` + traitPredicateExclusion() + `))
+			OPTIONAL { ?pred rdfs:label ?pl }
+			OPTIONAL { ?val rdfs:label ?vl }
+		}
+		GROUP BY ?t ?pred ?val
+	`
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]model.TaxonTraitState, 0, len(results))
+	for _, b := range results {
+		count, _ := strconv.Atoi(safeValue(b, "count"))
+		states = append(states, model.TaxonTraitState{
+			TaxonID:        utils.ShortenTermID(b["t"].Value),
+			TaxonLabel:     safeValue(b, "taxonLabel"),
+			PredicateID:    utils.ShortenTermID(b["pred"].Value),
+			PredicateLabel: safeValue(b, "predLabel"),
+			ValueID:        utils.ShortenTermID(b["val"].Value),
+			ValueLabel:     safeValue(b, "valLabel"),
+			Count:          count,
+		})
+	}
+	return states, nil
+}
+
+// CountOccurrencesByTaxon: 記録の分類群 (scientificNameID) ごとの、見てよい記録の数 (系統樹の書き出し用)
+// taxonID を指定するとその分類群と子孫の記録だけ、ownerID を指定するとその人の記録だけ
+func (r *occurrenceRepository) CountOccurrencesByTaxon(ctx context.Context, taxonID string, ownerID string, currentUserID string) (map[string]int, error) {
+	filter, err := r.visibleFilter(currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != "" {
+		owner, err := r.ownerFilter(ownerID)
+		if err != nil {
+			return nil, err
+		}
+		filter = "(" + filter + ") && " + owner
+	}
+	scope, err := r.taxonScope(taxonID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := taxonScopePrefixes + `
+		SELECT ?t (COUNT(DISTINCT ?id) AS ?count)
+		WHERE {
+			` + scope + `
+		}
+		GROUP BY ?t
+	`
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(results))
+	for _, b := range results {
+		count, _ := strconv.Atoi(safeValue(b, "count"))
+		counts[utils.ShortenTermID(b["t"].Value)] = count
+	}
+	return counts, nil
+}
+
+// FindByTaxonAndOwner: その人の、分類群 (子孫も含む) の記録を新しい順に (公開・非公開とも)
+func (r *occurrenceRepository) FindByTaxonAndOwner(ctx context.Context, taxonID string, ownerID string, limit int) ([]model.OccurrenceListItem, error) {
+	filter, err := r.ownerFilter(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := r.taxonScope(taxonID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := taxonScopePrefixes + `
+		SELECT ?id ?taxonName ?remarks ?creator ?created
+		WHERE {
+			` + scope + `
+			?id dwc:scientificName ?taxonName .
+			OPTIONAL { ?id dwc:occurrenceRemarks ?remarks }
+			OPTIONAL { ?id dcterms:created ?created }
+		}
+		ORDER BY DESC(?created)
+	` + fmt.Sprintf("LIMIT %d\n", limit)
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []model.OccurrenceListItem{}
+	for _, b := range results {
+		list = append(list, toListItem(b))
+	}
+	return list, nil
+}
+
+// GetTaxonomyVersion: 分類 (ncbitaxon グラフ) を読み込んだ日時 (cmd/loader・importer が書く。無ければ空)
+func (r *occurrenceRepository) GetTaxonomyVersion(ctx context.Context) (string, error) {
+	graph, err := sparql.NewIRI(r.uris.OntologyGraph("ncbitaxon"))
+	if err != nil {
+		return "", err
+	}
+
+	query := sparql.Format(`
+		PREFIX dcterms: <http://purl.org/dc/terms/>
+
+		SELECT (MAX(STR(?modified)) AS ?version)
+		WHERE {
+		  GRAPH %[1]s { %[1]s dcterms:modified ?modified }
+		}
+	`, graph)
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil || len(results) == 0 {
+		return "", err
+	}
+	return safeValue(results[0], "version"), nil
+}
+
+// FindTaxonIDs: 記録で使われている分類群のID (系統の付け直し用)
+func (r *occurrenceRepository) FindTaxonIDs(ctx context.Context) ([]string, error) {
+	query := `
+		PREFIX dwc: <http://rs.tdwg.org/dwc/terms/>
+
+		SELECT DISTINCT ?taxonID
+		WHERE {
+			?id a dwc:Occurrence ;
+				dwc:scientificNameID ?taxonID .
+		}
+	`
+
+	results, err := r.sendQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, b := range results {
+		ids = append(ids, utils.ShortenTermID(b["taxonID"].Value))
+	}
+	return ids, nil
+}
+
+// rankName: 階級の IRI (…/NCBITaxon_family) → "family" (no_rank は空にする)
+func rankName(rankURI string) string {
+	_, rank, ok := strings.Cut(rankURI, "NCBITaxon_")
+	if !ok || rank == "no_rank" {
+		return ""
+	}
+	return rank
+}
+
+// ---------------------------------------------------
+// Helper
+// ---------------------------------------------------
+
+// buildInsertSPARQL: 記録1件分の INSERT DATA を組み立てる
+// 入力値はすべて sparql の Term を通すので、" や > を含んでいてもクエリは壊れない
+func (r *occurrenceRepository) buildInsertSPARQL(uri string, userID string, req model.OccurrenceRequest) (string, error) {
+	visibility := "private"
+	if req.IsPublic {
+		visibility = "public"
+	}
+	
+	taxonID := req.TaxonID
+	if taxonID == "" { taxonID = "ncbi:unknown" }
+	taxonLabel := req.TaxonLabel
+	if taxonLabel == "" { taxonLabel = "未同定" }
+
+	subject, err := sparql.NewIRI(uri)
+	if err != nil {
+		return "", err
+	}
+	taxon, err := sparql.NewIRI(r.resolveURI(taxonID, taxonLabel, "user_taxon"))
+	if err != nil {
+		return "", fmt.Errorf("taxon_id: %w", err)
+	}
+	creator, err := sparql.NewIRI(r.uris.UserURI(userID))
+	if err != nil {
+		return "", err
+	}
+
+	var triples sparql.Triples
+	triples.Add(subject,
+		sparql.PO(iriType, iriOccurrence),
+		sparql.PO(iriScientificNameID, taxon),
+		sparql.PO(iriScientificName, sparql.String(taxonLabel)),
+		sparql.PO(iriCreator, creator),
+		sparql.PO(iriVisibility, sparql.String(visibility)),
+		sparql.PO(iriCreated, sparql.DateTime(time.Now())),
+		sparql.PO(iriOccurrenceRemarks, sparql.String(req.Remarks)),
+	)
+
+	for _, t := range req.Traits {
+		pred, err := sparql.NewIRI(r.resolveURI(t.PredicateID, t.PredicateLabel, "user_prop"))
+		if err != nil {
+			return "", fmt.Errorf("traits.predicate_id: %w", err)
+		}
+		val, err := sparql.NewIRI(r.resolveURI(t.ValueID, t.ValueLabel, "user_val"))
+		if err != nil {
+			return "", fmt.Errorf("traits.value_id: %w", err)
+		}
+		triples.Add(subject, sparql.PO(pred, val))
+		triples.Add(pred, sparql.PO(iriLabel, sparql.String(t.PredicateLabel)))
+		triples.Add(val, sparql.PO(iriLabel, sparql.String(t.ValueLabel)))
+	}
+
+	return "INSERT DATA {\n" + triples.String() + "}\n", nil
+}
+
+func (r *occurrenceRepository) resolveURI(id, label, userType string) string {
+	if id != "" {
+		return utils.ExpandTermID(id)
+	}
+	encodedLabel := url.PathEscape(label)
+	return r.uris.ResourceURI(userType, encodedLabel)
+}
+
+func (r *occurrenceRepository) sendUpdate(ctx context.Context, query string) (err error) {
+	start := time.Now()
+	ctx, span := startSPARQLSpan(ctx, "update", query)
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveSPARQL("update", start, &err)
+	defer func() { logSPARQL(ctx, r.slowQuery, "update", query, start, -1, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.updateURL, strings.NewReader(query))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/sparql-update")
+	r.setBasicAuth(req)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 
 	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, logging.Truncate(string(body), 500))
 	}
 	return nil
 }
 
-func (r *occurrenceRepository) sendQuery(sparql string) ([]map[string]bindingValue, error) {
-	data := url.Values{}
-	data.Set("query", sparql)
+func (r *occurrenceRepository) sendQuery(ctx context.Context, query string) (bindings []map[string]bindingValue, err error) {
+	start := time.Now()
+	ctx, span := startSPARQLSpan(ctx, "query", query)
+	defer func() {
+		span.SetAttributes(attribute.Int("db.response.returned_rows", len(bindings)))
+		tracing.End(span, err)
+	}()
+	defer metrics.ObserveSPARQL("query", start, &err)
+	defer func() { logSPARQL(ctx, r.slowQuery, "query", query, start, len(bindings), err) }()
 
-	// ★追加: クエリの内容を表示
-	log.Printf("📡 [sendQuery] Sending SPARQL:\n%s", sparql)
+	data := url.Values{}
+	data.Set("query", query)
 
-	req, err := http.NewRequest("POST", r.queryURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", r.queryURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -485,29 +1360,104 @@ func (r *occurrenceRepository) sendQuery(sparql string) ([]map[string]bindingVal
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		log.Printf("❌ [sendQuery] Request error: %v", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	
-	// ★追加: レスポンスの中身（JSON）を表示
-	log.Printf("📥 [sendQuery] Response Status: %s", resp.Status)
-	log.Printf("📥 [sendQuery] Response Body: %s", string(bodyBytes))
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, logging.Truncate(string(bodyBytes), 500))
 	}
 
 	var result sparqlResponse
 	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		log.Printf("❌ [sendQuery] JSON Decode Error: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("invalid SPARQL response: %w", err)
 	}
 	return result.Results.Bindings, nil
 }
 
+// sendConstruct: CONSTRUCT を投げて、Fuseki が返した RDF をそのまま返す
+func (r *occurrenceRepository) sendConstruct(ctx context.Context, query, accept string) (result *model.SPARQLResult, err error) {
+	start := time.Now()
+	ctx, span := startSPARQLSpan(ctx, "construct", query)
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveSPARQL("construct", start, &err)
+	defer func() { logSPARQL(ctx, r.slowQuery, "construct", query, start, -1, err) }()
+
+	data := url.Values{}
+	data.Set("query", query)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.queryURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", accept)
+	r.setBasicAuth(req)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, logging.Truncate(string(body), 500))
+	}
+	return &model.SPARQLResult{ContentType: resp.Header.Get("Content-Type"), Body: body}, nil
+}
+
+// startSPARQLSpan: Fuseki への1リクエスト分の span
+// クエリはログと同じく伏せ字にしてから載せる
+func startSPARQLSpan(ctx context.Context, op, query string) (context.Context, trace.Span) {
+	return tracing.StartClient(ctx, "SPARQL "+op,
+		attribute.String("db.system.name", "fuseki"),
+		attribute.String("db.operation.name", op),
+		attribute.String("db.query.text", logging.RedactSPARQL(query, 2000)),
+	)
+}
+
+// logSPARQL: SPARQL 1回分のログ
+// 普段は debug でだけ出し、遅いときは warn、失敗したら error にする
+// クエリ内のリテラル (備考・ラベルなどの入力値) は伏せ字にする
+func logSPARQL(ctx context.Context, slowQuery time.Duration, op, query string, start time.Time, rows int, err error) {
+	elapsed := time.Since(start)
+
+	level := slog.LevelDebug
+	msg := "sparql " + op
+	switch {
+	case err != nil:
+		level, msg = slog.LevelError, "sparql "+op+" failed"
+	case slowQuery > 0 && elapsed >= slowQuery:
+		level, msg = slog.LevelWarn, "slow sparql "+op
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.Duration("duration", elapsed),
+		slog.String("query", logging.RedactSPARQL(query, 2000)),
+	}
+	if rows >= 0 && err == nil {
+		attrs = append(attrs, slog.Int("rows", rows))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
 func (r *occurrenceRepository) setBasicAuth(req *http.Request) {
 	auth := r.username + ":" + r.password
 	encoded := base64.StdEncoding.EncodeToString([]byte(auth))
@@ -524,6 +1474,25 @@ type bindingValue struct {
 	Value string `json:"value"`
 }
 
+// toListItem: SELECT ?id ?taxonName ?remarks ?creator ?created の結果を一覧用の形にする
+func toListItem(b map[string]bindingValue) model.OccurrenceListItem {
+	creatorURI := safeValue(b, "creator")
+	ownerID := ""
+	if creatorURI != "" {
+		parts := strings.Split(creatorURI, "/")
+		ownerID = parts[len(parts)-1]
+	}
+
+	return model.OccurrenceListItem{
+		ID:        b["id"].Value,
+		TaxonName: b["taxonName"].Value,
+		Remarks:   safeValue(b, "remarks"),
+		OwnerID:   ownerID,
+		OwnerName: "",
+		CreatedAt: safeValue(b, "created"),
+	}
+}
+
 func safeValue(binding map[string]bindingValue, key string) string {
 	if v, ok := binding[key]; ok {
 		return v.Value
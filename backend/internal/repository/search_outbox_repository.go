@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SearchOutboxRepository: Meilisearch への反映待ちの変更 (search_outbox テーブル)
+type SearchOutboxRepository interface {
+	// Enqueue: 記録を変更する前に積む。Fuseki の書き込みが終わるまで拾われないよう holdFor だけ先送りしておく
+	Enqueue(ctx context.Context, operation, occurrenceURI string, holdFor time.Duration) (int64, error)
+	// Release: Fuseki の書き込みが終わったので、すぐ拾ってよいことにする
+	Release(ctx context.Context, id int64) error
+	// Claim: 期限の来た行を最大 limit 件取る。処理中に落ちても lease 後にまた拾われる
+	// LockForSync を取ったまま呼び、取った行を Complete / Fail し終わるまでロックを放さないこと
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]model.SearchOutboxEntry, error)
+	Complete(ctx context.Context, id int64) error
+	// Fail: 失敗を記録する。retryAt が nil なら failed にして再試行を諦める
+	Fail(ctx context.Context, id int64, lastError string, retryAt *time.Time) error
+	List(ctx context.Context, status string, limit int) (*model.SearchOutboxPage, error)
+	// Retry: failed の行を pending に戻す (無ければ false)
+	Retry(ctx context.Context, id int64) (bool, error)
+	// LockForReindex: インデックスを作り直している間、ワーカーが outbox を処理しないよう止める
+	// (作り直し中に古いインデックスへ反映した変更が、入れ替えで消えてしまうのを防ぐ)
+	// ワーカーが処理中の行があれば、反映し終わるまで待ってから返る
+	LockForReindex(ctx context.Context) (unlock func(), err error)
+	// LockForSync: ワーカーが行を拾ってから反映し終わるまで持つ共有ロック
+	// 作り直し中 (か、作り直しが始まるのを待っている) なら ErrReindexRunning
+	LockForSync(ctx context.Context) (unlock func(), err error)
+
+	// LineageVersion: インデックスの系統を付けたときの分類の版 (まだなら空)
+	LineageVersion(ctx context.Context) (string, error)
+	SetLineageVersion(ctx context.Context, version string) error
+}
+
+// ErrReindexRunning: 別のところでインデックスを作り直している
+var ErrReindexRunning = errors.New("検索インデックスの作り直しがすでに動いているのだ")
+
+// advisory lock のキー
+const (
+	// インデックスの作り直しとワーカーで共有する (作り直しは排他、ワーカーは共有で取る)
+	searchReindexLockKey = 7240042
+	// 作り直しを1つだけにするためのもの。searchReindexLockKey を待っている間に2つ目が並ばないようにする
+	searchReindexRunKey = 7240043
+)
+
+type searchOutboxRepository struct {
+	db *sql.DB
+}
+
+func NewSearchOutboxRepository(db *sql.DB) SearchOutboxRepository {
+	return &searchOutboxRepository{db: db}
+}
+
+func (r *searchOutboxRepository) Enqueue(ctx context.Context, operation, occurrenceURI string, holdFor time.Duration) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO search_outbox (operation, occurrence_uri, next_attempt_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + $3::bigint * INTERVAL '1 millisecond')
+		RETURNING id
+	`, operation, occurrenceURI, holdFor.Milliseconds()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue search outbox failed: %w", err)
+	}
+	return id, nil
+}
+
+func (r *searchOutboxRepository) Release(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE search_outbox SET next_attempt_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'pending' AND attempts = 0
+	`, id)
+	return err
+}
+
+func (r *searchOutboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) (_ []model.SearchOutboxEntry, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED で、複数台で動かしても同じ行を同時に取らないようにする
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE search_outbox
+		SET attempts = attempts + 1,
+		    next_attempt_at = CURRENT_TIMESTAMP + $2::bigint * INTERVAL '1 millisecond',
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM search_outbox
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, operation, occurrence_uri, status, attempts, last_error, next_attempt_at, created_at, updated_at
+	`, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	entries, err := scanSearchOutbox(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING は順番を保証しないので、古い順に並べ直す
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+func (r *searchOutboxRepository) Complete(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM search_outbox WHERE id = $1", id)
+	return err
+}
+
+func (r *searchOutboxRepository) Fail(ctx context.Context, id int64, lastError string, retryAt *time.Time) error {
+	var err error
+	if retryAt != nil {
+		_, err = r.db.ExecContext(ctx, `
+			UPDATE search_outbox SET last_error = $2, next_attempt_at = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, id, lastError, *retryAt)
+	} else {
+		_, err = r.db.ExecContext(ctx, `
+			UPDATE search_outbox SET status = 'failed', last_error = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, id, lastError)
+	}
+	return err
+}
+
+func (r *searchOutboxRepository) List(ctx context.Context, status string, limit int) (*model.SearchOutboxPage, error) {
+	page := &model.SearchOutboxPage{Entries: []model.SearchOutboxEntry{}}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE status = 'pending'), COUNT(*) FILTER (WHERE status = 'failed')
+		FROM search_outbox
+	`).Scan(&page.Pending, &page.Failed)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, operation, occurrence_uri, status, attempts, last_error, next_attempt_at, created_at, updated_at
+		FROM search_outbox
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY id DESC
+		LIMIT $2
+	`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries, err := scanSearchOutbox(rows)
+	if err != nil {
+		return nil, err
+	}
+	page.Entries = append(page.Entries, entries...)
+	return page, nil
+}
+
+func (r *searchOutboxRepository) Retry(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE search_outbox
+		SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'failed'
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *searchOutboxRepository) LockForReindex(ctx context.Context) (func(), error) {
+	// セッション単位のロックなので、接続を1本確保して終わるまで持っておく
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unlock := sessionUnlock(conn)
+
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", searchReindexRunKey).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, ErrReindexRunning
+	}
+	// ワーカーが拾った行を反映している途中なら、終わる (共有ロックが外れる) まで待つ
+	// 待っている間はワーカーの pg_try_advisory_lock_shared も失敗するので、新しく拾われることはない
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", searchReindexLockKey); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+func (r *searchOutboxRepository) LockForSync(ctx context.Context) (func(), error) {
+	// Claim のトランザクションの中だけで持つと、反映している途中で作り直しに入れ替えられてしまうので
+	// 接続を1本確保して、反映し終わるまでセッション単位で持っておく
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock_shared($1)", searchReindexLockKey).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, ErrReindexRunning
+	}
+	return sessionUnlock(conn), nil
+}
+
+// sessionUnlock: conn で取ったセッション単位の advisory lock を外して、接続を返す
+func sessionUnlock(conn *sql.Conn) func() {
+	return func() {
+		// このためだけに確保した接続なので、持っているロックはまとめて外してよい
+		_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock_all()")
+		if err != nil {
+			// 接続ごと捨てればロックも外れる
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+}
+
+func (r *searchOutboxRepository) LineageVersion(ctx context.Context) (string, error) {
+	var version string
+	err := r.db.QueryRowContext(ctx, "SELECT value FROM search_state WHERE name = 'lineage_version'").Scan(&version)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return version, err
+}
+
+func (r *searchOutboxRepository) SetLineageVersion(ctx context.Context, version string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO search_state (name, value) VALUES ('lineage_version', $1)
+		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+	`, version)
+	return err
+}
+
+func scanSearchOutbox(rows *sql.Rows) ([]model.SearchOutboxEntry, error) {
+	var entries []model.SearchOutboxEntry
+	for rows.Next() {
+		var e model.SearchOutboxEntry
+		if err := rows.Scan(&e.ID, &e.Operation, &e.OccurrenceURI, &e.Status, &e.Attempts, &e.LastError, &e.NextAttemptAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
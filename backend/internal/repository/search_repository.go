@@ -1,12 +1,21 @@
 package repository
 
 import (
+	"github.com/saku-730/bio-occurrence/backend/internal/metrics"
 	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/meilisearch/meilisearch-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type OccurrenceDocument struct {
@@ -18,12 +27,56 @@ type OccurrenceDocument struct {
 	OwnerID    string   `json:"owner_id"`
 	OwnerName  string   `json:"owner_name"`
 	IsPublic   bool     `json:"is_public"`
+	CreatedAt  string   `json:"created_at"`
+
+	// 絞り込み欄 (facet) 用
+	TraitPairs []string          `json:"trait_pairs"` // "形質: 値" だけ (Traits はキーワード検索用に単独のラベルも入っている)
+	TaxonRanks map[string]string `json:"taxon_ranks"` // 階級 → その階級の祖先の名前 (NCBITaxon の系統から)
+
+	// 分類群での絞り込み用。自分と祖先すべてのID (ncbi:9604 で探すとヒト科の下の記録がぜんぶ当たる)
+	TaxonAncestors []string `json:"taxon_ancestors"`
+
+	// 形質の条件 (trait=) 用
+	TraitValueIDs []string `json:"trait_value_ids"` // 値のID
+	TraitKeys     []string `json:"trait_keys"`      // "述語ID=値ID" (model.TraitKey)
+}
+
+// SearchPage: 検索結果の1ページ分 (Total は Meilisearch の見積もり件数)
+// Facets は facets= で頼んだ項目ごとの「値 → 件数」
+type SearchPage struct {
+	Total  int64                       `json:"total"`
+	Docs   []OccurrenceDocument        `json:"hits"`
+	Facets map[string]map[string]int64 `json:"facets,omitempty"`
 }
 
 type SearchRepository interface {
-	IndexOccurrence(req model.OccurrenceRequest, id string, ownerID string, ownerName string) error
-	DeleteOccurrence(id string) error
-	Search(query string, currentUserID string, targetTaxonID []string) ([]OccurrenceDocument, error)
+	IndexOccurrence(ctx context.Context, doc OccurrenceDocument) error
+	DeleteOccurrence(ctx context.Context, id string) error
+	Search(ctx context.Context, filter model.OccurrenceSearchFilter, currentUserID string, taxonAncestorID string, traits []model.TraitClause) (*SearchPage, error)
+	// SetTaxonLineage: その分類群の記録すべての系統 (taxon_ancestors・taxon_ranks) を付け直す。付け直した件数を返す
+	SetTaxonLineage(ctx context.Context, taxonID string, lineage []model.TaxonAncestor) (int, error)
+
+	// 以下はインデックスの作り直し (reindex) 用
+	// 別名のインデックスに全件入れてから入れ替えるので、作っている間も検索は今のまま使える
+	IndexedIDs(ctx context.Context) (map[string]bool, error)
+	PrepareStaging(ctx context.Context) error
+	AddToStaging(ctx context.Context, docs []OccurrenceDocument) error
+	SwapStaging(ctx context.Context) error
+}
+
+// 記録のインデックスの設定 (作り直すときも同じものを使う)
+var (
+	occurrenceFilterable = []string{"traits", "taxon_label", "is_public", "owner_id", "taxon_id", "owner_name", "trait_pairs", "taxon_ranks", "trait_value_ids", "trait_keys", "taxon_ancestors"}
+	occurrenceSearchable = []string{"remarks", "traits"}
+	occurrenceSortable   = []string{"created_at", "taxon_label", "owner_name"}
+)
+
+// 並び順 (model.OccurrenceSort*) → 並び替えに使う属性
+// created_at は RFC3339 の文字列なので、文字列順がそのまま時刻順になるのだ
+var searchSortAttributes = map[string]string{
+	model.OccurrenceSortCreated: "created_at",
+	model.OccurrenceSortTaxon:   "taxon_label",
+	model.OccurrenceSortOwner:   "owner_name",
 }
 
 type searchRepository struct {
@@ -32,12 +85,15 @@ type searchRepository struct {
 }
 
 func NewSearchRepository(url, key string) SearchRepository {
-	client := meilisearch.New(url, meilisearch.WithAPIKey(key))
+	client := meilisearch.New(url,
+		meilisearch.WithAPIKey(key),
+		meilisearch.WithCustomClient(&http.Client{Transport: tracing.Transport(nil)}),
+	)
 	indexName := "occurrences"
 
 	// 1. フィルタ可能な属性の設定
 	// taxon_id で絞り込むために、ここに追加が必要なのだ！
-	filterAttributes := []string{"traits", "taxon_label", "is_public", "owner_id", "taxon_id"}
+	filterAttributes := occurrenceFilterable
 	
 	// ライブラリのバージョンによっては []string をそのまま渡せるけど、既存コードに合わせて interface変換しているのだ
 	convertedAttributes := make([]interface{}, len(filterAttributes))
@@ -48,9 +104,13 @@ func NewSearchRepository(url, key string) SearchRepository {
 	
 	// 2. ★検索対象（キーワード検索）の属性設定
 	// ここを設定することで、query検索が taxon_label を無視して remarks と traits だけを見るようになるのだ
-	searchableAttributes := []string{"remarks", "traits"}
+	searchableAttributes := occurrenceSearchable
 	client.Index(indexName).UpdateSearchableAttributes(&searchableAttributes)
 
+	// 一覧の並び替えに使う属性 (created_at が無い古いドキュメントは cmd/reindex で入れ直す)
+	sortableAttributes := occurrenceSortable
+	client.Index(indexName).UpdateSortableAttributes(&sortableAttributes)
+
 	// Primary Keyの設定
 	client.Index(indexName).UpdateIndex(&meilisearch.UpdateIndexRequestParams{
 		PrimaryKey: "id",
@@ -62,7 +122,8 @@ func NewSearchRepository(url, key string) SearchRepository {
 	}
 }
 
-func (r *searchRepository) IndexOccurrence(req model.OccurrenceRequest, uri string, ownerID, ownerName string) error {
+// NewOccurrenceDocument: 記録1件分の検索用ドキュメント (lineage は分類群の系統、無ければ nil)
+func NewOccurrenceDocument(req model.OccurrenceRequest, uri string, ownerID, ownerName, createdAt string, lineage []model.TaxonAncestor) OccurrenceDocument {
 	doc := OccurrenceDocument{
 		ID:         getIDFromURI(uri),
 		TaxonID:    req.TaxonID,
@@ -72,60 +133,128 @@ func (r *searchRepository) IndexOccurrence(req model.OccurrenceRequest, uri stri
 		OwnerID:    ownerID,
 		OwnerName:  ownerName,
 		IsPublic:   req.IsPublic,
+		CreatedAt:  createdAt,
+		TraitPairs: make([]string, 0, len(req.Traits)),
+
+		TraitValueIDs: make([]string, 0, len(req.Traits)),
+		TraitKeys:     make([]string, 0, len(req.Traits)),
 	}
 	
 	for _, t := range req.Traits {
+		pair := fmt.Sprintf("%s: %s", t.PredicateLabel, t.ValueLabel)
 		doc.Traits = append(doc.Traits, t.ValueLabel)
 		doc.Traits = append(doc.Traits, t.PredicateLabel)
-		doc.Traits = append(doc.Traits, fmt.Sprintf("%s: %s", t.PredicateLabel, t.ValueLabel))
+		doc.Traits = append(doc.Traits, pair)
+		doc.TraitPairs = append(doc.TraitPairs, pair)
+
+		if t.ValueID != "" {
+			doc.TraitValueIDs = append(doc.TraitValueIDs, t.ValueID)
+			if t.PredicateID != "" {
+				doc.TraitKeys = append(doc.TraitKeys, model.TraitKey(t.PredicateID, t.ValueID))
+			}
+		}
 	}
+	doc.TaxonAncestors, doc.TaxonRanks = lineageFields(req.TaxonID, lineage)
+	return doc
+}
 
-	_, err := r.client.Index(r.indexName).AddDocuments([]OccurrenceDocument{doc}, nil)
+// lineageFields: 系統から taxon_ancestors と taxon_ranks を作る
+// 系統が無い分類群 (名前だけで登録されたもの) も自分自身の ID では探せるようにしておく
+func lineageFields(taxonID string, lineage []model.TaxonAncestor) ([]string, map[string]string) {
+	ancestors := make([]string, 0, len(lineage)+1)
+	ranks := make(map[string]string)
+	for _, a := range lineage {
+		ancestors = append(ancestors, a.ID)
+		if a.Rank != "" && a.Label != "" {
+			ranks[a.Rank] = a.Label
+		}
+	}
+	if len(ancestors) == 0 && taxonID != "" {
+		ancestors = append(ancestors, taxonID)
+	}
+	return ancestors, ranks
+}
+
+func (r *searchRepository) IndexOccurrence(ctx context.Context, doc OccurrenceDocument) (err error) {
+	ctx, span := r.startSpan(ctx, "index")
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveSearch("index", time.Now(), &err)
+
+	_, err = r.client.Index(r.indexName).AddDocumentsWithContext(ctx, []OccurrenceDocument{doc}, nil)
 	if err != nil {
 		return fmt.Errorf("meilisearch indexing failed: %w", err)
 	}
 	return nil
 }
 
-func (r *searchRepository) DeleteOccurrence(uri string) error {
+func (r *searchRepository) DeleteOccurrence(ctx context.Context, uri string) (err error) {
+	ctx, span := r.startSpan(ctx, "delete")
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveSearch("delete", time.Now(), &err)
+
 	id := getIDFromURI(uri)
-	_, err := r.client.Index(r.indexName).DeleteDocument(id)
+	_, err = r.client.Index(r.indexName).DeleteDocumentWithContext(ctx, id)
 	return err
 }
 
-func (r *searchRepository) Search(query string, currentUserID string, targetTaxonIDs []string) ([]OccurrenceDocument, error) {
+func (r *searchRepository) Search(ctx context.Context, filter model.OccurrenceSearchFilter, currentUserID string, taxonAncestorID string, traits []model.TraitClause) (page *SearchPage, err error) {
+	ctx, span := r.startSpan(ctx, "search")
+	defer func() {
+		if page != nil {
+			span.SetAttributes(attribute.Int("meili.hits", len(page.Docs)))
+		}
+		tracing.End(span, err)
+	}()
+	defer metrics.ObserveSearch("search", time.Now(), &err)
+
 	// フィルタリングロジック
-	filter := "is_public = true"
+	visFilter := "is_public = true"
 	if currentUserID != "" {
-		filter = fmt.Sprintf("(is_public = true OR owner_id = '%s')", currentUserID)
+		visFilter = fmt.Sprintf("(is_public = true OR owner_id = %s)", quoteFilterValue(currentUserID))
 	}
 
-	if len(targetTaxonIDs) > 0 {
-		// IN ["ncbi:1", "ncbi:2", ...] の形式を作る
-		// 文字列の配列を ' で囲んでカンマ区切りにする
-		quotedIDs := make([]string, len(targetTaxonIDs))
-		for i, id := range targetTaxonIDs {
-			quotedIDs[i] = fmt.Sprintf("'%s'", id)
+	if taxonAncestorID != "" {
+		// 子孫は索引に入れるときに祖先のIDを持たせてあるので、1つのIDで絞り込めるのだ
+		visFilter = fmt.Sprintf("%s AND taxon_ancestors = %s", visFilter, quoteFilterValue(taxonAncestorID))
+	}
+	for _, clause := range traits {
+		visFilter = fmt.Sprintf("%s AND %s", visFilter, traitFilter(clause))
+	}
+
+	req := &meilisearch.SearchRequest{
+		Limit:  int64(filter.Limit),
+		Offset: int64(filter.Offset),
+		Filter: visFilter,
+	}
+	for _, name := range filter.Facets {
+		if attr := facetAttribute(name); attr != "" {
+			req.Facets = append(req.Facets, attr)
 		}
-		inFilter := fmt.Sprintf("taxon_id IN [%s]", strings.Join(quotedIDs, ", "))
-		
-		filter = fmt.Sprintf("%s AND %s", filter, inFilter)
+	}
+	if filter.Sort != "" {
+		field, desc := model.SplitOccurrenceSort(filter.Sort)
+		direction := "asc"
+		if desc {
+			direction = "desc"
+		}
+		req.Sort = []string{searchSortAttributes[field] + ":" + direction}
 	}
 
-	// ログ出力（デバッグ用）
-	fmt.Printf("🔎 Meili Filter: %s\n", filter)
+	slog.DebugContext(ctx, "meilisearch search", "filter", visFilter, "sort", req.Sort, "taxon", taxonAncestorID)
 
-	searchRes, err := r.client.Index(r.indexName).Search(query, &meilisearch.SearchRequest{
-		Limit:  50,
-		Filter: filter,
-	})
-	// fmt.Print(searchRes) // デバッグ用出力はコメントアウトしておいたのだ
+	searchRes, err := r.client.Index(r.indexName).SearchWithContext(ctx, filter.Query, req)
 	if err != nil {
 		return nil, err
 	}
 
-	var docs []OccurrenceDocument
-	
+	page = &SearchPage{Total: searchRes.EstimatedTotalHits, Docs: []OccurrenceDocument{}}
+	if len(req.Facets) > 0 {
+		page.Facets, err = decodeFacets(filter.Facets, searchRes.FacetDistribution)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	for _, hit := range searchRes.Hits {
 		data, err := json.Marshal(hit)
 		if err != nil {
@@ -137,10 +266,284 @@ func (r *searchRepository) Search(query string, currentUserID string, targetTaxo
 			continue
 		}
 		
-		docs = append(docs, doc)
+		page.Docs = append(page.Docs, doc)
 	}
 	
-	return docs, nil
+	return page, nil
+}
+
+func (r *searchRepository) SetTaxonLineage(ctx context.Context, taxonID string, lineage []model.TaxonAncestor) (n int, err error) {
+	ctx, span := r.startSpan(ctx, "set_lineage")
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveSearch("index", time.Now(), &err)
+
+	ancestors, ranks := lineageFields(taxonID, lineage)
+
+	// 先にIDを集めてから書き換える (書き換えながらページをめくると順番がずれる)
+	var ids []string
+	const pageSize = 1000
+	for offset := int64(0); ; offset += pageSize {
+		var res meilisearch.DocumentsResult
+		err := r.client.Index(r.indexName).GetDocumentsWithContext(ctx, &meilisearch.DocumentsQuery{
+			Fields: []string{"id"},
+			Filter: "taxon_id = " + quoteFilterValue(taxonID),
+			Limit:  pageSize,
+			Offset: offset,
+		}, &res)
+		if err != nil {
+			return 0, err
+		}
+		var docs []struct {
+			ID string `json:"id"`
+		}
+		if err := res.Results.Decode(&docs); err != nil {
+			return 0, err
+		}
+		for _, d := range docs {
+			ids = append(ids, d.ID)
+		}
+		if len(docs) < pageSize {
+			break
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// 系統の項目だけを部分更新する
+	updates := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		updates = append(updates, map[string]interface{}{
+			"id":              id,
+			"taxon_ancestors": ancestors,
+			"taxon_ranks":     ranks,
+		})
+	}
+	info, err := r.client.Index(r.indexName).UpdateDocumentsWithContext(ctx, updates, nil)
+	if err := r.waitTask(ctx, info, err); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// traitFilter: 形質の条件1つ分のフィルタ
+// (A OR B) は「A の候補のどれか IN」を OR でつなぎ、NOT はド・モルガンで NOT IN の AND にする
+func traitFilter(clause model.TraitClause) string {
+	op, join := "IN", " OR "
+	if clause.Negate {
+		op, join = "NOT IN", " AND "
+	}
+	parts := make([]string, 0, len(clause.Terms))
+	for _, t := range clause.Terms {
+		attr := "trait_value_ids"
+		values := make([]string, 0, len(t.ValueIDs))
+		for _, v := range t.ValueIDs {
+			if t.PredicateID != "" {
+				attr = "trait_keys"
+				v = model.TraitKey(t.PredicateID, v)
+			}
+			values = append(values, quoteFilterValue(v))
+		}
+		if len(values) == 0 {
+			// 記録で使われていない値 (IN [] は書けないので、ありえない値にする)
+			values = append(values, quoteFilterValue("NO_HIT"))
+		}
+		parts = append(parts, fmt.Sprintf("%s %s [%s]", attr, op, strings.Join(values, ", ")))
+	}
+	return "(" + strings.Join(parts, join) + ")"
+}
+
+// quoteFilterValue: フィルタの文字列を ' で囲む (中の ' と \ はエスケープする)
+func quoteFilterValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// facetAttribute: facets= の項目名 → 数える属性 (知らない名前は空)
+func facetAttribute(name string) string {
+	switch name {
+	case model.SearchFacetTaxon:
+		return "taxon_label"
+	case model.SearchFacetTrait:
+		return "trait_pairs"
+	case model.SearchFacetOwner:
+		return "owner_name"
+	case model.SearchFacetVisibility:
+		return "is_public"
+	}
+	for _, rank := range model.FacetRanks {
+		if name == rank {
+			return "taxon_ranks." + rank
+		}
+	}
+	return ""
+}
+
+// decodeFacets: Meilisearch の facetDistribution を、facets= の項目名をキーにして詰め直す
+// 公開範囲は true/false ではなく public/private で返す
+func decodeFacets(names []string, raw json.RawMessage) (map[string]map[string]int64, error) {
+	dist := make(map[string]map[string]int64)
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &dist); err != nil {
+			return nil, err
+		}
+	}
+
+	facets := make(map[string]map[string]int64)
+	for _, name := range names {
+		attr := facetAttribute(name)
+		if attr == "" {
+			continue
+		}
+		counts := make(map[string]int64)
+		for value, n := range dist[attr] {
+			if name == model.SearchFacetVisibility {
+				value = map[string]string{"true": "public", "false": "private"}[value]
+			}
+			counts[value] = n
+		}
+		facets[name] = counts
+	}
+	return facets, nil
+}
+
+// IndexedIDs: 今のインデックスに入っているドキュメントの ID (インデックスが無ければ空)
+func (r *searchRepository) IndexedIDs(ctx context.Context) (ids map[string]bool, err error) {
+	ctx, span := r.startSpan(ctx, "list_ids")
+	defer func() { tracing.End(span, err) }()
+
+	ids = make(map[string]bool)
+	exists, err := r.indexExists(ctx, r.indexName)
+	if err != nil || !exists {
+		return ids, err
+	}
+
+	const pageSize = 1000
+	for offset := int64(0); ; offset += pageSize {
+		var res meilisearch.DocumentsResult
+		err := r.client.Index(r.indexName).GetDocumentsWithContext(ctx, &meilisearch.DocumentsQuery{
+			Fields: []string{"id"},
+			Limit:  pageSize,
+			Offset: offset,
+		}, &res)
+		if err != nil {
+			return nil, err
+		}
+		var docs []struct {
+			ID string `json:"id"`
+		}
+		if err := res.Results.Decode(&docs); err != nil {
+			return nil, err
+		}
+		for _, d := range docs {
+			ids[d.ID] = true
+		}
+		if len(docs) < pageSize {
+			return ids, nil
+		}
+	}
+}
+
+// PrepareStaging: 作り直し用のインデックスを空にして、本番と同じ設定にする
+func (r *searchRepository) PrepareStaging(ctx context.Context) (err error) {
+	ctx, span := r.startSpan(ctx, "prepare_staging")
+	defer func() { tracing.End(span, err) }()
+
+	staging := r.stagingName()
+	exists, err := r.indexExists(ctx, staging)
+	if err != nil {
+		return err
+	}
+	if exists {
+		// 前回途中で止まったものが残っている
+		info, err := r.client.DeleteIndexWithContext(ctx, staging)
+		if err := r.waitTask(ctx, info, err); err != nil {
+			return err
+		}
+	}
+	info, err := r.client.CreateIndexWithContext(ctx, &meilisearch.IndexConfig{Uid: staging, PrimaryKey: "id"})
+	if err := r.waitTask(ctx, info, err); err != nil {
+		return err
+	}
+	info, err = r.client.Index(staging).UpdateSettingsWithContext(ctx, &meilisearch.Settings{
+		FilterableAttributes: occurrenceFilterable,
+		SearchableAttributes: occurrenceSearchable,
+		SortableAttributes:   occurrenceSortable,
+	})
+	return r.waitTask(ctx, info, err)
+}
+
+func (r *searchRepository) AddToStaging(ctx context.Context, docs []OccurrenceDocument) (err error) {
+	ctx, span := r.startSpan(ctx, "add_staging")
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveSearch("index", time.Now(), &err)
+
+	info, err := r.client.Index(r.stagingName()).AddDocumentsWithContext(ctx, docs, nil)
+	return r.waitTask(ctx, info, err)
+}
+
+// SwapStaging: 作り直したインデックスを本番と入れ替えて、古いほうを消す
+func (r *searchRepository) SwapStaging(ctx context.Context) (err error) {
+	ctx, span := r.startSpan(ctx, "swap")
+	defer func() { tracing.End(span, err) }()
+
+	// 入れ替えは両方が存在しないとできない
+	exists, err := r.indexExists(ctx, r.indexName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		info, err := r.client.CreateIndexWithContext(ctx, &meilisearch.IndexConfig{Uid: r.indexName, PrimaryKey: "id"})
+		if err := r.waitTask(ctx, info, err); err != nil {
+			return err
+		}
+	}
+
+	swap := []*meilisearch.SwapIndexesParams{{Indexes: []string{r.indexName, r.stagingName()}}}
+	info, err := r.client.SwapIndexesWithContext(ctx, swap)
+	if err := r.waitTask(ctx, info, err); err != nil {
+		return err
+	}
+	info, err = r.client.DeleteIndexWithContext(ctx, r.stagingName())
+	return r.waitTask(ctx, info, err)
+}
+
+func (r *searchRepository) stagingName() string {
+	return r.indexName + "_reindex"
+}
+
+func (r *searchRepository) indexExists(ctx context.Context, uid string) (bool, error) {
+	_, err := r.client.GetIndexWithContext(ctx, uid)
+	var meiliErr *meilisearch.Error
+	if errors.As(err, &meiliErr) && meiliErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// waitTask: Meilisearch のタスクは非同期なので、終わるまで待って失敗ならエラーにする
+func (r *searchRepository) waitTask(ctx context.Context, info *meilisearch.TaskInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	task, err := r.client.WaitForTaskWithContext(ctx, info.TaskUID, 200*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	if task.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf("meilisearch task %d (%s) %s: %s", task.UID, task.Type, task.Status, task.Error.Message)
+	}
+	return nil
+}
+
+// startSpan: Meilisearch 呼び出し1回分の span
+func (r *searchRepository) startSpan(ctx context.Context, op string) (context.Context, trace.Span) {
+	return tracing.StartClient(ctx, "meilisearch "+op,
+		attribute.String("db.system.name", "meilisearch"),
+		attribute.String("db.operation.name", op),
+		attribute.String("db.collection.name", r.indexName),
+	)
 }
 
 func getIDFromURI(uri string) string {
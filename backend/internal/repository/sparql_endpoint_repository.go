@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/logging"
+	"github.com/saku-730/bio-occurrence/backend/internal/metrics"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// ErrSPARQLResultTooLarge: 結果が max_response_bytes を超えた
+var ErrSPARQLResultTooLarge = errors.New("結果が大きすぎるのだ (LIMIT を小さくしてほしいのだ)")
+
+// SPARQLStatusError: Fuseki がエラーを返した (構文エラーなどはそのまま利用者に返す)
+type SPARQLStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *SPARQLStatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+// SPARQLEndpointRepository: 外部の人が書いた SPARQL をそのまま Fuseki に投げる (書き換えはサービス側で済ませておく)
+type SPARQLEndpointRepository interface {
+	Query(ctx context.Context, query, accept string, timeout time.Duration) (*model.SPARQLResult, error)
+}
+
+type sparqlEndpointRepository struct {
+	queryURL  string
+	username  string
+	password  string
+	maxBytes  int64
+	slowQuery time.Duration
+	client    *http.Client
+}
+
+func NewSPARQLEndpointRepository(baseURL, user, pass string, maxBytes int, slowQuery time.Duration) SPARQLEndpointRepository {
+	return &sparqlEndpointRepository{
+		queryURL:  baseURL + "/query",
+		username:  user,
+		password:  pass,
+		maxBytes:  int64(maxBytes),
+		slowQuery: slowQuery,
+		client:    &http.Client{Transport: tracing.Transport(nil)}, // タイムアウトは ctx で決める
+	}
+}
+
+func (r *sparqlEndpointRepository) Query(ctx context.Context, query, accept string, timeout time.Duration) (result *model.SPARQLResult, err error) {
+	start := time.Now()
+	ctx, span := startSPARQLSpan(ctx, "public_query", query)
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveSPARQL("public_query", start, &err)
+	defer func() { logSPARQL(ctx, r.slowQuery, "public_query", query, start, -1, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Fuseki 側でも打ち切ってもらう (fuseki:allowTimeoutOverride が有効な場合だけ効く)
+	data := url.Values{}
+	data.Set("query", query)
+	data.Set("timeout", strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.queryURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", accept)
+	req.SetBasicAuth(r.username, r.password)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	// 1バイト多く読んで、上限を超えたかどうかを判定する
+	body, err := io.ReadAll(io.LimitReader(resp.Body, r.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, &SPARQLStatusError{StatusCode: resp.StatusCode, Message: logging.Truncate(strings.TrimSpace(string(body)), 500)}
+	}
+	if int64(len(body)) > r.maxBytes {
+		return nil, ErrSPARQLResultTooLarge
+	}
+
+	return &model.SPARQLResult{ContentType: resp.Header.Get("Content-Type"), Body: body}, nil
+}
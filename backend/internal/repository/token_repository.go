@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type TokenRepository interface {
+	Create(ctx context.Context, token *model.AuthToken) error
+	Consume(ctx context.Context, tokenHash string, purpose string) (*model.AuthToken, error)
+	InvalidateAll(ctx context.Context, userID string, purpose string) error
+}
+
+type tokenRepository struct {
+	db *sql.DB
+}
+
+func NewTokenRepository(db *sql.DB) TokenRepository {
+	return &tokenRepository{db: db}
+}
+
+func (r *tokenRepository) Create(ctx context.Context, token *model.AuthToken) error {
+	query := `
+		INSERT INTO auth_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	err := r.db.QueryRowContext(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create token failed: %w", err)
+	}
+	return nil
+}
+
+// Consume: 有効 (未使用・期限内) なトークンを使用済みにして返す
+// UPDATE ... RETURNING で1回だけ成功するようにしているので、同時に2回使われても片方しか通らないのだ
+func (r *tokenRepository) Consume(ctx context.Context, tokenHash string, purpose string) (*model.AuthToken, error) {
+	token := &model.AuthToken{}
+
+	query := `
+		UPDATE auth_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND purpose = $2
+		  AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING id, user_id, purpose, token_hash, expires_at, used_at, created_at
+	`
+	err := r.db.QueryRowContext(ctx, query, tokenHash, purpose).Scan(
+		&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// InvalidateAll: そのユーザーの同じ用途の未使用トークンをまとめて無効にする
+func (r *tokenRepository) InvalidateAll(ctx context.Context, userID string, purpose string) error {
+	query := `
+		UPDATE auth_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, purpose)
+	return err
+}
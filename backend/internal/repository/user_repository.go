@@ -2,14 +2,22 @@ package repository
 
 import (
 	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"context"
 	"database/sql"
 	"fmt"
+
+	"github.com/lib/pq"
 )
 
 type UserRepository interface {
-	Create(user *model.User) error
-	FindByEmail(email string) (*model.User, error)
-	FindByID(id string) (*model.User, error)
+	Create(ctx context.Context, user *model.User) error
+	FindByEmail(ctx context.Context, email string) (*model.User, error)
+	FindByID(ctx context.Context, id string) (*model.User, error)
+	UpdatePassword(ctx context.Context, id string, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, id string) error
+	UpdateProfile(ctx context.Context, user *model.User) error
+	// FindUsernames: ID → ユーザー名 (見つからない ID は入らない)
+	FindUsernames(ctx context.Context, ids []string) (map[string]string, error)
 }
 
 type userRepository struct {
@@ -20,15 +28,36 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) Create(user *model.User) error {
+// SELECT する列 (scanUser と順番を合わせること)
+const userColumns = `id, username, email, password_hash, is_superuser, email_verified_at IS NOT NULL, created_at, updated_at,
+	display_name, affiliation, orcid, default_license, default_visibility, preferred_language`
+
+func scanUser(row *sql.Row) (*model.User, error) {
+	user := &model.User{}
+	err := row.Scan(
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.IsSuperuser, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
+		&user.DisplayName, &user.Affiliation, &user.ORCID, &user.DefaultLicense, &user.DefaultVisibility, &user.PreferredLanguage,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) Create(ctx context.Context, user *model.User) error {
 	query := `
 		INSERT INTO users (username, email, password_hash)
 		VALUES ($1, $2, $3)
-		RETURNING id, created_at, updated_at
+		RETURNING id, created_at, updated_at, display_name, affiliation, orcid, default_license, default_visibility, preferred_language
 	`
 	// IDなどはDBが自動生成するので、RETURNINGで受け取る
-	err := r.db.QueryRow(query, user.Username, user.Email, user.PasswordHash).
-		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, user.Username, user.Email, user.PasswordHash).
+		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt,
+			&user.DisplayName, &user.Affiliation, &user.ORCID, &user.DefaultLicense, &user.DefaultVisibility, &user.PreferredLanguage)
 	
 	if err != nil {
 		return fmt.Errorf("create user failed: %w", err)
@@ -36,38 +65,73 @@ func (r *userRepository) Create(user *model.User) error {
 	return nil
 }
 
-func (r *userRepository) FindByEmail(email string) (*model.User, error) {
-	user := &model.User{}
+func (r *userRepository) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	return scanUser(r.db.QueryRowContext(ctx, query, email))
+}
 
-	query := `SELECT id, username, email, password_hash, is_superuser, created_at, updated_at FROM users WHERE email = $1`
-	
-	err := r.db.QueryRow(query, email).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.IsSuperuser, &user.CreatedAt, &user.UpdatedAt,
-	)
+func (r *userRepository) FindByID(ctx context.Context, id string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	return scanUser(r.db.QueryRowContext(ctx, query, id))
+}
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+func (r *userRepository) UpdatePassword(ctx context.Context, id string, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	if _, err := r.db.ExecContext(ctx, query, passwordHash, id); err != nil {
+		return fmt.Errorf("update password failed: %w", err)
 	}
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return nil
 }
 
-func (r *userRepository) FindByID(id string) (*model.User, error) {
-	user := &model.User{}
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id string) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("mark email verified failed: %w", err)
+	}
+	return nil
+}
 
-	query := `SELECT id, username, email, password_hash, is_superuser, created_at, updated_at FROM users WHERE id = $1`
-	
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.IsSuperuser, &user.CreatedAt, &user.UpdatedAt,
-	)
+func (r *userRepository) UpdateProfile(ctx context.Context, user *model.User) error {
+	query := `
+		UPDATE users
+		SET username = $1, display_name = $2, affiliation = $3, orcid = $4,
+		    default_license = $5, default_visibility = $6, preferred_language = $7,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8
+		RETURNING updated_at
+	`
+	err := r.db.QueryRowContext(ctx, query,
+		user.Username, user.DisplayName, user.Affiliation, user.ORCID,
+		user.DefaultLicense, user.DefaultVisibility, user.PreferredLanguage,
+		user.ID,
+	).Scan(&user.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update profile failed: %w", err)
+	}
+	return nil
+}
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+func (r *userRepository) FindUsernames(ctx context.Context, ids []string) (map[string]string, error) {
+	names := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
 	}
+	// RDF の creator から取った ID は UUID の形とは限らないので、文字列で比べる
+	rows, err := r.db.QueryContext(ctx, `SELECT id, username FROM users WHERE id::text = ANY($1)`, pq.Array(ids))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("find usernames failed: %w", err)
 	}
-	return user, nil
+	defer rows.Close()
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
 }
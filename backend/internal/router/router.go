@@ -1,32 +1,85 @@
 package router
 
 import (
+	"github.com/saku-730/bio-occurrence/backend/internal/config"
 	"github.com/saku-730/bio-occurrence/backend/internal/handler"
+	"github.com/saku-730/bio-occurrence/backend/internal/infrastructure"
 	"github.com/saku-730/bio-occurrence/backend/internal/middleware"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// レート制限の予算 (Per の間に Capacity 回まで)
+var (
+	ipBudget       = middleware.RateLimitBudget{Name: "ip", Capacity: 600, Per: time.Minute}     // 認証前にかけるIP単位の上限
+	globalBudget   = middleware.RateLimitBudget{Name: "global", Capacity: 300, Per: time.Minute} // 認証後にかけるAPIキー/ユーザー単位の全体上限
+	readBudget     = middleware.RateLimitBudget{Name: "read", Capacity: 120, Per: time.Minute}
+	searchBudget   = middleware.RateLimitBudget{Name: "search", Capacity: 60, Per: time.Minute}
+	sparqlBudget   = middleware.RateLimitBudget{Name: "sparql", Capacity: 30, Per: time.Minute} // Fuseki を直接叩くので少なめ
+	writeBudget    = middleware.RateLimitBudget{Name: "write", Capacity: 60, Per: time.Minute}
+	loginBudget    = middleware.RateLimitBudget{Name: "login", Capacity: 10, Per: time.Minute}
+	authMailBudget = middleware.RateLimitBudget{Name: "auth_mail", Capacity: 5, Per: 10 * time.Minute} // メールが飛ぶ操作
 )
 
 func SetupRouter(
+	serverCfg config.ServerConfig,
+	tracingCfg config.TracingConfig,
+	uris model.BaseURIs,
 	occHandler *handler.OccurrenceHandler,
+	taxonHandler *handler.TaxonHandler,
+	exportHandler *handler.ExportHandler,
+	reconcileHandler *handler.ReconcileHandler,
 	authHandler *handler.AuthHandler,
+	apiKeyHandler *handler.APIKeyHandler,
+	oidcHandler *handler.OIDCHandler,
+	profileHandler *handler.ProfileHandler,
+	auditHandler *handler.AuditHandler,
+	searchSyncHandler *handler.SearchSyncHandler,
+	reindexHandler *handler.ReindexHandler,
+	sparqlHandler *handler.SPARQLHandler,
+	ldHandler *handler.LinkedDataHandler,
+	healthHandler *handler.HealthHandler,
+	keyAuth middleware.APIKeyAuthenticator,
+	superuserChecker middleware.SuperuserChecker,
+	limiter infrastructure.RateLimitStore,
 ) *gin.Engine {
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// ClientIP (レート制限のキー) は信用するプロキシからの X-Forwarded-For だけ使う
+	if err := r.SetTrustedProxies(serverCfg.TrustedProxies); err != nil {
+		log.Fatalf("❌ trusted_proxies の設定に失敗したのだ: %v", err)
+	}
+
+	r.Use(middleware.RequestID())
+	// リクエストごとの span (ルートのテンプレートが span 名になる)。アクセスログに trace_id が付くよう先に入れる
+	r.Use(otelgin.Middleware(tracingCfg.ServiceName, otelgin.WithFilter(traced)))
+	r.Use(middleware.AccessLog())
+	r.Use(middleware.Metrics())
 
 	r.Use(cors.New(cors.Config{
-		// AllowOrigins ではなく AllowAllOrigins を使う
-		AllowAllOrigins:  true,
-		
+		// "*" なら AllowAllOrigins、それ以外は設定したオリジンだけ許可
+		AllowAllOrigins:  allowAllOrigins(serverCfg.CORSOrigins),
+		AllowOrigins:     allowedOrigins(serverCfg.CORSOrigins),
+
 		// メソッドも全部許可
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"},
 		
 		// ヘッダーも主要なものは全部許可
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "X-API-Key", "X-Request-ID"},
 		
 		// ブラウザに「OKだよ」と見せるヘッダー
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "X-Total-Count", "X-Next-Cursor", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Link"},
 		
 		// クッキーなどを許可するか（AllOrigins:true の時は false にしないと怒られることがあるので false 推奨）
 		AllowCredentials: false, 
@@ -34,12 +87,51 @@ func SetupRouter(
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// 死活監視 (Kubernetes / docker の healthcheck 用。レート制限はかけない)
+	r.GET("/healthz", healthHandler.Liveness)
+	r.GET("/readyz", healthHandler.Readiness)
+
+	// Prometheus 用
+	// 別のポート (metrics_listen_addr) で出すときは main で待ち受けるので、こちらには載せない。
+	// 同じポートで出すときは metrics_allow のIPからだけ見られるようにする
+	if serverCfg.MetricsListenAddr == "" {
+		r.GET("/metrics", middleware.IPAllowlist(serverCfg.MetricsAllow), gin.WrapH(promhttp.Handler()))
+	}
+
+	// 記録URI (http://my-db.org/occ/<uuid>) の参照解決。uris.occurrence のパス部分で受ける
+	if path, ok := linkedDataPath(uris.Occurrence); ok {
+		r.GET(path+":id", middleware.RateLimitByIP(limiter, ipBudget), middleware.OptionalAuth(keyAuth), middleware.RequireScope(model.ScopeRead), middleware.RateLimit(limiter, globalBudget), middleware.RateLimit(limiter, readBudget), ldHandler.Resolve)
+	} else {
+		slog.Warn("occurrence namespace cannot be served, linked data resolver disabled", "namespace", uris.Occurrence)
+	}
+
 	api := r.Group("/api")
+	// 認証の前はIPでしか数えられないので、ここではIP単位の上限だけかける
+	// (NAT の後ろに大勢いる大学などでも詰まらないよう多めにしてある)。
+	// APIキー/ユーザー単位の全体上限は各グループで認証の後にかける
+	api.Use(middleware.RateLimitByIP(limiter, ipBudget))
+
+	// JSON-LD の @context (認証なし)
+	api.GET("/contexts/occurrence.jsonld", occHandler.JSONLDContext)
 
 	{
-		api.GET("/occurrences", occHandler.GetAll)
-		api.GET("/occurrences/:id", occHandler.GetDetail)
-		api.GET("/search", occHandler.Search)
+		// 閲覧系: ログインしていれば自分の非公開データも見える
+		public := api.Group("/")
+		public.Use(middleware.OptionalAuth(keyAuth), middleware.RequireScope(model.ScopeRead), middleware.RateLimit(limiter, globalBudget))
+		{
+			public.GET("/occurrences", middleware.RateLimit(limiter, readBudget), occHandler.GetAll)
+			public.GET("/occurrences/:id", middleware.RateLimit(limiter, readBudget), occHandler.GetDetail)
+			public.GET("/search", middleware.RateLimit(limiter, searchBudget), occHandler.Search)
+			public.GET("/taxa/:id", middleware.RateLimit(limiter, readBudget), taxonHandler.GetProfile)
+			public.GET("/export/matrix", middleware.RateLimit(limiter, sparqlBudget), exportHandler.Matrix)
+			public.GET("/export/tree", middleware.RateLimit(limiter, sparqlBudget), exportHandler.Tree)
+			public.POST("/taxa/match", middleware.RateLimit(limiter, searchBudget), reconcileHandler.MatchNames)
+			public.GET("/reconcile", middleware.RateLimit(limiter, searchBudget), reconcileHandler.Reconcile)
+			public.POST("/reconcile", middleware.RateLimit(limiter, searchBudget), reconcileHandler.Reconcile)
+			public.GET("/users/:id", middleware.RateLimit(limiter, readBudget), profileHandler.GetPublicProfile)
+			public.GET("/sparql", middleware.RateLimit(limiter, sparqlBudget), sparqlHandler.Query)
+			public.POST("/sparql", middleware.RateLimit(limiter, sparqlBudget), sparqlHandler.Query)
+		}
 
 	//	authorized := api.Group("/")
 	//	authorized.Use(middleware.AuthRequired())
@@ -52,18 +144,95 @@ func SetupRouter(
 
 	auth := api.Group("/auth")
 	{
-		auth.POST("/register", authHandler.Register)
-		auth.POST("/login", authHandler.Login)
+		auth.POST("/register", middleware.RateLimit(limiter, authMailBudget), authHandler.Register)
+		auth.POST("/login", middleware.RateLimit(limiter, loginBudget), authHandler.Login)
+		auth.POST("/forgot", middleware.RateLimit(limiter, authMailBudget), authHandler.ForgotPassword)
+		auth.POST("/reset", middleware.RateLimit(limiter, loginBudget), authHandler.ResetPassword)
+		auth.POST("/verify", middleware.RateLimit(limiter, loginBudget), authHandler.VerifyEmail)
+		auth.POST("/verify/resend", middleware.AuthRequired(keyAuth), middleware.SessionOnly(), middleware.RateLimit(limiter, authMailBudget), authHandler.ResendVerification)
+
+		// 外部IdP (ORCID・大学SSO) でのログイン
+		auth.GET("/oidc", oidcHandler.Providers)
+		auth.GET("/oidc/:provider/login", middleware.RateLimit(limiter, loginBudget), oidcHandler.Login)
+		auth.GET("/oidc/:provider/callback", middleware.RateLimit(limiter, loginBudget), oidcHandler.Callback)
 	}
 		protected := api.Group("/")
-		protected.Use(middleware.AuthRequired())
+		protected.Use(middleware.AuthRequired(keyAuth), middleware.RequireScope(model.ScopeWrite), middleware.RateLimit(limiter, globalBudget), middleware.RateLimit(limiter, writeBudget))
 
 		{
 			protected.POST("/occurrences", occHandler.Create)
 			protected.PUT("/occurrences/:id", occHandler.Update)
 			protected.DELETE("/occurrences/:id", occHandler.Delete)
 		}
+
+		// 自分のプロフィール・設定
+		me := api.Group("/me")
+		me.Use(middleware.AuthRequired(keyAuth), middleware.RateLimit(limiter, globalBudget), middleware.RateLimit(limiter, readBudget))
+		{
+			me.GET("", middleware.RequireScope(model.ScopeRead), profileHandler.GetMe)
+			me.PUT("", middleware.SessionOnly(), profileHandler.UpdateMe)
+			me.PUT("/password", middleware.SessionOnly(), middleware.RateLimit(limiter, loginBudget), profileHandler.ChangePassword)
+		}
+
+		// APIキーの管理はログインセッションからのみ
+		apiKeys := api.Group("/api-keys")
+		apiKeys.Use(middleware.AuthRequired(keyAuth), middleware.SessionOnly(), middleware.RateLimit(limiter, globalBudget), middleware.RateLimit(limiter, writeBudget))
+		{
+			apiKeys.GET("", apiKeyHandler.List)
+			apiKeys.POST("", apiKeyHandler.Create)
+			apiKeys.DELETE("/:id", apiKeyHandler.Revoke)
+		}
+
+		// 管理者 (スーパーユーザー) 専用
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthRequired(keyAuth), middleware.SessionOnly(), middleware.SuperuserRequired(superuserChecker), middleware.RateLimit(limiter, globalBudget), middleware.RateLimit(limiter, readBudget))
+		{
+			admin.GET("/audit", auditHandler.Query)
+			admin.GET("/search-outbox", searchSyncHandler.List)
+			admin.POST("/search-outbox/:id/retry", searchSyncHandler.Retry)
+			admin.GET("/reindex", reindexHandler.Status)
+			admin.POST("/reindex", reindexHandler.Start)
+		}
 	}
 
 	return r
 }
+
+func allowAllOrigins(origins []string) bool {
+	for _, o := range origins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedOrigins: AllowAllOrigins と AllowOrigins を両方セットすると cors が怒るので、全許可のときは nil
+func allowedOrigins(origins []string) []string {
+	if allowAllOrigins(origins) {
+		return nil
+	}
+	return origins
+}
+
+// linkedDataPath: 名前空間のURIからルーティング用のパスを取り出す (/occ/ など)
+// ルート直下や /api 配下と重なる場合は受けない
+func linkedDataPath(namespace string) (string, bool) {
+	u, err := url.Parse(namespace)
+	if err != nil || !strings.HasSuffix(u.Path, "/") {
+		return "", false
+	}
+	if u.Path == "/" || strings.HasPrefix(u.Path, "/api/") {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// traced: ヘルスチェックとメトリクス収集は数秒おきに来るのでトレースしない
+func traced(req *http.Request) bool {
+	switch req.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
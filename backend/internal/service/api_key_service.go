@@ -0,0 +1,144 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// 発行するキーの先頭につける目印 (ログやリポジトリに紛れ込んだときに見つけやすくするため)
+const apiKeyPrefix = "bio_"
+
+type APIKeyService interface {
+	Create(ctx context.Context, userID string, req model.CreateAPIKeyRequest, meta model.RequestMeta) (*model.APIKey, string, error)
+	List(ctx context.Context, userID string) ([]model.APIKey, error)
+	Revoke(ctx context.Context, userID string, id string, meta model.RequestMeta) error
+	Authenticate(ctx context.Context, rawKey string) (*model.APIKey, error)
+}
+
+type apiKeyService struct {
+	repo     repository.APIKeyRepository
+	auditSvc AuditService
+	uris     model.BaseURIs
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, auditSvc AuditService, uris model.BaseURIs) APIKeyService {
+	return &apiKeyService{repo: repo, auditSvc: auditSvc, uris: uris}
+}
+
+// Create: キーを発行する。生のキーはここで一度だけ返し、DBにはハッシュのみ保存する
+func (s *apiKeyService) Create(ctx context.Context, userID string, req model.CreateAPIKeyRequest, meta model.RequestMeta) (_ *model.APIKey, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Create")
+	defer func() { tracing.End(span, err) }()
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if req.ExpiresInDays < 0 {
+		return nil, "", fmt.Errorf("expires_in_days は0以上で指定するのだ")
+	}
+
+	token, _, err := utils.GenerateRandomToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("key generation failed: %w", err)
+	}
+	rawKey := apiKeyPrefix + token
+
+	key := &model.APIKey{
+		UserID:  userID,
+		Name:    req.Name,
+		Prefix:  rawKey[:12],
+		KeyHash: utils.HashToken(rawKey),
+		Scopes:  scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	s.auditSvc.Record(ctx, meta, userID, model.AuditAPIKeyCreate, s.uris.UserURI(userID), nil, map[string]interface{}{
+		"api_key_id": key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"scopes":     key.Scopes,
+		"expires_at": key.ExpiresAt,
+	})
+	return key, rawKey, nil
+}
+
+func (s *apiKeyService) List(ctx context.Context, userID string) (_ []model.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.List")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.ListByUser(ctx, userID)
+}
+
+func (s *apiKeyService) Revoke(ctx context.Context, userID string, id string, meta model.RequestMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Revoke")
+	defer func() { tracing.End(span, err) }()
+
+	ok, err := s.repo.Revoke(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 無い・他人のキー・無効化済みのどれか
+		return ErrNotFound
+	}
+	s.auditSvc.Record(ctx, meta, userID, model.AuditAPIKeyRevoke, s.uris.UserURI(userID), nil, map[string]interface{}{"api_key_id": id})
+	return nil
+}
+
+// Authenticate: ヘッダーで渡されたキーを検証する。無効なら nil を返す
+func (s *apiKeyService) Authenticate(ctx context.Context, rawKey string) (_ *model.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Authenticate")
+	defer func() { tracing.End(span, err) }()
+
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, nil
+	}
+
+	key, err := s.repo.FindActiveByHash(ctx, utils.HashToken(rawKey))
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	// 最終使用日時の更新に失敗しても認証自体は通す
+	if err := s.repo.TouchLastUsed(ctx, key.ID); err != nil {
+		slog.Warn("api key last_used_at update failed", "api_key_id", key.ID, "error", err)
+	}
+	return key, nil
+}
+
+// normalizeScopes: スコープの検証と重複除去。write を持つキーは read もできるようにする
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return []string{model.ScopeRead}, nil
+	}
+
+	hasWrite := false
+	for _, s := range scopes {
+		switch s {
+		case model.ScopeRead:
+		case model.ScopeWrite:
+			hasWrite = true
+		default:
+			return nil, fmt.Errorf("不明なスコープ: %s", s)
+		}
+	}
+
+	if hasWrite {
+		return []string{model.ScopeRead, model.ScopeWrite}, nil
+	}
+	return []string{model.ScopeRead}, nil
+}
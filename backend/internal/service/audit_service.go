@@ -0,0 +1,135 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"context"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+)
+
+// 監査ログ検索の件数上限
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+	auditExportLimit  = 50000
+)
+
+type AuditService interface {
+	Record(ctx context.Context, meta model.RequestMeta, actorID, action, targetURI string, before, after map[string]interface{})
+	Query(ctx context.Context, requesterID string, meta model.RequestMeta, filter model.AuditFilter, export bool) (*model.AuditPage, error)
+}
+
+type auditService struct {
+	repo repository.AuditRepository
+}
+
+func NewAuditService(repo repository.AuditRepository) AuditService {
+	return &auditService{repo: repo}
+}
+
+// Record: 監査ログを1件書き込む
+// 書き込みに失敗しても元の操作は成功しているので、エラーは返さずログに残すだけにする
+// クライアントが途中で切断しても記録は残したいので、ctx のキャンセルは引き継がない
+func (s *auditService) Record(ctx context.Context, meta model.RequestMeta, actorID, action, targetURI string, before, after map[string]interface{}) {
+	ctx = context.WithoutCancel(ctx)
+	entry := &model.AuditEntry{
+		ActorID:   actorID,
+		Action:    action,
+		TargetURI: targetURI,
+		Before:    before,
+		After:     after,
+		IP:        meta.IP,
+		RequestID: meta.RequestID,
+	}
+	if err := s.repo.Insert(ctx, entry); err != nil {
+		slog.Error("audit log write failed", "request_id", meta.RequestID, "action", action, "target", targetURI, "error", err)
+	}
+}
+
+// Query: 監査ログを検索する (スーパーユーザーかどうかはルーター側で確認済み)
+// 検索したこと自体も記録しておく
+func (s *auditService) Query(ctx context.Context, requesterID string, meta model.RequestMeta, filter model.AuditFilter, export bool) (_ *model.AuditPage, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.Query")
+	defer func() { tracing.End(span, err) }()
+
+	maxLimit := auditMaxLimit
+	if export {
+		maxLimit = auditExportLimit
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = auditDefaultLimit
+	}
+	if filter.Limit > maxLimit {
+		filter.Limit = maxLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	entries, total, err := s.repo.Query(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Record(ctx, meta, requesterID, model.AuditAdminQuery, "", nil, map[string]interface{}{
+		"actor_id":   filter.ActorID,
+		"action":     filter.Action,
+		"target_uri": filter.TargetURI,
+		"export":     export,
+		"returned":   len(entries),
+	})
+
+	return &model.AuditPage{Total: total, Entries: entries}, nil
+}
+
+// ---------------------------------------------------
+// Helper (各サービスから使う要約づくり)
+// ---------------------------------------------------
+
+// 要約に入れる備考の最大文字数 (全文はFusekiにあるので、ここでは変化が分かれば十分)
+const auditRemarksMaxLen = 200
+
+func summarizeOccurrenceRequest(req model.OccurrenceRequest) map[string]interface{} {
+	traits := make([]string, 0, len(req.Traits))
+	for _, t := range req.Traits {
+		traits = append(traits, fmt.Sprintf("%s=%s", t.PredicateID, t.ValueID))
+	}
+	return map[string]interface{}{
+		"taxon_id":    req.TaxonID,
+		"taxon_label": req.TaxonLabel,
+		"is_public":   req.IsPublic,
+		"remarks":     truncate(req.Remarks, auditRemarksMaxLen),
+		"traits":      traits,
+	}
+}
+
+func summarizeOccurrenceDetail(d *model.OccurrenceDetail) map[string]interface{} {
+	traits := make([]string, 0, len(d.Traits))
+	for _, t := range d.Traits {
+		traits = append(traits, fmt.Sprintf("%s=%s", t.PredicateID, t.ValueID))
+	}
+	return map[string]interface{}{
+		"taxon_label": d.TaxonName,
+		"owner_id":    d.OwnerID,
+		"remarks":     truncate(d.Remarks, auditRemarksMaxLen),
+		"traits":      traits,
+	}
+}
+
+// auditAction: スーパーユーザーが他人のデータを操作した場合は admin. をつける
+func auditAction(action string, byAdmin bool) string {
+	if byAdmin {
+		return model.AuditAdminPrefix + action
+	}
+	return action
+}
+
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max]) + "…"
+}
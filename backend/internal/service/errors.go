@@ -0,0 +1,29 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ハンドラー側でステータスコードを切り替えるための共通エラー
+var (
+	ErrInvalidToken        = errors.New("トークンが無効か、期限切れなのだ")
+	ErrEmailNotVerified    = errors.New("メールアドレスが未確認なので公開データは登録できないのだ")
+	ErrOIDCEmailUnverified = errors.New("IdP でメールアドレスが確認されていないので、同じメールアドレスのアカウントには紐付けられないのだ")
+	ErrWrongPassword       = errors.New("現在のパスワードが違うのだ")
+	ErrNotAcceptable       = errors.New("その形式では結果を返せないのだ")
+	ErrNotFound            = errors.New("見つからないのだ")
+	ErrReindexRunning      = errors.New("検索インデックスの作り直しがすでに動いているのだ")
+	ErrInvalidCursor       = errors.New("cursor が不正か、並び順と合っていないのだ")
+	ErrInvalidTrait        = errors.New("trait は 述語ID:値ID か 値ID の形で指定するのだ (例: RO:0000053:PATO:0000014)")
+)
+
+// LoginLockedError: ログイン失敗が続いて一時的にロックされている
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("ログイン失敗が続いたため、%s までロックされているのだ", e.Until.Format("15:04:05"))
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"context"
+	"sort"
+	"strings"
+)
+
+// ExportService: 系統比較の解析に使う形式での書き出し
+// 見てよい記録 (公開のものと、ログインしていれば自分のもの) だけを使うのだ
+type ExportService interface {
+	// TraitMatrix: 分類群 × 形質の行列を作る (書き出しの形式には依らない)
+	TraitMatrix(ctx context.Context, filter model.TraitMatrixFilter, currentUserID string) (*model.TraitMatrix, error)
+	// TaxonTree: 記録のある分類群の系統樹を作る (書き出しの形式には依らない)
+	TaxonTree(ctx context.Context, filter model.TaxonTreeFilter, currentUserID string) (*model.TaxonTree, error)
+}
+
+type exportService struct {
+	repo    repository.OccurrenceRepository
+	lineage TaxonLineageCache
+}
+
+func NewExportService(repo repository.OccurrenceRepository, lineage TaxonLineageCache) ExportService {
+	return &exportService{repo: repo, lineage: lineage}
+}
+
+func (s *exportService) TraitMatrix(ctx context.Context, filter model.TraitMatrixFilter, currentUserID string) (_ *model.TraitMatrix, err error) {
+	ctx, span := tracing.Start(ctx, "ExportService.TraitMatrix")
+	defer func() { tracing.End(span, err) }()
+
+	scopeID := ""
+	if strings.TrimSpace(filter.Taxon) != "" {
+		if scopeID, err = resolveTaxonID(ctx, s.repo, filter.Taxon); err != nil {
+			return nil, err
+		}
+	}
+	predicates := make(map[string]bool)
+	for _, p := range filter.Predicates {
+		if p = strings.TrimSpace(p); p != "" {
+			predicates[utils.ShortenTermID(utils.ExpandTermID(p))] = true
+		}
+	}
+
+	rows, err := s.repo.FindTaxonTraitStates(ctx, scopeID, currentUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &model.TraitMatrix{Rank: filter.Rank, Unplaced: []string{}}
+	taxa := make(map[string]model.MatrixTaxon)
+	characters := make(map[string]*model.MatrixCharacter)
+	states := make(map[string]map[string]model.MatrixState) // 述語 → 値 → 状態
+	cells := make(map[string]map[string]map[string]bool)     // 分類群 → 述語 → 値
+	unplaced := make(map[string]bool)
+
+	for _, row := range rows {
+		if len(predicates) > 0 && !predicates[row.PredicateID] {
+			continue
+		}
+		taxon, ok, err := s.matrixTaxon(ctx, row, filter.Rank)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			unplaced[row.TaxonID] = true
+			continue
+		}
+		taxa[taxon.ID] = taxon
+
+		if _, ok := characters[row.PredicateID]; !ok {
+			characters[row.PredicateID] = &model.MatrixCharacter{ID: row.PredicateID, Label: row.PredicateLabel}
+			states[row.PredicateID] = make(map[string]model.MatrixState)
+		}
+		states[row.PredicateID][row.ValueID] = model.MatrixState{ID: row.ValueID, Label: row.ValueLabel}
+
+		if cells[taxon.ID] == nil {
+			cells[taxon.ID] = make(map[string]map[string]bool)
+		}
+		if cells[taxon.ID][row.PredicateID] == nil {
+			cells[taxon.ID][row.PredicateID] = make(map[string]bool)
+		}
+		cells[taxon.ID][row.PredicateID][row.ValueID] = true
+	}
+
+	// 何度書き出しても同じ行列になるように、分類群は名前順、形質と状態は ID 順にする
+	for _, t := range taxa {
+		m.Taxa = append(m.Taxa, t)
+	}
+	sort.Slice(m.Taxa, func(i, j int) bool {
+		if m.Taxa[i].Label != m.Taxa[j].Label {
+			return m.Taxa[i].Label < m.Taxa[j].Label
+		}
+		return m.Taxa[i].ID < m.Taxa[j].ID
+	})
+	stateIndex := make(map[string]map[string]int)
+	for id, c := range characters {
+		for _, st := range states[id] {
+			c.States = append(c.States, st)
+		}
+		sort.Slice(c.States, func(i, j int) bool { return c.States[i].ID < c.States[j].ID })
+		stateIndex[id] = make(map[string]int)
+		for i, st := range c.States {
+			stateIndex[id][st.ID] = i
+		}
+		m.Characters = append(m.Characters, *c)
+	}
+	sort.Slice(m.Characters, func(i, j int) bool { return m.Characters[i].ID < m.Characters[j].ID })
+
+	m.Cells = make([][][]int, len(m.Taxa))
+	for i, t := range m.Taxa {
+		m.Cells[i] = make([][]int, len(m.Characters))
+		for j, c := range m.Characters {
+			for valueID := range cells[t.ID][c.ID] {
+				m.Cells[i][j] = append(m.Cells[i][j], stateIndex[c.ID][valueID])
+			}
+			sort.Ints(m.Cells[i][j])
+		}
+	}
+
+	for id := range unplaced {
+		m.Unplaced = append(m.Unplaced, id)
+	}
+	sort.Strings(m.Unplaced)
+	return m, nil
+}
+
+// matrixTaxon: 行列の行にする分類群 (rank があればその階級の祖先、見つからなければ false)
+// 名前は ncbitaxon にあればそちらを使う (記録の学名は人によって書き方が違うので)
+func (s *exportService) matrixTaxon(ctx context.Context, row model.TaxonTraitState, rank string) (model.MatrixTaxon, bool, error) {
+	lineage, err := s.lineage.Get(ctx, row.TaxonID)
+	if err != nil {
+		return model.MatrixTaxon{}, false, err
+	}
+	if rank == "" {
+		taxon := model.MatrixTaxon{ID: row.TaxonID, Label: row.TaxonLabel}
+		if n := len(lineage); n > 0 && lineage[n-1].ID == row.TaxonID && lineage[n-1].Label != "" {
+			taxon.Label = lineage[n-1].Label
+		}
+		return taxon, true, nil
+	}
+	for _, a := range lineage {
+		if a.Rank == rank {
+			return model.MatrixTaxon{ID: a.ID, Label: a.Label}, true, nil
+		}
+	}
+	return model.MatrixTaxon{}, false, nil
+}
+
+func (s *exportService) TaxonTree(ctx context.Context, filter model.TaxonTreeFilter, currentUserID string) (_ *model.TaxonTree, err error) {
+	ctx, span := tracing.Start(ctx, "ExportService.TaxonTree")
+	defer func() { tracing.End(span, err) }()
+
+	scopeID := ""
+	if strings.TrimSpace(filter.Taxon) != "" {
+		if scopeID, err = resolveTaxonID(ctx, s.repo, filter.Taxon); err != nil {
+			return nil, err
+		}
+	}
+
+	counts, err := s.repo.CountOccurrencesByTaxon(ctx, scopeID, strings.TrimSpace(filter.Owner), currentUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 記録の分類群ごとに根からの系統をたどって、木に足していく
+	tree := &model.TaxonTree{Unplaced: []string{}}
+	nodes := make(map[string]*model.TaxonTreeNode)
+	hasChild := make(map[[2]string]bool)
+	var roots []*model.TaxonTreeNode
+	for taxonID, count := range counts {
+		lineage, err := s.lineage.Get(ctx, taxonID)
+		if err != nil {
+			return nil, err
+		}
+		if len(lineage) == 0 {
+			tree.Unplaced = append(tree.Unplaced, taxonID)
+			continue
+		}
+
+		var parent *model.TaxonTreeNode
+		for _, a := range lineage {
+			node, ok := nodes[a.ID]
+			if !ok {
+				node = &model.TaxonTreeNode{ID: a.ID, Label: a.Label, Rank: a.Rank}
+				nodes[a.ID] = node
+				if parent == nil {
+					roots = append(roots, node)
+				}
+			}
+			if parent != nil && !hasChild[[2]string{parent.ID, node.ID}] {
+				parent.Children = append(parent.Children, node)
+				hasChild[[2]string{parent.ID, node.ID}] = true
+			}
+			parent = node
+		}
+		parent.Direct += count
+	}
+	sort.Strings(tree.Unplaced)
+
+	switch len(roots) {
+	case 0:
+		return tree, nil
+	case 1:
+		tree.Root = roots[0]
+	default:
+		// ncbitaxon なら根は1つのはずだが、念のため名前の無い根でまとめる
+		tree.Root = &model.TaxonTreeNode{Children: roots}
+	}
+	sumTree(tree.Root)
+	tree.Root = collapseTree(tree.Root)
+	return tree, nil
+}
+
+// sumTree: 子孫の記録を足して Total を入れ、子を名前順に並べる
+func sumTree(n *model.TaxonTreeNode) int {
+	n.Total = n.Direct
+	for _, c := range n.Children {
+		n.Total += sumTree(c)
+	}
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Label != n.Children[j].Label {
+			return n.Children[i].Label < n.Children[j].Label
+		}
+		return n.Children[i].ID < n.Children[j].ID
+	})
+	return n.Total
+}
+
+// collapseTree: 子が1つだけで自分の記録も無い節を省く (根から最初に枝分かれする節までもまとめて省く)
+func collapseTree(n *model.TaxonTreeNode) *model.TaxonTreeNode {
+	for i, c := range n.Children {
+		n.Children[i] = collapseTree(c)
+	}
+	if len(n.Children) == 1 && n.Direct == 0 {
+		return n.Children[0]
+	}
+	return n
+}
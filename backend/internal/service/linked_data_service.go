@@ -0,0 +1,96 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"context"
+)
+
+// LinkedDataFormat: 記録URIを参照されたときに返せる文書の形式
+type LinkedDataFormat struct {
+	Ext       string // 文書URLの拡張子 (<記録URI>.ttl など)
+	MediaType string
+}
+
+// LinkedDataFormats: 先頭が Accept 未指定・*/* のときの既定 (ブラウザで開いたら画面に飛ばす)
+var LinkedDataFormats = []LinkedDataFormat{
+	{Ext: "html", MediaType: "text/html"},
+	{Ext: "ttl", MediaType: "text/turtle"},
+	{Ext: "nt", MediaType: "application/n-triples"},
+	{Ext: "rdf", MediaType: "application/rdf+xml"},
+	{Ext: "jsonld", MediaType: "application/ld+json"},
+}
+
+// NegotiateLinkedData: Accept ヘッダーから返す形式を選ぶ
+func NegotiateLinkedData(accept string) (LinkedDataFormat, bool) {
+	offers := make([]string, len(LinkedDataFormats))
+	for i, f := range LinkedDataFormats {
+		offers[i] = f.MediaType
+	}
+	mediaType, ok := negotiate(accept, offers)
+	if !ok {
+		return LinkedDataFormat{}, false
+	}
+	return LinkedDataFormatByMediaType(mediaType)
+}
+
+// LinkedDataFormatByExt: 文書URLの拡張子から形式を引く
+func LinkedDataFormatByExt(ext string) (LinkedDataFormat, bool) {
+	for _, f := range LinkedDataFormats {
+		if f.Ext == ext {
+			return f, true
+		}
+	}
+	return LinkedDataFormat{}, false
+}
+
+func LinkedDataFormatByMediaType(mediaType string) (LinkedDataFormat, bool) {
+	for _, f := range LinkedDataFormats {
+		if f.MediaType == mediaType {
+			return f, true
+		}
+	}
+	return LinkedDataFormat{}, false
+}
+
+// LinkedDataService: 記録URI (http://my-db.org/occ/<uuid>) の参照解決
+// 非公開の記録は持ち主以外には存在しないものとして扱う
+type LinkedDataService interface {
+	CheckVisible(ctx context.Context, userID, id string) error
+	Describe(ctx context.Context, userID, id string, format LinkedDataFormat) (*model.SPARQLResult, error)
+}
+
+type linkedDataService struct {
+	repo repository.OccurrenceRepository
+	uris model.BaseURIs
+}
+
+func NewLinkedDataService(repo repository.OccurrenceRepository, uris model.BaseURIs) LinkedDataService {
+	return &linkedDataService{repo: repo, uris: uris}
+}
+
+// CheckVisible: 見せてよい記録なら nil、そうでなければ ErrNotFound
+func (s *linkedDataService) CheckVisible(ctx context.Context, userID, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "LinkedDataService.CheckVisible")
+	defer func() { tracing.End(span, err) }()
+
+	vis, err := s.repo.FindVisibility(ctx, s.uris.OccurrenceURI(id))
+	if err != nil {
+		return err
+	}
+	if vis == nil || (!vis.Public && (userID == "" || vis.OwnerID != userID)) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *linkedDataService) Describe(ctx context.Context, userID, id string, format LinkedDataFormat) (_ *model.SPARQLResult, err error) {
+	ctx, span := tracing.Start(ctx, "LinkedDataService.Describe")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.CheckVisible(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Describe(ctx, s.uris.OccurrenceURI(id), format.MediaType)
+}
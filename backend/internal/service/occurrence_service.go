@@ -1,45 +1,62 @@
 package service
 
 import (
+	"github.com/saku-730/bio-occurrence/backend/internal/metrics"
 	"github.com/saku-730/bio-occurrence/backend/internal/model"
 	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"strings"
 
 	"github.com/google/uuid"
 )
 
 type OccurrenceService interface {
-	Register(userID string, req model.OccurrenceRequest) (string, error)
-	GetAll(currentUserID string) ([]model.OccurrenceListItem, error)
-	GetDetail(id string) (*model.OccurrenceDetail, error)
-	Modify(userID string, id string, req model.OccurrenceRequest) error
-	Remove(userID string, id string) error
-	GetTaxonStats(rawID string) (*model.TaxonStats, error)
-	Search(query string, taxonQuery string, currentUserID string) ([]repository.OccurrenceDocument, error)
+	Register(ctx context.Context, userID string, req model.OccurrenceRequest, meta model.RequestMeta) (string, error)
+	GetAll(ctx context.Context, currentUserID string, filter model.OccurrenceListFilter) (*model.OccurrenceListPage, error)
+	GetDetail(ctx context.Context, id string, currentUserID string) (*model.OccurrenceDetail, error)
+	Modify(ctx context.Context, userID string, id string, req model.OccurrenceRequest, meta model.RequestMeta) error
+	Remove(ctx context.Context, userID string, id string, meta model.RequestMeta) error
+	Search(ctx context.Context, filter model.OccurrenceSearchFilter, currentUserID string) (*repository.SearchPage, error)
 }
 
 type occurrenceService struct {
 	repo       repository.OccurrenceRepository
 	searchRepo repository.SearchRepository
 	userRepo   repository.UserRepository
+	auditSvc   AuditService
+	searchSync SearchSyncService
+	uris       model.BaseURIs
 }
 
 func NewOccurrenceService(
 	repo repository.OccurrenceRepository,
 	searchRepo repository.SearchRepository,
 	userRepo repository.UserRepository,
+	auditSvc AuditService,
+	searchSync SearchSyncService,
+	uris model.BaseURIs,
 ) OccurrenceService {
 	return &occurrenceService{
 		repo:       repo,
 		searchRepo: searchRepo,
 		userRepo:   userRepo,
+		auditSvc:   auditSvc,
+		searchSync: searchSync,
+		uris:       uris,
 	}
 }
 
-func (s *occurrenceService) Register(userID string, req model.OccurrenceRequest) (string, error) {
+func (s *occurrenceService) Register(ctx context.Context, userID string, req model.OccurrenceRequest, meta model.RequestMeta) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "OccurrenceService.Register")
+	defer func() { tracing.End(span, err) }()
+
 	// 1. ユーザー情報を取得
-	user, err := s.userRepo.FindByID(userID)
+	user, err := s.userRepo.FindByID(ctx, userID)
 	if err != nil {
 		return "", fmt.Errorf("failed to find user: %w", err)
 	}
@@ -47,32 +64,78 @@ func (s *occurrenceService) Register(userID string, req model.OccurrenceRequest)
 		return "", fmt.Errorf("user not found")
 	}
 
+	// 2. メール未確認のユーザーは公開データを登録できない
+	if req.IsPublic && !user.EmailVerified {
+		return "", ErrEmailNotVerified
+	}
+
 	occUUID := uuid.New().String()
-	occURI := "http://my-db.org/occ/" + occUUID
+	occURI := s.uris.OccurrenceURI(occUUID)
 	
-	// 3. Fusekiに保存
-	err = s.repo.Create(occURI, userID, req)
+	// 3. Meilisearch への反映を先に outbox に積んでおく (反映はワーカーがやる)
+	outboxID, err := s.searchSync.Enqueue(ctx, model.SearchOpIndex, occURI)
 	if err != nil {
 		return "", err
 	}
 
-	// 4. Meilisearchにも保存
-	if err := s.searchRepo.IndexOccurrence(req, occURI, user.ID, user.Username); err != nil {
-		return occURI, err 
+	// 4. Fusekiに保存
+	// 失敗したときは Release しない (本当は書けていた場合に備えて、hold が過ぎてから Fuseki の状態に合わせる)
+	err = s.repo.Create(ctx, occURI, userID, req)
+	if err != nil {
+		return "", err
 	}
+	s.searchSync.Release(ctx, outboxID)
+	s.auditSvc.Record(ctx, meta, userID, model.AuditOccurrenceCreate, occURI, nil, summarizeOccurrenceRequest(req))
+	metrics.OccurrenceChanged(metrics.OccurrenceCreated)
 
 	return occURI, nil
 }
 
-func (s *occurrenceService) GetAll(currentUserID string) ([]model.OccurrenceListItem, error) {
-	list, err := s.repo.FindAll(currentUserID)
+func (s *occurrenceService) GetAll(ctx context.Context, currentUserID string, filter model.OccurrenceListFilter) (_ *model.OccurrenceListPage, err error) {
+	ctx, span := tracing.Start(ctx, "OccurrenceService.GetAll")
+	defer func() { tracing.End(span, err) }()
+
+	filter.Limit = clampLimit(filter.Limit, listDefaultLimit, listMaxLimit)
+	if filter.Sort == "" {
+		filter.Sort = "-" + model.OccurrenceSortCreated
+	}
+	var after *model.OccurrenceCursor
+	if filter.Cursor != "" {
+		after, err = decodeCursor(filter.Cursor)
+		if err != nil || after.Sort != filter.Sort {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	// 持ち主の名前順にするときは、名前を先に Postgres から引いてクエリに渡す
+	var ownerNames map[string]string
+	if field, _ := model.SplitOccurrenceSort(filter.Sort); field == model.OccurrenceSortOwner {
+		ids, err := s.repo.FindOwnerIDs(ctx, currentUserID)
+		if err != nil {
+			return nil, err
+		}
+		ownerNames, err = s.userRepo.FindUsernames(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	page, err := s.repo.FindAll(ctx, currentUserID, filter.Sort, after, filter.Limit, ownerNames)
 	if err != nil {
 		return nil, err
 	}
+	if page.Next != nil {
+		page.NextCursor = encodeCursor(page.Next)
+	}
 
+	list := page.Items
 	for i, item := range list {
+		if name, ok := ownerNames[item.OwnerID]; ok {
+			list[i].OwnerName = name
+			continue
+		}
 		if item.OwnerID != "" {
-			user, err := s.userRepo.FindByID(item.OwnerID)
+			user, err := s.userRepo.FindByID(ctx, item.OwnerID)
 			if err == nil && user != nil {
 				list[i].OwnerName = user.Username
 			} else {
@@ -80,12 +143,25 @@ func (s *occurrenceService) GetAll(currentUserID string) ([]model.OccurrenceList
 			}
 		}
 	}
-	return list, nil
+	return page, nil
 }
 
-func (s *occurrenceService) GetDetail(id string) (*model.OccurrenceDetail, error) {
-	targetURI := "http://my-db.org/occ/" + id
-	detail, err := s.repo.FindByID(targetURI)
+func (s *occurrenceService) GetDetail(ctx context.Context, id string, currentUserID string) (_ *model.OccurrenceDetail, err error) {
+	ctx, span := tracing.Start(ctx, "OccurrenceService.GetDetail")
+	defer func() { tracing.End(span, err) }()
+
+	targetURI := s.uris.OccurrenceURI(id)
+
+	// 非公開の記録は持ち主にしか見せない (Linked Data や SPARQL と同じ扱い。無いことにするのだ)
+	vis, err := s.repo.FindVisibility(ctx, targetURI)
+	if err != nil {
+		return nil, err
+	}
+	if vis == nil || (!vis.Public && (currentUserID == "" || vis.OwnerID != currentUserID)) {
+		return nil, nil
+	}
+
+	detail, err := s.repo.FindByID(ctx, targetURI)
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +170,7 @@ func (s *occurrenceService) GetDetail(id string) (*model.OccurrenceDetail, error
 	}
 
 	if detail.OwnerID != "" {
-		user, err := s.userRepo.FindByID(detail.OwnerID)
+		user, err := s.userRepo.FindByID(ctx, detail.OwnerID)
 		if err == nil && user != nil {
 			detail.OwnerName = user.Username
 		} else {
@@ -105,11 +181,14 @@ func (s *occurrenceService) GetDetail(id string) (*model.OccurrenceDetail, error
 	return detail, nil
 }
 
-func (s *occurrenceService) Modify(userID string, id string, req model.OccurrenceRequest) error {
-	targetURI := "http://my-db.org/occ/" + id
+func (s *occurrenceService) Modify(ctx context.Context, userID string, id string, req model.OccurrenceRequest, meta model.RequestMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "OccurrenceService.Modify")
+	defer func() { tracing.End(span, err) }()
+
+	targetURI := s.uris.OccurrenceURI(id)
 
 	// 1. 既存データのチェック (所有権確認)
-	existing, err := s.repo.FindByID(targetURI)
+	existing, err := s.repo.FindByID(ctx, targetURI)
 	if err != nil {
 		return err
 	}
@@ -118,7 +197,7 @@ func (s *occurrenceService) Modify(userID string, id string, req model.Occurrenc
 	}
 	
 	// 操作ユーザー情報の取得 (権限チェックと更新用)
-	user, err := s.userRepo.FindByID(userID)
+	user, err := s.userRepo.FindByID(ctx, userID)
 	if err != nil || user == nil {
 		return fmt.Errorf("failed to find user")
 	}
@@ -128,20 +207,33 @@ func (s *occurrenceService) Modify(userID string, id string, req model.Occurrenc
 		return fmt.Errorf("permission denied: あなたのデータではないのだ")
 	}
 
-	// 3. Fuseki更新
-	if err := s.repo.Update(targetURI, userID, req); err != nil {
+	if req.IsPublic && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+
+	// 3. Meilisearch への反映を outbox に積んでから Fuseki更新
+	outboxID, err := s.searchSync.Enqueue(ctx, model.SearchOpIndex, targetURI)
+	if err != nil {
 		return err
 	}
-	
-	// 4. Meilisearch更新 (ここで user 変数が必要だったのだ！)
-	return s.searchRepo.IndexOccurrence(req, targetURI, user.ID, user.Username)
+	if err := s.repo.Update(ctx, targetURI, userID, req); err != nil {
+		return err
+	}
+	s.searchSync.Release(ctx, outboxID)
+	s.auditSvc.Record(ctx, meta, userID, auditAction(model.AuditOccurrenceUpdate, existing.OwnerID != userID), targetURI,
+		summarizeOccurrenceDetail(existing), summarizeOccurrenceRequest(req))
+	metrics.OccurrenceChanged(metrics.OccurrenceUpdated)
+	return nil
 }
 
-func (s *occurrenceService) Remove(userID string, id string) error {
-	targetURI := "http://my-db.org/occ/" + id
+func (s *occurrenceService) Remove(ctx context.Context, userID string, id string, meta model.RequestMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "OccurrenceService.Remove")
+	defer func() { tracing.End(span, err) }()
+
+	targetURI := s.uris.OccurrenceURI(id)
 	
 	// 所有権チェック
-	existing, err := s.repo.FindByID(targetURI)
+	existing, err := s.repo.FindByID(ctx, targetURI)
 	if err != nil {
 		return err
 	}
@@ -149,7 +241,7 @@ func (s *occurrenceService) Remove(userID string, id string) error {
 		return fmt.Errorf("not found")
 	}
 
-	user, err := s.userRepo.FindByID(userID)
+	user, err := s.userRepo.FindByID(ctx, userID)
 	if err != nil || user == nil {
 		return fmt.Errorf("failed to find user")
 	}
@@ -158,39 +250,170 @@ func (s *occurrenceService) Remove(userID string, id string) error {
 		return fmt.Errorf("permission denied: 他人のデータは消せないのだ")
 	}
 
-	if err := s.repo.Delete(targetURI); err != nil {
+	outboxID, err := s.searchSync.Enqueue(ctx, model.SearchOpDelete, targetURI)
+	if err != nil {
 		return err
 	}
-	
-	return s.searchRepo.DeleteOccurrence(targetURI)
+	if err := s.repo.Delete(ctx, targetURI); err != nil {
+		return err
+	}
+	s.searchSync.Release(ctx, outboxID)
+	s.auditSvc.Record(ctx, meta, userID, auditAction(model.AuditOccurrenceDelete, existing.OwnerID != userID), targetURI,
+		summarizeOccurrenceDetail(existing), nil)
+	metrics.OccurrenceChanged(metrics.OccurrenceDeleted)
+	return nil
 }
 
-func (s *occurrenceService) GetTaxonStats(rawID string) (*model.TaxonStats, error) {
-	safeID := strings.ReplaceAll(rawID, ":", "_")
-	taxonURI := "http://purl.obolibrary.org/obo/" + safeID
-	return s.repo.GetTaxonStats(taxonURI, rawID)
+func (s *occurrenceService) Search(ctx context.Context, filter model.OccurrenceSearchFilter, userID string) (_ *repository.SearchPage, err error) {
+	ctx, span := tracing.Start(ctx, "OccurrenceService.Search")
+	defer func() { tracing.End(span, err) }()
+
+	filter.Limit = clampLimit(filter.Limit, searchDefaultLimit, searchMaxLimit)
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	filter.Facets = uniqueFacets(filter.Facets)
+	// キーワードが無いときは関連度が付かないので新しい順にする
+	if filter.Sort == "" && filter.Query == "" {
+		filter.Sort = "-" + model.OccurrenceSortCreated
+	}
+	taxonID, err := s.resolveTaxonFilter(ctx, filter.Taxon)
+	if err != nil {
+		return nil, err
+	}
+
+	traits, err := s.expandTraitFilters(ctx, filter.Traits)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.searchRepo.Search(ctx, filter, userID, taxonID, traits)
 }
 
-func (s *occurrenceService) Search(query string, taxonQuery string, userID string) ([]repository.OccurrenceDocument, error) {
-	var targetTaxonIDs []string
+// resolveTaxonFilter: taxon= を分類群のIDにする (ID でも名前・別名でもよい)
+// 子孫の記録はインデックスの taxon_ancestors で当たるので、ここで広げなくてよいのだ
+func (s *occurrenceService) resolveTaxonFilter(ctx context.Context, taxonQuery string) (string, error) {
+	taxonQuery = strings.TrimSpace(taxonQuery)
+	if taxonQuery == "" {
+		return "", nil
+	}
+	if id, ok := normalizeTaxonID(taxonQuery); ok {
+		return id, nil
+	}
 
-	if taxonQuery != "" {
-		// GetDescendantIDs は、「そのTaxonおよび子孫」かつ「実際にデータが存在するID」を返してくれる
-		// これにより、データがないIDまで検索クエリに含める無駄を省けるのだ
-		ids, err := s.repo.GetDescendantIDs(taxonQuery)
-		if err == nil && len(ids) > 0 {
-			targetTaxonIDs = ids
-			fmt.Printf("🧠 推論検索: '%s' の子孫を含む %d 件のIDで検索します\n", taxonQuery, len(ids))
-		} else {
-			fmt.Printf("⚠️ 分類名 '%s' に該当するデータ（子孫含む）が見つからなかったのだ\n", taxonQuery)
-			// ヒットなしにするためにダミーを入れるか、空配列のままにして全件検索にならないように制御する
-			// ここでは「空配列＝ヒットなし」として扱うため、明示的にありえない値をセットする手もあるが、
-			// SearchRepo側で len > 0 のときだけフィルタ追加しているので、
-			// フィルタを追加しないと「全件検索」になってしまう恐れがある。
-			// なので、見つからなかった場合は「存在しないID」でフィルタして0件にするのが安全なのだ。
-			targetTaxonIDs = []string{"NO_HIT"} 
+	id, err := s.repo.GetTaxonIDByLabel(ctx, taxonQuery)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		// 空のままだと絞り込みなし (全件) になってしまうので、ありえないIDで0件にするのだ
+		slog.DebugContext(ctx, "taxon label not found for search", "taxon_query", taxonQuery)
+		return "NO_HIT", nil
+	}
+	return id, nil
+}
+
+// expandTraitFilters: trait= を読んで、値を下位クラスまで広げる
+func (s *occurrenceService) expandTraitFilters(ctx context.Context, raw []string) ([]model.TraitClause, error) {
+	var clauses []model.TraitClause
+	expanded := make(map[string][]string) // 同じ値は1回だけ引く
+	for _, r := range raw {
+		clause, err := parseTraitFilter(r)
+		if err != nil {
+			return nil, err
+		}
+		for i, t := range clause.Terms {
+			ids, ok := expanded[t.ValueID]
+			if !ok {
+				ids, err = s.repo.GetTraitValueDescendantIDs(ctx, t.ValueID)
+				if err != nil {
+					return nil, err
+				}
+				expanded[t.ValueID] = ids
+			}
+			clause.Terms[i].ValueIDs = ids
 		}
+		slog.DebugContext(ctx, "trait filter expanded", "trait", r, "negate", clause.Negate, "terms", len(clause.Terms))
+		clauses = append(clauses, clause)
 	}
+	return clauses, nil
+}
 
-	return s.searchRepo.Search(query, userID, targetTaxonIDs)
+// parseTraitFilter: "!RO:0000053:PATO:0000014|PATO:0000320" → NOT (述語つきの条件 OR 値だけの条件)
+func parseTraitFilter(raw string) (model.TraitClause, error) {
+	var clause model.TraitClause
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "!") {
+		clause.Negate = true
+		raw = strings.TrimSpace(raw[1:])
+	}
+	for _, alt := range strings.Split(raw, "|") {
+		parts := strings.Split(strings.TrimSpace(alt), ":")
+		for _, p := range parts {
+			if p == "" {
+				return clause, ErrInvalidTrait
+			}
+		}
+		switch len(parts) {
+		case 2:
+			clause.Terms = append(clause.Terms, model.TraitTerm{ValueID: parts[0] + ":" + parts[1]})
+		case 4:
+			clause.Terms = append(clause.Terms, model.TraitTerm{
+				PredicateID: parts[0] + ":" + parts[1],
+				ValueID:     parts[2] + ":" + parts[3],
+			})
+		default:
+			return clause, ErrInvalidTrait
+		}
+	}
+	return clause, nil
+}
+
+// 一覧・検索の件数 (Meilisearch は offset+limit が maxTotalHits (1000) を超える分は返さない)
+const (
+	listDefaultLimit   = 100
+	listMaxLimit       = 500
+	searchDefaultLimit = 50
+	searchMaxLimit     = 200
+)
+
+// uniqueFacets: 空と重複を除く (facets=trait,,trait など)
+func uniqueFacets(names []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, n := range names {
+		if n != "" && !seen[n] {
+			out = append(out, n)
+			seen[n] = true
+		}
+	}
+	return out
+}
+
+func clampLimit(limit, def, max int) int {
+	if limit <= 0 {
+		return def
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
+
+// カーソルは中身を気にせず使えるよう、JSON を base64url にしただけの文字列にする
+func encodeCursor(c *model.OccurrenceCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*model.OccurrenceCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c model.OccurrenceCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
 }
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 認可リクエストを開始してからコールバックまでの猶予
+const oidcLoginStateTTL = 10 * time.Minute
+
+type OIDCService interface {
+	Providers() []string
+	BeginLogin(ctx context.Context, provider string) (string, error)
+	CompleteLogin(ctx context.Context, provider, code, state string, meta model.RequestMeta) (*model.User, error)
+}
+
+type oidcService struct {
+	providers    map[string]*infrastructure.OIDCProvider
+	userRepo     repository.UserRepository
+	identityRepo repository.IdentityRepository
+	auditSvc     AuditService
+	uris         model.BaseURIs
+}
+
+func NewOIDCService(
+	providers []*infrastructure.OIDCProvider,
+	userRepo repository.UserRepository,
+	identityRepo repository.IdentityRepository,
+	auditSvc AuditService,
+	uris model.BaseURIs,
+) OIDCService {
+	m := make(map[string]*infrastructure.OIDCProvider, len(providers))
+	for _, p := range providers {
+		m[p.Config.Name] = p
+	}
+	return &oidcService{
+		providers:    m,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		auditSvc:     auditSvc,
+		uris:         uris,
+	}
+}
+
+func (s *oidcService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BeginLogin: state / nonce / PKCE verifier を発行して保存し、IdP の認可URLを返す
+func (s *oidcService) BeginLogin(ctx context.Context, providerName string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.BeginLogin")
+	defer func() { tracing.End(span, err) }()
+
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", fmt.Errorf("unknown provider: %s", providerName)
+	}
+
+	state, _, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, _, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, _, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.identityRepo.SaveLoginState(ctx, &model.OIDCLoginState{
+		State:        state,
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcLoginStateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return provider.AuthCodeURL(ctx, state, nonce, verifier)
+}
+
+// CompleteLogin: コールバックを処理して、紐付いているユーザー (無ければ新規作成) を返す
+func (s *oidcService) CompleteLogin(ctx context.Context, providerName, code, state string, meta model.RequestMeta) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.CompleteLogin")
+	defer func() { tracing.End(span, err) }()
+
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s", providerName)
+	}
+
+	saved, err := s.identityRepo.ConsumeLoginState(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if saved == nil || saved.Provider != providerName {
+		return nil, ErrInvalidToken
+	}
+
+	claims, err := provider.Exchange(ctx, code, saved.CodeVerifier, saved.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. 既に紐付いていればそのユーザーでログイン
+	identity, err := s.identityRepo.FindByProviderSubject(ctx, providerName, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := s.userRepo.FindByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, fmt.Errorf("user not found")
+		}
+		s.auditSvc.Record(ctx, meta, user.ID, model.AuditAuthOIDCLogin, s.uris.UserURI(user.ID), nil, map[string]interface{}{
+			"provider": providerName,
+		})
+		return user, nil
+	}
+
+	// 2. IdP が確認済みのメールアドレスと一致するユーザーがいれば紐付ける
+	// 確認されていないメールアドレスは誰でも名乗れるので、既存のアカウントと同じなら断るのだ
+	var user *model.User
+	if claims.Email != "" {
+		user, err = s.userRepo.FindByEmail(ctx, claims.Email)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil && !claims.EmailVerified {
+			return nil, ErrOIDCEmailUnverified
+		}
+	}
+
+	// 3. いなければ新規作成
+	if user == nil {
+		user, err = s.createUser(ctx, provider, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newIdentity := &model.UserIdentity{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	if provider.IsORCID() {
+		newIdentity.ORCID = claims.Subject
+	}
+	if err := s.identityRepo.Create(ctx, newIdentity); err != nil {
+		return nil, err
+	}
+
+	s.auditSvc.Record(ctx, meta, user.ID, model.AuditAuthOIDCLogin, s.uris.UserURI(user.ID), nil, map[string]interface{}{
+		"provider": providerName,
+		"subject":  claims.Subject,
+		"linked":   true,
+	})
+
+	// ORCID でログインしたらプロフィールの ORCID iD も埋めておく
+	if newIdentity.ORCID != "" && user.ORCID == "" {
+		user.ORCID = newIdentity.ORCID
+		if err := s.userRepo.UpdateProfile(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// createUser: IdP の情報からユーザーを作る
+// パスワードは空 (ログイン不可) にしておき、使いたければパスワードリセットで設定してもらう
+func (s *oidcService) createUser(ctx context.Context, provider *infrastructure.OIDCProvider, claims *infrastructure.OIDCClaims) (*model.User, error) {
+	username := claims.Name
+	if username == "" {
+		username = strings.TrimSpace(claims.GivenName + " " + claims.FamilyName)
+	}
+	if username == "" {
+		username = claims.PreferredUsername
+	}
+	if username == "" {
+		username = claims.Subject
+	}
+
+	// ORCID などメールを返さない IdP もあるので、その場合は配送されないダミーアドレスを入れておく
+	email := claims.Email
+	if email == "" {
+		email = fmt.Sprintf("%s@%s.invalid", claims.Subject, provider.Config.Name)
+	}
+
+	user := &model.User{
+		Username: username,
+		Email:    email,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if claims.Email != "" && claims.EmailVerified {
+		if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.EmailVerified = true
+	}
+	return user, nil
+}
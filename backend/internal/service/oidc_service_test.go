@@ -0,0 +1,514 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/infrastructure"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ---------------------------------------------------
+// テスト用の IdP (discovery・JWKS・トークンエンドポイントだけ)
+// ---------------------------------------------------
+
+type mockIdP struct {
+	srv      *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu    sync.Mutex
+	next  int
+	codes map[string]mockGrant // 認可コード → 認可リクエストの内容
+}
+
+// mockGrant: ユーザーが IdP で同意したときの内容
+type mockGrant struct {
+	challenge string // code_challenge (S256)
+	nonce     string
+	claims    map[string]interface{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, clientID: "bio-occurrence", codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                idp.srv.URL,
+			"authorization_endpoint":                idp.srv.URL + "/authorize",
+			"token_endpoint":                        idp.srv.URL + "/token",
+			"jwks_uri":                              idp.srv.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+// authorize: ユーザーが認可URLを開いて同意したことにして、認可コードを返す
+func (idp *mockIdP) authorize(t *testing.T, authURL string, claims map[string]interface{}) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("auth URL has no S256 PKCE challenge: %s", authURL)
+	}
+	idp.mu.Lock()
+	idp.next++
+	code = fmt.Sprintf("code-%d", idp.next)
+	idp.codes[code] = mockGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: claims}
+	idp.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+	if !ok {
+		oauthError(w, "invalid_grant")
+		return
+	}
+	// PKCE: code_verifier の S256 が認可リクエストの code_challenge と一致すること
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		oauthError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   idp.srv.URL,
+		"aud":   idp.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": grant.nonce,
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	writeJSON(w, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idp.sign(claims),
+	})
+}
+
+// sign: RS256 の JWT を作る
+func (idp *mockIdP) sign(claims map[string]interface{}) string {
+	enc := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	input := enc(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"}) + "." + enc(claims)
+	sum := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func oauthError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// ---------------------------------------------------
+// リポジトリの代わり (メモリの上だけ)
+// ---------------------------------------------------
+
+type memUserRepo struct {
+	users []*model.User
+}
+
+func (r *memUserRepo) Create(ctx context.Context, user *model.User) error {
+	for _, u := range r.users {
+		if u.Email == user.Email {
+			return errors.New("duplicate email")
+		}
+	}
+	user.ID = fmt.Sprintf("user-%d", len(r.users)+1)
+	copied := *user
+	r.users = append(r.users, &copied)
+	return nil
+}
+
+func (r *memUserRepo) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memUserRepo) FindByID(ctx context.Context, id string) (*model.User, error) {
+	for _, u := range r.users {
+		if u.ID == id {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memUserRepo) UpdatePassword(ctx context.Context, id string, passwordHash string) error {
+	return nil
+}
+
+func (r *memUserRepo) MarkEmailVerified(ctx context.Context, id string) error {
+	for _, u := range r.users {
+		if u.ID == id {
+			u.EmailVerified = true
+		}
+	}
+	return nil
+}
+
+func (r *memUserRepo) UpdateProfile(ctx context.Context, user *model.User) error {
+	for i, u := range r.users {
+		if u.ID == user.ID {
+			copied := *user
+			r.users[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (r *memUserRepo) FindUsernames(ctx context.Context, ids []string) (map[string]string, error) {
+	names := map[string]string{}
+	for _, u := range r.users {
+		names[u.ID] = u.Username
+	}
+	return names, nil
+}
+
+type memIdentityRepo struct {
+	identities []model.UserIdentity
+	states     map[string]*model.OIDCLoginState
+}
+
+func (r *memIdentityRepo) FindByProviderSubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	for _, id := range r.identities {
+		if id.Provider == provider && id.Subject == subject {
+			copied := id
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memIdentityRepo) Create(ctx context.Context, identity *model.UserIdentity) error {
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *memIdentityRepo) SaveLoginState(ctx context.Context, state *model.OIDCLoginState) error {
+	r.states[state.State] = state
+	return nil
+}
+
+func (r *memIdentityRepo) ConsumeLoginState(ctx context.Context, state string) (*model.OIDCLoginState, error) {
+	s, ok := r.states[state]
+	if !ok || time.Now().After(s.ExpiresAt) {
+		return nil, nil
+	}
+	delete(r.states, state)
+	return s, nil
+}
+
+type nopAudit struct{}
+
+func (nopAudit) Record(ctx context.Context, meta model.RequestMeta, actorID, action, targetURI string, before, after map[string]interface{}) {
+}
+
+func (nopAudit) Query(ctx context.Context, requesterID string, meta model.RequestMeta, filter model.AuditFilter, export bool) (*model.AuditPage, error) {
+	return nil, nil
+}
+
+// ---------------------------------------------------
+// テスト
+// ---------------------------------------------------
+
+type oidcFixture struct {
+	idp        *mockIdP
+	svc        OIDCService
+	users      *memUserRepo
+	identities *memIdentityRepo
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	idp := newMockIdP(t)
+	f := &oidcFixture{
+		idp:        idp,
+		users:      &memUserRepo{},
+		identities: &memIdentityRepo{states: map[string]*model.OIDCLoginState{}},
+	}
+	provider := infrastructure.NewOIDCProvider(infrastructure.OIDCProviderConfig{
+		Name:         "mock",
+		IssuerURL:    idp.srv.URL,
+		ClientID:     idp.clientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/mock/callback",
+	})
+	uris := model.BaseURIs{Base: "http://my-db.org/", Occurrence: "http://my-db.org/occ/", User: "http://my-db.org/user/"}
+	f.svc = NewOIDCService([]*infrastructure.OIDCProvider{provider}, f.users, f.identities, nopAudit{}, uris)
+	return f
+}
+
+// login: 認可URLを作って IdP で同意し、コールバックを処理するところまで
+func (f *oidcFixture) login(t *testing.T, claims map[string]interface{}) (*model.User, error) {
+	t.Helper()
+	authURL, err := f.svc.BeginLogin(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := f.idp.authorize(t, authURL, claims)
+	return f.svc.CompleteLogin(context.Background(), "mock", code, state, model.RequestMeta{})
+}
+
+func TestOIDCBeginLoginUsesDiscovery(t *testing.T) {
+	f := newOIDCFixture(t)
+	authURL, err := f.svc.BeginLogin(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// discovery で知った認可エンドポイントに向いていること
+	if got := u.Scheme + "://" + u.Host + u.Path; got != f.idp.srv.URL+"/authorize" {
+		t.Errorf("auth endpoint = %s, want %s/authorize", got, f.idp.srv.URL)
+	}
+	q := u.Query()
+	for key, want := range map[string]string{
+		"client_id":             f.idp.clientID,
+		"response_type":         "code",
+		"redirect_uri":          "http://localhost:8080/api/auth/oidc/mock/callback",
+		"code_challenge_method": "S256",
+	} {
+		if q.Get(key) != want {
+			t.Errorf("%s = %q, want %q", key, q.Get(key), want)
+		}
+	}
+	if !strings.Contains(q.Get("scope"), "openid") {
+		t.Errorf("scope = %q, want openid", q.Get("scope"))
+	}
+
+	// state・nonce・verifier は保存され、challenge は verifier の S256 になっている
+	saved, ok := f.identities.states[q.Get("state")]
+	if !ok {
+		t.Fatalf("state %q was not saved", q.Get("state"))
+	}
+	if saved.Provider != "mock" || saved.Nonce != q.Get("nonce") || saved.Nonce == "" {
+		t.Errorf("saved state = %+v, auth URL nonce = %q", saved, q.Get("nonce"))
+	}
+	sum := sha256.Sum256([]byte(saved.CodeVerifier))
+	if q.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("code_challenge does not match the saved verifier")
+	}
+
+	if _, err := f.svc.BeginLogin(context.Background(), "unknown"); err == nil {
+		t.Error("BeginLogin accepted an unknown provider")
+	}
+}
+
+func TestOIDCDiscoveryFailure(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	provider := infrastructure.NewOIDCProvider(infrastructure.OIDCProviderConfig{Name: "down", IssuerURL: srv.URL, ClientID: "x"})
+	svc := NewOIDCService([]*infrastructure.OIDCProvider{provider}, &memUserRepo{},
+		&memIdentityRepo{states: map[string]*model.OIDCLoginState{}}, nopAudit{}, model.BaseURIs{})
+	if _, err := svc.BeginLogin(context.Background(), "down"); err == nil {
+		t.Error("BeginLogin succeeded without a discovery document")
+	}
+}
+
+func TestOIDCRejectsBadState(t *testing.T) {
+	f := newOIDCFixture(t)
+	claims := map[string]interface{}{"sub": "s1", "email": "a@example.org", "email_verified": true}
+
+	authURL, err := f.svc.BeginLogin(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := f.idp.authorize(t, authURL, claims)
+
+	// 発行していない state
+	if _, err := f.svc.CompleteLogin(context.Background(), "mock", code, "forged", model.RequestMeta{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("forged state: err = %v, want ErrInvalidToken", err)
+	}
+	// 正しい state は1回だけ使える
+	if _, err := f.svc.CompleteLogin(context.Background(), "mock", code, state, model.RequestMeta{}); err != nil {
+		t.Fatalf("first callback: %v", err)
+	}
+	if _, err := f.svc.CompleteLogin(context.Background(), "mock", code, state, model.RequestMeta{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("replayed state: err = %v, want ErrInvalidToken", err)
+	}
+
+	// 期限切れの state
+	authURL, err = f.svc.BeginLogin(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state = f.idp.authorize(t, authURL, claims)
+	f.identities.states[state].ExpiresAt = time.Now().Add(-time.Second)
+	if _, err := f.svc.CompleteLogin(context.Background(), "mock", code, state, model.RequestMeta{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expired state: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestOIDCRejectsBadPKCEAndNonce(t *testing.T) {
+	f := newOIDCFixture(t)
+	claims := map[string]interface{}{"sub": "s1", "email": "a@example.org", "email_verified": true}
+
+	// 保存しておいた verifier と違うものを送ると、IdP がコードの交換を断る
+	authURL, err := f.svc.BeginLogin(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := f.idp.authorize(t, authURL, claims)
+	f.identities.states[state].CodeVerifier = "another-verifier"
+	if _, err := f.svc.CompleteLogin(context.Background(), "mock", code, state, model.RequestMeta{}); err == nil {
+		t.Error("login succeeded with a wrong PKCE verifier")
+	}
+
+	// ID トークンの nonce が認可リクエストのものと違う
+	authURL, err = f.svc.BeginLogin(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state = f.idp.authorize(t, authURL, map[string]interface{}{"sub": "s1", "nonce": "replayed"})
+	if _, err := f.svc.CompleteLogin(context.Background(), "mock", code, state, model.RequestMeta{}); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("nonce mismatch: err = %v", err)
+	}
+
+	if len(f.users.users) != 0 || len(f.identities.identities) != 0 {
+		t.Errorf("failed logins created users %v / identities %v", f.users.users, f.identities.identities)
+	}
+}
+
+func TestOIDCLinksVerifiedEmail(t *testing.T) {
+	f := newOIDCFixture(t)
+	existing := &model.User{Username: "taro", Email: "taro@example.org"}
+	if err := f.users.Create(context.Background(), existing); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := f.login(t, map[string]interface{}{"sub": "idp-1", "email": "taro@example.org", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("logged in as %s, want the existing user %s", user.ID, existing.ID)
+	}
+	if len(f.identities.identities) != 1 || f.identities.identities[0].UserID != existing.ID || f.identities.identities[0].Subject != "idp-1" {
+		t.Errorf("identities = %+v", f.identities.identities)
+	}
+
+	// 2回目からは紐付けた sub で同じユーザーになる (メールアドレスが変わっていても)
+	again, err := f.login(t, map[string]interface{}{"sub": "idp-1", "email": "changed@example.org", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != existing.ID || len(f.identities.identities) != 1 {
+		t.Errorf("second login = %s, identities = %+v", again.ID, f.identities.identities)
+	}
+}
+
+func TestOIDCRejectsUnverifiedEmail(t *testing.T) {
+	f := newOIDCFixture(t)
+	if err := f.users.Create(context.Background(), &model.User{Username: "taro", Email: "taro@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, verified := range map[string]interface{}{"false": false, "missing": nil} {
+		claims := map[string]interface{}{"sub": "attacker-" + name, "email": "taro@example.org"}
+		if verified != nil {
+			claims["email_verified"] = verified
+		}
+		if _, err := f.login(t, claims); !errors.Is(err, ErrOIDCEmailUnverified) {
+			t.Errorf("email_verified %s: err = %v, want ErrOIDCEmailUnverified", name, err)
+		}
+	}
+	if len(f.identities.identities) != 0 || len(f.users.users) != 1 {
+		t.Errorf("unverified email was linked: identities %+v, users %d", f.identities.identities, len(f.users.users))
+	}
+}
+
+func TestOIDCCreatesUser(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	user, err := f.login(t, map[string]interface{}{"sub": "idp-2", "email": "hanako@example.org", "email_verified": true, "name": "Hanako"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "Hanako" || user.Email != "hanako@example.org" || !user.EmailVerified {
+		t.Errorf("created user = %+v", user)
+	}
+
+	// 確認されていないメールアドレスは、新しいアカウントでは使うが確認済みにはしない
+	user, err = f.login(t, map[string]interface{}{"sub": "idp-3", "email": "jiro@example.org", "preferred_username": "jiro"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "jiro" || user.EmailVerified {
+		t.Errorf("created user = %+v", user)
+	}
+	if len(f.identities.identities) != 2 {
+		t.Errorf("identities = %+v", f.identities.identities)
+	}
+}
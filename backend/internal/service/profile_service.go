@@ -0,0 +1,174 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 公開プロフィールに載せる最近のデータの件数
+const recentOccurrenceLimit = 10
+
+type ProfileService interface {
+	GetMe(ctx context.Context, userID string) (*model.User, error)
+	UpdateMe(ctx context.Context, userID string, req model.UpdateProfileRequest, meta model.RequestMeta) (*model.User, error)
+	ChangePassword(ctx context.Context, userID string, req model.ChangePasswordRequest, meta model.RequestMeta) error
+	GetPublicProfile(ctx context.Context, userID string) (*model.PublicProfile, error)
+}
+
+type profileService struct {
+	userRepo repository.UserRepository
+	occRepo  repository.OccurrenceRepository
+	auditSvc AuditService
+	uris     model.BaseURIs
+}
+
+func NewProfileService(userRepo repository.UserRepository, occRepo repository.OccurrenceRepository, auditSvc AuditService, uris model.BaseURIs) ProfileService {
+	return &profileService{userRepo: userRepo, occRepo: occRepo, auditSvc: auditSvc, uris: uris}
+}
+
+func (s *profileService) GetMe(ctx context.Context, userID string) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.GetMe")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	return user, nil
+}
+
+func (s *profileService) UpdateMe(ctx context.Context, userID string, req model.UpdateProfileRequest, meta model.RequestMeta) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.UpdateMe")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.GetMe(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	before := summarizeProfile(user)
+
+	// 指定された項目だけ上書きする
+	if req.Username != nil {
+		user.Username = *req.Username
+	}
+	if req.DisplayName != nil {
+		user.DisplayName = *req.DisplayName
+	}
+	if req.Affiliation != nil {
+		user.Affiliation = *req.Affiliation
+	}
+	if req.ORCID != nil {
+		if *req.ORCID == "" {
+			user.ORCID = ""
+		} else {
+			orcid, err := utils.NormalizeORCID(*req.ORCID)
+			if err != nil {
+				return nil, err
+			}
+			user.ORCID = orcid
+		}
+	}
+	if req.DefaultLicense != nil {
+		user.DefaultLicense = *req.DefaultLicense
+	}
+	if req.DefaultVisibility != nil {
+		user.DefaultVisibility = *req.DefaultVisibility
+	}
+	if req.PreferredLanguage != nil {
+		user.PreferredLanguage = *req.PreferredLanguage
+	}
+
+	if err := s.userRepo.UpdateProfile(ctx, user); err != nil {
+		return nil, err
+	}
+	s.auditSvc.Record(ctx, meta, userID, model.AuditAccountUpdate, s.uris.UserURI(userID), before, summarizeProfile(user))
+	return user, nil
+}
+
+func (s *profileService) ChangePassword(ctx context.Context, userID string, req model.ChangePasswordRequest, meta model.RequestMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.ChangePassword")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.GetMe(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		return ErrWrongPassword
+	}
+
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hashing failed: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, string(hashedPass)); err != nil {
+		return err
+	}
+	s.auditSvc.Record(ctx, meta, userID, model.AuditAuthPasswordChange, s.uris.UserURI(userID), nil, nil)
+	return nil
+}
+
+// GetPublicProfile: 誰でも見られるプロフィール。見つからなければ nil を返す
+func (s *profileService) GetPublicProfile(ctx context.Context, userID string) (_ *model.PublicProfile, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.GetPublicProfile")
+	defer func() { tracing.End(span, err) }()
+
+	// UUID でなければ Postgres に投げるまでもなく存在しない
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, nil
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, nil
+	}
+
+	count, err := s.occRepo.CountPublicByOwner(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	recent, err := s.occRepo.FindPublicByOwner(ctx, user.ID, recentOccurrenceLimit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range recent {
+		recent[i].OwnerName = user.Username
+	}
+
+	return &model.PublicProfile{
+		ID:                    user.ID,
+		Username:              user.Username,
+		DisplayName:           user.DisplayName,
+		Affiliation:           user.Affiliation,
+		ORCID:                 user.ORCID,
+		PublicOccurrenceCount: count,
+		RecentOccurrences:     recent,
+		CreatedAt:             user.CreatedAt,
+	}, nil
+}
+
+func summarizeProfile(u *model.User) map[string]interface{} {
+	return map[string]interface{}{
+		"username":           u.Username,
+		"display_name":       u.DisplayName,
+		"affiliation":        u.Affiliation,
+		"orcid":              u.ORCID,
+		"default_license":    u.DefaultLicense,
+		"default_visibility": u.DefaultVisibility,
+		"preferred_language": u.PreferredLanguage,
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// 照合の種類ごとのスコア。あいまい検索はどんなに似ていても名前の一致より下にする
+const (
+	nameScoreExact   = 1.0
+	nameScoreSynonym = 0.9
+	nameScoreFuzzy   = 0.85 // × 名前の似ている度合い
+	nameFuzzyMinimum = 0.5  // 似ている度合いがこれ未満の候補は出さない
+)
+
+// OpenRefine で照合する型 (分類群だけ)
+var ReconcileTaxonType = model.ReconcileType{ID: "taxon", Name: "Taxon"}
+
+// ReconcileService: 学名の照合 (古い表計算ファイルの学名を NCBITaxon の ID に結びつける)
+type ReconcileService interface {
+	// MatchNames: 学名ごとの候補をスコアの高い順に、names と同じ順で返す (limit が 0 なら既定の数)
+	MatchNames(ctx context.Context, names []string, limit int) ([]model.NameMatchResult, error)
+	// Reconcile: OpenRefine の queries にまとめて答える
+	Reconcile(ctx context.Context, queries map[string]model.ReconcileQuery) (map[string]model.ReconcileResult, error)
+}
+
+type reconcileService struct {
+	repo      repository.OccurrenceRepository
+	classRepo repository.ClassificationRepository
+}
+
+func NewReconcileService(repo repository.OccurrenceRepository, classRepo repository.ClassificationRepository) ReconcileService {
+	return &reconcileService{repo: repo, classRepo: classRepo}
+}
+
+func (s *reconcileService) MatchNames(ctx context.Context, names []string, limit int) (_ []model.NameMatchResult, err error) {
+	ctx, span := tracing.Start(ctx, "ReconcileService.MatchNames")
+	defer func() { tracing.End(span, err) }()
+
+	if limit <= 0 {
+		limit = model.NameMatchDefaultLimit
+	}
+	limit = min(limit, model.NameMatchMaxLimit)
+
+	// 名前そのもの (空白だけそろえたもの) と、著者名などを外した形の両方で引く
+	// ncbitaxon の別名には著者名付きのものもあるので、そのままの形も捨てないのだ
+	results := make([]model.NameMatchResult, len(names))
+	keys := make([][]string, len(names))
+	fuzzy := make([]string, len(names))
+	var lookup []string
+	seen := make(map[string]bool)
+	for i, raw := range names {
+		cleaned := utils.CleanTaxonName(raw)
+		canonical := utils.CanonicalTaxonName(raw)
+		results[i] = model.NameMatchResult{Query: raw, Normalized: canonical, Candidates: []model.NameCandidate{}}
+		if canonical == "" {
+			results[i].Normalized = cleaned
+		}
+		fuzzy[i] = results[i].Normalized
+		for _, k := range []string{cleaned, canonical} {
+			if k == "" || slices.Contains(keys[i], k) {
+				continue
+			}
+			keys[i] = append(keys[i], k)
+			if !seen[k] {
+				seen[k] = true
+				lookup = append(lookup, k)
+			}
+		}
+	}
+
+	exact, err := s.repo.FindTaxaByNames(ctx, lookup)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string][]model.TaxonNameHit)
+	for _, h := range exact {
+		byName[h.Name] = append(byName[h.Name], h)
+	}
+
+	// 多めに取って、似ている度合いで並べ直す
+	similar, err := s.classRepo.SearchTaxa(ctx, fuzzy, limit*2)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		found := make(map[string]model.NameCandidate)
+		add := func(c model.NameCandidate) {
+			if cur, ok := found[c.ID]; !ok || c.Score > cur.Score {
+				found[c.ID] = c
+			}
+		}
+
+		for _, k := range keys[i] {
+			for _, h := range byName[k] {
+				c := model.NameCandidate{ID: h.TaxonID, Label: h.Label, MatchedName: h.Name, MatchType: model.NameMatchExact, Score: nameScoreExact}
+				if h.Synonym {
+					c.MatchType, c.Score = model.NameMatchSynonym, nameScoreSynonym
+				}
+				add(c)
+			}
+		}
+
+		ranking := make(map[string]float64)
+		query := strings.ToLower(results[i].Normalized)
+		for _, h := range similar[i] {
+			best, matched := 0.0, ""
+			for _, name := range append([]string{h.Label}, h.Synonyms...) {
+				// 別名の著者名で似ている度合いが下がらないように、同じ形にそろえてから比べる
+				form := utils.CanonicalTaxonName(name)
+				if form == "" {
+					form = name
+				}
+				if sim := nameSimilarity(query, strings.ToLower(form)); sim > best {
+					best, matched = sim, name
+				}
+			}
+			if best < nameFuzzyMinimum {
+				continue
+			}
+			ranking[h.TaxonID] = h.Ranking
+			add(model.NameCandidate{
+				ID:          h.TaxonID,
+				Label:       h.Label,
+				MatchedName: matched,
+				MatchType:   model.NameMatchFuzzy,
+				Score:       math.Round(best*nameScoreFuzzy*1000) / 1000,
+			})
+		}
+
+		candidates := make([]model.NameCandidate, 0, len(found))
+		for _, c := range found {
+			candidates = append(candidates, c)
+		}
+		// 同じスコアなら Meilisearch の順位、それも同じなら名前順
+		sort.Slice(candidates, func(a, b int) bool {
+			ca, cb := candidates[a], candidates[b]
+			if ca.Score != cb.Score {
+				return ca.Score > cb.Score
+			}
+			if ranking[ca.ID] != ranking[cb.ID] {
+				return ranking[ca.ID] > ranking[cb.ID]
+			}
+			return ca.Label < cb.Label
+		})
+		if len(candidates) > limit {
+			candidates = candidates[:limit]
+		}
+		results[i].Candidates = candidates
+	}
+	return results, nil
+}
+
+func (s *reconcileService) Reconcile(ctx context.Context, queries map[string]model.ReconcileQuery) (_ map[string]model.ReconcileResult, err error) {
+	ctx, span := tracing.Start(ctx, "ReconcileService.Reconcile")
+	defer func() { tracing.End(span, err) }()
+
+	// 候補の数は query ごとに違ってよいので、いちばん多いもので引いてから切る
+	keys := make([]string, 0, len(queries))
+	for k := range queries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	names := make([]string, len(keys))
+	limit := 0
+	for i, k := range keys {
+		names[i] = queries[k].Query
+		limit = max(limit, queries[k].Limit)
+	}
+
+	matches, err := s.MatchNames(ctx, names, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]model.ReconcileResult, len(keys))
+	for i, k := range keys {
+		all := matches[i].Candidates
+		candidates := all
+		if n := queries[k].Limit; n > 0 && len(candidates) > n {
+			candidates = candidates[:n]
+		}
+		result := make([]model.ReconcileCandidate, 0, len(candidates))
+		for _, c := range candidates {
+			result = append(result, model.ReconcileCandidate{
+				ID:    strings.TrimPrefix(c.ID, "ncbi:"),
+				Name:  c.Label,
+				Type:  []model.ReconcileType{ReconcileTaxonType},
+				Score: math.Round(c.Score * 100),
+			})
+		}
+		// 名前の一致が1つだけなら、そのまま結びつけてよいことにする (同名の分類群があるときは人が選ぶ)
+		if len(result) > 0 && all[0].MatchType != model.NameMatchFuzzy &&
+			(len(all) == 1 || all[1].MatchType == model.NameMatchFuzzy) {
+			result[0].Match = true
+		}
+		out[k] = model.ReconcileResult{Result: result}
+	}
+	return out, nil
+}
+
+// nameSimilarity: 1 - 編集距離 / 長い方の文字数 (1 なら同じ)
+func nameSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	n := max(len(ra), len(rb))
+	if n == 0 {
+		return 0
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(n)
+}
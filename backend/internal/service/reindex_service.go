@@ -0,0 +1,370 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	reindexBatch      = 500
+	reindexSampleSize = 20
+
+	// 分類が読み込み直されたかを見に行く間隔
+	taxonomyCheckInterval = 5 * time.Minute
+	// 読み込み日時が書かれていない (古い loader で入れた) 分類の版
+	// 系統を付けていない古いインデックスも、これで一度は付け直されるのだ
+	taxonomyUnversioned = "unversioned"
+)
+
+// ReindexService: Fuseki の記録から検索インデックスを丸ごと作り直す
+// 別のインデックスに全件入れてから本番と入れ替えるので、作り直している間も検索は古いインデックスで動く
+// 作り直し中は outbox のワーカーを止めておき、その間の変更は入れ替えた後に反映させるのだ
+type ReindexService interface {
+	// Run: 作り直しが終わるまで待つ (cmd/reindex 用)。progress はバッチごとに呼ばれる
+	Run(ctx context.Context, progress func(model.ReindexReport)) (*model.ReindexReport, error)
+	// Start: 裏で作り直しを始める (管理画面用)。すでに動いていれば ErrReindexRunning
+	Start(ctx context.Context, actorID string, meta model.RequestMeta) error
+	// Status: このプロセスで最後に動かした作り直しの状況 (まだなら nil)
+	Status() *model.ReindexReport
+
+	// RefreshLineage: 記録はそのままで、系統 (taxon_ancestors・taxon_ranks) だけを今の分類で付け直す
+	RefreshLineage(ctx context.Context) (*model.LineageReport, error)
+	// WatchTaxonomy: 分類 (ncbitaxon) が読み込み直されるのを見張って、変わっていたら RefreshLineage する (ctx が終わるまで)
+	WatchTaxonomy(ctx context.Context)
+}
+
+type reindexService struct {
+	occRepo    repository.OccurrenceRepository
+	searchRepo repository.SearchRepository
+	userRepo   repository.UserRepository
+	outbox     repository.SearchOutboxRepository
+	auditSvc   AuditService
+	lineage    TaxonLineageCache
+
+	mu     sync.Mutex
+	status *model.ReindexReport
+}
+
+func NewReindexService(
+	occRepo repository.OccurrenceRepository,
+	searchRepo repository.SearchRepository,
+	userRepo repository.UserRepository,
+	outbox repository.SearchOutboxRepository,
+	auditSvc AuditService,
+	lineage TaxonLineageCache,
+) ReindexService {
+	return &reindexService{
+		occRepo:    occRepo,
+		searchRepo: searchRepo,
+		userRepo:   userRepo,
+		outbox:     outbox,
+		auditSvc:   auditSvc,
+		lineage:    lineage,
+	}
+}
+
+func (s *reindexService) Run(ctx context.Context, progress func(model.ReindexReport)) (*model.ReindexReport, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.rebuild(ctx, progress)
+}
+
+func (s *reindexService) Start(ctx context.Context, actorID string, meta model.RequestMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "ReindexService.Start")
+	defer func() { tracing.End(span, err) }()
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	s.auditSvc.Record(ctx, meta, actorID, model.AuditAdminReindex, "", nil, nil)
+	s.setStatus(model.ReindexReport{Running: true, StartedAt: time.Now()})
+
+	// リクエストが終わっても最後まで続ける
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer unlock()
+		report, err := s.rebuild(ctx, s.setStatus)
+		if err != nil {
+			slog.ErrorContext(ctx, "search reindex failed", "error", err)
+			return
+		}
+		slog.InfoContext(ctx, "search reindex finished", "indexed", report.Indexed, "previous", report.Previous,
+			"missing", report.Missing, "stale", report.Stale, "unresolved_owners", len(report.UnresolvedOwners))
+	}()
+	return nil
+}
+
+func (s *reindexService) Status() *model.ReindexReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status == nil {
+		return nil
+	}
+	report := *s.status
+	return &report
+}
+
+func (s *reindexService) setStatus(report model.ReindexReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = &report
+}
+
+func (s *reindexService) lock(ctx context.Context) (func(), error) {
+	unlock, err := s.outbox.LockForReindex(ctx)
+	if errors.Is(err, repository.ErrReindexRunning) {
+		return nil, ErrReindexRunning
+	}
+	return unlock, err
+}
+
+// rebuild: 作り直しの本体 (ロックは呼び出し側で取っておく)
+// 失敗しても途中までの report を progress に渡してから返す
+func (s *reindexService) rebuild(ctx context.Context, progress func(model.ReindexReport)) (report *model.ReindexReport, err error) {
+	ctx, span := tracing.Start(ctx, "ReindexService.rebuild")
+	defer func() { tracing.End(span, err) }()
+
+	report = &model.ReindexReport{
+		Running:          true,
+		StartedAt:        time.Now(),
+		MissingSample:    []string{},
+		StaleSample:      []string{},
+		UnresolvedOwners: []string{},
+	}
+	notify := func() {
+		if progress != nil {
+			progress(*report)
+		}
+	}
+	defer func() {
+		now := time.Now()
+		report.Running = false
+		report.FinishedAt = &now
+		if err != nil {
+			report.Error = err.Error()
+		}
+		notify()
+	}()
+
+	// 0. 作り直した後は系統も今の分類になるので、版を覚えておく (系統は引き直す)
+	version, err := s.taxonomyVersion(ctx)
+	if err != nil {
+		return report, err
+	}
+	s.lineage.Clear()
+
+	// 1. 比べるために、作り直す前のインデックスの中身を覚えておく
+	previous, err := s.searchRepo.IndexedIDs(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Previous = len(previous)
+
+	// 2. 空のインデックスを用意して、Fuseki の記録を順に入れていく
+	if err := s.searchRepo.PrepareStaging(ctx); err != nil {
+		return report, err
+	}
+
+	owners := make(map[string]string) // 持ち主ID → 名前 (いなければ "")
+	indexed := make(map[string]bool)
+	after := ""
+	for {
+		records, err := s.occRepo.FindPage(ctx, after, reindexBatch)
+		if err != nil {
+			return report, err
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		docs := make([]repository.OccurrenceDocument, 0, len(records))
+		for _, rec := range records {
+			ownerName, err := s.ownerName(ctx, owners, rec.OwnerID, report)
+			if err != nil {
+				return report, err
+			}
+			lineage, err := s.lineage.Get(ctx, rec.TaxonID)
+			if err != nil {
+				return report, err
+			}
+			req := model.OccurrenceRequest{
+				TaxonID:    rec.TaxonID,
+				TaxonLabel: rec.TaxonName,
+				Traits:     rec.Traits,
+				Remarks:    rec.Remarks,
+				IsPublic:   rec.Public,
+			}
+			doc := repository.NewOccurrenceDocument(req, rec.ID, rec.OwnerID, ownerName, rec.CreatedAt, lineage)
+			docs = append(docs, doc)
+			indexed[doc.ID] = true
+		}
+		if err := s.searchRepo.AddToStaging(ctx, docs); err != nil {
+			return report, err
+		}
+
+		report.Indexed += len(docs)
+		notify()
+		after = records[len(records)-1].ID
+	}
+
+	// 3. 入れ替える
+	if err := s.searchRepo.SwapStaging(ctx); err != nil {
+		return report, err
+	}
+
+	// 作り直しには失敗していないので、版が書けなくてもログだけにする (次の見張りで付け直されるだけ)
+	if err := s.outbox.SetLineageVersion(ctx, version); err != nil {
+		slog.WarnContext(ctx, "lineage version update failed", "version", version, "error", err)
+	}
+
+	// 4. ずれを数える
+	report.Missing, report.MissingSample = diffIDs(indexed, previous)
+	report.Stale, report.StaleSample = diffIDs(previous, indexed)
+	return report, nil
+}
+
+func (s *reindexService) RefreshLineage(ctx context.Context) (report *model.LineageReport, err error) {
+	ctx, span := tracing.Start(ctx, "ReindexService.RefreshLineage")
+	defer func() { tracing.End(span, err) }()
+
+	// 作り直しと同時に動くと古い系統で上書きし合うので、同じロックを取る (outbox のワーカーもその間止まる)
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	version, err := s.taxonomyVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.lineage.Clear()
+
+	taxonIDs, err := s.occRepo.FindTaxonIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report = &model.LineageReport{Version: version}
+	for _, taxonID := range taxonIDs {
+		lineage, err := s.lineage.Get(ctx, taxonID)
+		if err != nil {
+			return report, err
+		}
+		n, err := s.searchRepo.SetTaxonLineage(ctx, taxonID, lineage)
+		if err != nil {
+			return report, err
+		}
+		report.Taxa++
+		report.Documents += n
+	}
+
+	// 途中で失敗したら版を書かないので、次の見張りでもう一度最初から付け直される
+	if err := s.outbox.SetLineageVersion(ctx, version); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func (s *reindexService) WatchTaxonomy(ctx context.Context) {
+	slog.InfoContext(ctx, "taxonomy watcher started", "interval", taxonomyCheckInterval)
+	ticker := time.NewTicker(taxonomyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkTaxonomy(ctx)
+		select {
+		case <-ctx.Done():
+			slog.InfoContext(ctx, "taxonomy watcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *reindexService) taxonomyVersion(ctx context.Context) (string, error) {
+	version, err := s.occRepo.GetTaxonomyVersion(ctx)
+	if err != nil || version != "" {
+		return version, err
+	}
+	return taxonomyUnversioned, nil
+}
+
+// checkTaxonomy: 分類の版がインデックスに付けた系統の版と違えば付け直す
+func (s *reindexService) checkTaxonomy(ctx context.Context) {
+	version, err := s.taxonomyVersion(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "taxonomy version lookup failed", "error", err)
+		return
+	}
+	current, err := s.outbox.LineageVersion(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "lineage version lookup failed", "error", err)
+		return
+	}
+	if version == current {
+		return
+	}
+
+	slog.InfoContext(ctx, "taxonomy reloaded, refreshing search lineage", "version", version, "previous", current)
+	report, err := s.RefreshLineage(ctx)
+	if errors.Is(err, ErrReindexRunning) {
+		// 作り直し中ならそちらが今の系統で入れるので、次の見張りで版が揃っているか見ればよい
+		slog.InfoContext(ctx, "lineage refresh skipped, reindex is running")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "lineage refresh failed", "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "lineage refresh finished", "version", report.Version, "taxa", report.Taxa, "documents", report.Documents)
+}
+
+// ownerName: 持ち主の名前 (同じ持ち主は1回だけ引く)
+func (s *reindexService) ownerName(ctx context.Context, cache map[string]string, ownerID string, report *model.ReindexReport) (string, error) {
+	if ownerID == "" {
+		return "", nil
+	}
+	if name, ok := cache[ownerID]; ok {
+		return name, nil
+	}
+	user, err := s.userRepo.FindByID(ctx, ownerID)
+	if err != nil {
+		return "", err
+	}
+	name := ""
+	if user != nil {
+		name = user.Username
+	} else {
+		report.UnresolvedOwners = append(report.UnresolvedOwners, ownerID)
+	}
+	cache[ownerID] = name
+	return name, nil
+}
+
+// diffIDs: a にあって b に無い ID の件数と、見本 (ID 順に最大 reindexSampleSize 件)
+func diffIDs(a, b map[string]bool) (int, []string) {
+	var ids []string
+	for id := range a {
+		if !b[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	sample := ids
+	if len(sample) > reindexSampleSize {
+		sample = sample[:reindexSampleSize]
+	}
+	return len(ids), append([]string{}, sample...)
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/metrics"
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+const (
+	// Fuseki への書き込みが終わるまでワーカーに拾わせない時間 (Fuseki クライアントのタイムアウトより長くする)
+	// 書き込み中に落ちた場合も、この時間が過ぎれば Fuseki の状態に合わせて反映される
+	searchOutboxHold = 2 * time.Minute
+	// 処理中に落ちたときに、別のワーカーが拾い直すまでの時間
+	searchOutboxLease = time.Minute
+	searchSyncBatch   = 50
+	searchSyncTimeout = 30 * time.Second
+
+	searchRetryBase = 5 * time.Second
+	searchRetryMax  = 10 * time.Minute
+)
+
+// SearchSyncService: Fuseki の記録を Meilisearch に写す
+// 記録を変更するときは Enqueue → Fuseki に書く → Release の順に呼び、反映はワーカー (Run) に任せる
+// ワーカーは outbox の操作をそのまま再生するのではなく、Fuseki の今の状態を読んでインデックスに合わせるので、
+// 同じ記録の行が何回処理されても、順番が前後しても最後には揃うのだ
+type SearchSyncService interface {
+	Enqueue(ctx context.Context, operation, occurrenceURI string) (int64, error)
+	Release(ctx context.Context, id int64)
+	Run(ctx context.Context)
+
+	ListOutbox(ctx context.Context, status string, limit int) (*model.SearchOutboxPage, error)
+	RetryOutbox(ctx context.Context, actorID string, meta model.RequestMeta, id int64) error
+}
+
+type searchSyncService struct {
+	outbox      repository.SearchOutboxRepository
+	occRepo     repository.OccurrenceRepository
+	searchRepo  repository.SearchRepository
+	userRepo    repository.UserRepository
+	auditSvc    AuditService
+	lineage     TaxonLineageCache
+	interval    time.Duration
+	maxAttempts int
+	wake        chan struct{}
+}
+
+func NewSearchSyncService(
+	outbox repository.SearchOutboxRepository,
+	occRepo repository.OccurrenceRepository,
+	searchRepo repository.SearchRepository,
+	userRepo repository.UserRepository,
+	auditSvc AuditService,
+	lineage TaxonLineageCache,
+	interval time.Duration,
+	maxAttempts int,
+) SearchSyncService {
+	return &searchSyncService{
+		outbox:      outbox,
+		occRepo:     occRepo,
+		searchRepo:  searchRepo,
+		userRepo:    userRepo,
+		auditSvc:    auditSvc,
+		lineage:     lineage,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+func (s *searchSyncService) Enqueue(ctx context.Context, operation, occurrenceURI string) (int64, error) {
+	return s.outbox.Enqueue(ctx, operation, occurrenceURI, searchOutboxHold)
+}
+
+// Release: 失敗しても hold が過ぎれば拾われるので、ログだけ残す
+func (s *searchSyncService) Release(ctx context.Context, id int64) {
+	ctx = context.WithoutCancel(ctx)
+	if err := s.outbox.Release(ctx, id); err != nil {
+		slog.WarnContext(ctx, "search outbox release failed", "outbox_id", id, "error", err)
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run: ctx が終わるまで outbox を処理し続ける
+func (s *searchSyncService) Run(ctx context.Context) {
+	slog.Info("search sync worker started", "interval", s.interval, "max_attempts", s.maxAttempts)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		// 溜まっていれば続けて処理する
+		for ctx.Err() == nil && s.processBatch(ctx) == searchSyncBatch {
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("search sync worker stopped")
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// processBatch: 拾った件数を返す
+func (s *searchSyncService) processBatch(ctx context.Context) int {
+	// 拾ってから Complete / Fail し終わるまで共有ロックを持っておく
+	// (途中で作り直しの入れ替えが入ると、古いインデックスに反映した分が消えてしまう)
+	unlock, err := s.outbox.LockForSync(ctx)
+	if errors.Is(err, repository.ErrReindexRunning) {
+		// 作り直し中は何も取らない。溜まった行は終わってから処理する
+		return 0
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "search outbox lock failed", "error", err)
+		}
+		return 0
+	}
+	defer unlock()
+
+	entries, err := s.outbox.Claim(ctx, searchSyncBatch, searchOutboxLease)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "search outbox claim failed", "error", err)
+		}
+		return 0
+	}
+	for _, e := range entries {
+		s.process(ctx, e)
+	}
+	return len(entries)
+}
+
+func (s *searchSyncService) process(ctx context.Context, e model.SearchOutboxEntry) {
+	// 終了中でも今の1件は最後までやる
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), searchSyncTimeout)
+	defer cancel()
+
+	err := s.apply(ctx, e)
+	if err == nil {
+		if err := s.outbox.Complete(ctx, e.ID); err != nil {
+			slog.ErrorContext(ctx, "search outbox complete failed", "outbox_id", e.ID, "error", err)
+		}
+		metrics.SearchSyncProcessed(metrics.SearchSynced)
+		return
+	}
+
+	var retryAt *time.Time
+	result := metrics.SearchFailed
+	if e.Attempts < s.maxAttempts {
+		t := time.Now().Add(retryDelay(e.Attempts))
+		retryAt = &t
+		result = metrics.SearchRetry
+	}
+	slog.WarnContext(ctx, "search sync failed", "outbox_id", e.ID, "occurrence_uri", e.OccurrenceURI,
+		"attempts", e.Attempts, "gave_up", retryAt == nil, "error", err)
+	if err := s.outbox.Fail(ctx, e.ID, err.Error(), retryAt); err != nil {
+		slog.ErrorContext(ctx, "search outbox fail update failed", "outbox_id", e.ID, "error", err)
+	}
+	metrics.SearchSyncProcessed(result)
+}
+
+// apply: Fuseki の今の状態をインデックスに写す (記録が無ければインデックスからも消す)
+func (s *searchSyncService) apply(ctx context.Context, e model.SearchOutboxEntry) (err error) {
+	ctx, span := tracing.Start(ctx, "SearchSyncService.apply")
+	defer func() { tracing.End(span, err) }()
+
+	vis, err := s.occRepo.FindVisibility(ctx, e.OccurrenceURI)
+	if err != nil {
+		return err
+	}
+	var detail *model.OccurrenceDetail
+	if vis != nil {
+		detail, err = s.occRepo.FindByID(ctx, e.OccurrenceURI)
+		if err != nil {
+			return err
+		}
+	}
+	if detail == nil {
+		return s.searchRepo.DeleteOccurrence(ctx, e.OccurrenceURI)
+	}
+
+	ownerName := ""
+	if detail.OwnerID != "" {
+		user, err := s.userRepo.FindByID(ctx, detail.OwnerID)
+		if err != nil {
+			return err
+		}
+		if user != nil {
+			ownerName = user.Username
+		}
+	}
+
+	req := model.OccurrenceRequest{
+		TaxonID:    detail.TaxonID,
+		TaxonLabel: detail.TaxonName,
+		Traits:     detail.Traits,
+		Remarks:    detail.Remarks,
+		IsPublic:   vis.Public,
+	}
+	// 上位の分類群で絞り込んだり、絞り込み欄で科・目などを数えたりできるように系統も入れておく
+	lineage, err := s.lineage.Get(ctx, detail.TaxonID)
+	if err != nil {
+		return err
+	}
+	doc := repository.NewOccurrenceDocument(req, e.OccurrenceURI, detail.OwnerID, ownerName, detail.CreatedAt, lineage)
+	return s.searchRepo.IndexOccurrence(ctx, doc)
+}
+
+// retryDelay: 5秒から倍々に延ばして、10分で頭打ち
+func retryDelay(attempts int) time.Duration {
+	d := searchRetryBase
+	for i := 1; i < attempts && d < searchRetryMax; i++ {
+		d *= 2
+	}
+	if d > searchRetryMax {
+		d = searchRetryMax
+	}
+	return d
+}
+
+func (s *searchSyncService) ListOutbox(ctx context.Context, status string, limit int) (_ *model.SearchOutboxPage, err error) {
+	ctx, span := tracing.Start(ctx, "SearchSyncService.ListOutbox")
+	defer func() { tracing.End(span, err) }()
+
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	return s.outbox.List(ctx, status, limit)
+}
+
+func (s *searchSyncService) RetryOutbox(ctx context.Context, actorID string, meta model.RequestMeta, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "SearchSyncService.RetryOutbox")
+	defer func() { tracing.End(span, err) }()
+
+	ok, err := s.outbox.Retry(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	s.auditSvc.Record(ctx, meta, actorID, model.AuditAdminSearchRetry, "", nil, map[string]interface{}{"outbox_id": strconv.FormatInt(id, 10)})
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/sparql"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"context"
+	"log/slog"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 公開 SPARQL で返せる形式 (先頭が Accept 未指定のときの既定)
+var (
+	resultMediaTypes = []string{"application/sparql-results+json", "application/sparql-results+xml", "text/csv", "text/tab-separated-values"}
+	graphMediaTypes  = []string{"text/turtle", "application/n-triples", "application/ld+json", "application/rdf+xml"}
+)
+
+// SPARQLService: 公開 SPARQL エンドポイント
+// 非公開の記録は、持ち主本人が問い合わせた場合以外は見えないように書き換えてから投げる
+type SPARQLService interface {
+	Query(ctx context.Context, userID, query, accept string) (*model.SPARQLResult, error)
+}
+
+type sparqlService struct {
+	repo       repository.SPARQLEndpointRepository
+	uris       model.BaseURIs
+	timeout    time.Duration
+	maxResults int
+}
+
+func NewSPARQLService(repo repository.SPARQLEndpointRepository, uris model.BaseURIs, timeout time.Duration, maxResults int) SPARQLService {
+	return &sparqlService{
+		repo:       repo,
+		uris:       uris,
+		timeout:    timeout,
+		maxResults: maxResults,
+	}
+}
+
+func (s *sparqlService) Query(ctx context.Context, userID, query, accept string) (_ *model.SPARQLResult, err error) {
+	ctx, span := tracing.Start(ctx, "SPARQLService.Query")
+	defer func() { tracing.End(span, err) }()
+
+	restriction := sparql.Restriction{
+		Predicate:      iriVisibility,
+		Hidden:         sparql.String("private"),
+		OwnerPredicate: iriCreator,
+		Namespace:      s.uris.Occurrence,
+		// 自由入力の分類群・形質の値は名前 (ラベル) が記録の中身そのものなので、見てよい記録で使われているものだけ見せる
+		Dependents: []string{
+			s.uris.ResourceURI("user_taxon", ""),
+			s.uris.ResourceURI("user_prop", ""),
+			s.uris.ResourceURI("user_val", ""),
+		},
+		MaxLimit: s.maxResults,
+	}
+	if userID != "" {
+		owner, err := sparql.NewIRI(s.uris.UserURI(userID))
+		if err != nil {
+			return nil, err
+		}
+		restriction.Owner = &owner
+	}
+
+	scoped, err := sparql.Scope(query, restriction)
+	if err != nil {
+		return nil, err
+	}
+
+	offers := resultMediaTypes
+	if scoped.Form == sparql.FormConstruct {
+		offers = graphMediaTypes
+	}
+	mediaType, ok := negotiate(accept, offers)
+	if !ok {
+		return nil, ErrNotAcceptable
+	}
+
+	slog.DebugContext(ctx, "public sparql query", "form", scoped.Form, "limit", scoped.Limit, "media_type", mediaType, "authenticated", userID != "")
+	return s.repo.Query(ctx, scoped.Query, mediaType, s.timeout)
+}
+
+// 隠すかどうかの判定に使う語彙 (occurrenceRepository が書き込むものと同じ)
+var (
+	iriVisibility = sparql.MustIRI("http://my-db.org/data/visibility")
+	iriCreator    = sparql.MustIRI("http://purl.org/dc/terms/creator")
+)
+
+// negotiate: Accept ヘッダーから返す形式を選ぶ (q の大きい順、同じなら書かれた順)
+// application/json は SELECT なら結果の JSON、CONSTRUCT なら JSON-LD として扱う
+func negotiate(accept string, offers []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	type want struct {
+		mediaType string
+		q         float64
+	}
+	var wants []want
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			wants = append(wants, want{mt, q})
+		}
+	}
+	sort.SliceStable(wants, func(a, b int) bool { return wants[a].q > wants[b].q })
+
+	for _, w := range wants {
+		switch {
+		case w.mediaType == "*/*":
+			return offers[0], true
+		case w.mediaType == "application/json":
+			for _, o := range offers {
+				if strings.HasSuffix(o, "+json") {
+					return o, true
+				}
+			}
+		case strings.HasSuffix(w.mediaType, "/*"):
+			prefix := strings.TrimSuffix(w.mediaType, "*")
+			for _, o := range offers {
+				if strings.HasPrefix(o, prefix) {
+					return o, true
+				}
+			}
+		default:
+			for _, o := range offers {
+				if o == w.mediaType {
+					return o, true
+				}
+			}
+		}
+	}
+	return "", false
+}
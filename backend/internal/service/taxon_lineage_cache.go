@@ -0,0 +1,70 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	lineageCacheSize = 10000
+	// 分類を読み込み直したら系統の付け直しのときに消すので、これは別のサーバーで付け直した場合の保険
+	lineageCacheTTL = time.Hour
+)
+
+// TaxonLineageCache: 分類群の系統のキャッシュ
+// 記録をインデックスに入れるたびに ncbitaxon をたどらなくて済むように、同じ分類群は使い回すのだ
+type TaxonLineageCache interface {
+	Get(ctx context.Context, taxonID string) ([]model.TaxonAncestor, error)
+	Clear()
+}
+
+type lineageEntry struct {
+	lineage   []model.TaxonAncestor
+	expiresAt time.Time
+}
+
+type taxonLineageCache struct {
+	repo repository.OccurrenceRepository
+
+	mu      sync.Mutex
+	entries map[string]lineageEntry
+}
+
+func NewTaxonLineageCache(repo repository.OccurrenceRepository) TaxonLineageCache {
+	return &taxonLineageCache{repo: repo, entries: make(map[string]lineageEntry)}
+}
+
+func (c *taxonLineageCache) Get(ctx context.Context, taxonID string) ([]model.TaxonAncestor, error) {
+	c.mu.Lock()
+	e, ok := c.entries[taxonID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expiresAt) {
+		return e.lineage, nil
+	}
+
+	lineage, err := c.repo.GetTaxonLineage(ctx, taxonID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= lineageCacheSize {
+		// いっぱいなら適当に1件捨てる (map の順番はばらばらなので古いものとは限らない)
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[taxonID] = lineageEntry{lineage: lineage, expiresAt: time.Now().Add(lineageCacheTTL)}
+	return lineage, nil
+}
+
+func (c *taxonLineageCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]lineageEntry)
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"github.com/saku-730/bio-occurrence/backend/internal/model"
+	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"context"
+	"strings"
+)
+
+// 分類群のページに載せる自分の記録の件数
+const taxonMyOccurrenceLimit = 50
+
+// TaxonService: 分類群のページ (名前・系統・直下の分類群・形質の集計など)
+type TaxonService interface {
+	// GetProfile: rawID は "ncbi:9606" / "NCBITaxon:9606" か学名 (別名でもよい)。見つからなければ ErrNotFound
+	GetProfile(ctx context.Context, rawID string, currentUserID string) (*model.TaxonProfile, error)
+}
+
+type taxonService struct {
+	repo     repository.OccurrenceRepository
+	userRepo repository.UserRepository
+	lineage  TaxonLineageCache
+}
+
+func NewTaxonService(repo repository.OccurrenceRepository, userRepo repository.UserRepository, lineage TaxonLineageCache) TaxonService {
+	return &taxonService{repo: repo, userRepo: userRepo, lineage: lineage}
+}
+
+func (s *taxonService) GetProfile(ctx context.Context, rawID string, currentUserID string) (_ *model.TaxonProfile, err error) {
+	ctx, span := tracing.Start(ctx, "TaxonService.GetProfile")
+	defer func() { tracing.End(span, err) }()
+
+	taxonID, err := resolveTaxonID(ctx, s.repo, rawID)
+	if err != nil {
+		return nil, err
+	}
+
+	taxon, err := s.repo.GetTaxon(ctx, taxonID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := s.repo.SummarizeTaxonOccurrences(ctx, taxonID, currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	// ncbitaxon に無くて、見てよい記録も無い分類群は無いことにする (他人の非公開の記録の名前を出さない)
+	if taxon == nil && summary.Count == 0 {
+		return nil, ErrNotFound
+	}
+
+	profile := &model.TaxonProfile{
+		ID:              taxonID,
+		Label:           summary.Name,
+		Synonyms:        []string{},
+		Lineage:         []model.TaxonAncestor{},
+		OccurrenceCount: summary.Count,
+		FirstObserved:   summary.First,
+		LastObserved:    summary.Last,
+	}
+	if taxon != nil {
+		profile.Label = taxon.Label
+		profile.Rank = taxon.Rank
+		profile.Synonyms = taxon.Synonyms
+	}
+
+	// 系統の最後は自分自身なので外す
+	lineage, err := s.lineage.Get(ctx, taxonID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range lineage {
+		if a.ID != taxonID {
+			profile.Lineage = append(profile.Lineage, a)
+		}
+	}
+
+	if profile.Children, err = s.repo.CountTaxonChildren(ctx, taxonID, currentUserID); err != nil {
+		return nil, err
+	}
+	if profile.Traits, err = s.repo.CountTaxonTraits(ctx, taxonID, currentUserID); err != nil {
+		return nil, err
+	}
+
+	if currentUserID != "" {
+		mine, err := s.repo.FindByTaxonAndOwner(ctx, taxonID, currentUserID, taxonMyOccurrenceLimit)
+		if err != nil {
+			return nil, err
+		}
+		if len(mine) > 0 {
+			if user, err := s.userRepo.FindByID(ctx, currentUserID); err == nil && user != nil {
+				for i := range mine {
+					mine[i].OwnerName = user.Username
+				}
+			}
+		}
+		profile.MyOccurrences = mine
+	}
+	return profile, nil
+}
+
+// resolveTaxonID: ID ならそろえて、名前なら ncbitaxon から引く (見つからなければ ErrNotFound)
+func resolveTaxonID(ctx context.Context, repo repository.OccurrenceRepository, rawID string) (string, error) {
+	rawID = strings.TrimSpace(rawID)
+	if id, ok := normalizeTaxonID(rawID); ok {
+		return id, nil
+	}
+	if rawID == "" {
+		return "", ErrNotFound
+	}
+	id, err := repo.GetTaxonIDByLabel(ctx, rawID)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", ErrNotFound
+	}
+	return id, nil
+}
+
+// normalizeTaxonID: "NCBITaxon:9606" も "ncbi:9606" も同じIDにそろえる (IDに見えなければ false)
+func normalizeTaxonID(raw string) (string, bool) {
+	if !strings.Contains(raw, ":") || strings.Contains(raw, " ") {
+		return "", false
+	}
+	return utils.ShortenTermID(utils.ExpandTermID(raw)), true
+}
@@ -1,30 +1,73 @@
 package service
 
 import (
+	"github.com/saku-730/bio-occurrence/backend/internal/infrastructure"
 	"github.com/saku-730/bio-occurrence/backend/internal/model"
 	"github.com/saku-730/bio-occurrence/backend/internal/repository"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
+	"github.com/saku-730/bio-occurrence/backend/internal/utils"
+	"context"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// トークンの有効期限
+const (
+	passwordResetTTL = 1 * time.Hour
+	emailVerifyTTL   = 48 * time.Hour
+)
+
 type AuthService interface {
-	Register(req model.RegisterRequest) (*model.User, error)
-	Login(req model.LoginRequest) (*model.User, error)
+	Register(ctx context.Context, req model.RegisterRequest, meta model.RequestMeta) (*model.User, error)
+	Login(ctx context.Context, req model.LoginRequest, meta model.RequestMeta) (*model.User, error)
+	RequestPasswordReset(ctx context.Context, req model.ForgotPasswordRequest, meta model.RequestMeta) error
+	ResetPassword(ctx context.Context, req model.ResetPasswordRequest, meta model.RequestMeta) error
+	VerifyEmail(ctx context.Context, req model.VerifyEmailRequest, meta model.RequestMeta) error
+	ResendVerification(ctx context.Context, userID string, meta model.RequestMeta) error
+	IsSuperuser(ctx context.Context, userID string) (bool, error)
 }
 
 type authService struct {
-	userRepo repository.UserRepository
+	userRepo   repository.UserRepository
+	tokenRepo  repository.TokenRepository
+	mailer     infrastructure.Mailer
+	limiter    infrastructure.RateLimitStore // ログイン失敗の記録・ロック
+	auditSvc   AuditService
+	uris       model.BaseURIs
+	appBaseURL string // メール内リンクの飛び先 (フロントエンドのURL)
 }
 
-func NewUserService(userRepo repository.UserRepository) AuthService {
-	return &authService{userRepo: userRepo}
+func NewUserService(
+	userRepo repository.UserRepository,
+	tokenRepo repository.TokenRepository,
+	mailer infrastructure.Mailer,
+	limiter infrastructure.RateLimitStore,
+	auditSvc AuditService,
+	uris model.BaseURIs,
+	appBaseURL string,
+) AuthService {
+	return &authService{
+		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		mailer:     mailer,
+		limiter:    limiter,
+		auditSvc:   auditSvc,
+		uris:       uris,
+		appBaseURL: appBaseURL,
+	}
 }
 
-func (s *authService) Register(req model.RegisterRequest) (*model.User, error) {
+func (s *authService) Register(ctx context.Context, req model.RegisterRequest, meta model.RequestMeta) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Register")
+	defer func() { tracing.End(span, err) }()
+
 	// 1. 重複チェック
 	// (DBのUNIQUE制約でも弾けるけど、親切なエラーメッセージのためにここでもチェックするのが一般的)
-	existingUser, err := s.userRepo.FindByEmail(req.Email)
+	existingUser, err := s.userRepo.FindByEmail(ctx, req.Email)
 	if err != nil {
 		return nil, err
 	}
@@ -46,29 +89,220 @@ func (s *authService) Register(req model.RegisterRequest) (*model.User, error) {
 	}
 
 	// 4. 保存
-	if err := s.userRepo.Create(newUser); err != nil {
+	if err := s.userRepo.Create(ctx, newUser); err != nil {
 		return nil, err
 	}
+	s.auditSvc.Record(ctx, meta, newUser.ID, model.AuditAuthRegister, s.uris.UserURI(newUser.ID), nil, map[string]interface{}{
+		"username": newUser.Username,
+		"email":    newUser.Email,
+	})
+
+	// 5. 確認メールの送信
+	// 送信に失敗してもユーザー登録自体は成功しているので、ログだけ出して再送してもらう
+	if err := s.sendVerificationMail(ctx, newUser); err != nil {
+		slog.Warn("verification mail failed", "request_id", meta.RequestID, "user_id", newUser.ID, "error", err)
+	}
 
 	return newUser, nil
 }
 
-func (s *authService) Login(req model.LoginRequest) (*model.User, error) {
-	// 1. ユーザーを探す
-	user, err := s.userRepo.FindByEmail(req.Email)
+func (s *authService) Login(ctx context.Context, req model.LoginRequest, meta model.RequestMeta) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Login")
+	defer func() { tracing.End(span, err) }()
+
+	// 0. 失敗が続いているならロック中は照合もしない
+	// メールアドレスだけで数えると、他人が間違ったパスワードを送り続けるだけで本人を締め出せてしまうので
+	// (メールアドレス, IP) の組で数えるのだ。IPを変えながらの総当たりはログインの予算 (IP単位) で抑える
+	lockKey := "login:" + utils.HashToken(strings.ToLower(req.Email)+"|"+meta.IP)
+	until, err := s.limiter.LockedUntil(lockKey)
 	if err != nil {
 		return nil, err
 	}
-	if user == nil {
-		return nil, fmt.Errorf("ユーザーが見つからないか、パスワードが違います")
+	if !until.IsZero() {
+		s.auditSvc.Record(ctx, meta, "", model.AuditAuthLoginLocked, "", nil, map[string]interface{}{"email": req.Email})
+		return nil, &LoginLockedError{Until: until}
 	}
 
-	// 2. パスワード照合 (Hash vs Raw)
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	// 1. ユーザーを探す
+	user, err := s.userRepo.FindByEmail(ctx, req.Email)
 	if err != nil {
+		return nil, err
+	}
+
+	// 2. パスワード照合 (Hash vs Raw)
+	if user == nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		// 存在しないメールアドレスでも同じように数える (登録の有無を推測されないように)
+		until, err := s.limiter.RecordFailure(lockKey)
+		if err != nil {
+			slog.Error("record login failure failed", "request_id", meta.RequestID, "error", err)
+		}
+
+		actorID, target := "", ""
+		if user != nil {
+			actorID, target = user.ID, s.uris.UserURI(user.ID)
+		}
+		s.auditSvc.Record(ctx, meta, actorID, model.AuditAuthLoginFailed, target, nil, map[string]interface{}{
+			"email":  req.Email,
+			"locked": !until.IsZero(),
+		})
+
+		if !until.IsZero() {
+			return nil, &LoginLockedError{Until: until}
+		}
 		return nil, fmt.Errorf("ユーザーが見つからないか、パスワードが違います")
 	}
 
-	// 3. 成功したらユーザー情報を返す
+	// 3. 成功したら失敗回数をリセットしてユーザー情報を返す
+	if err := s.limiter.ResetFailures(lockKey); err != nil {
+		slog.Error("reset login failures failed", "request_id", meta.RequestID, "user_id", user.ID, "error", err)
+	}
+	s.auditSvc.Record(ctx, meta, user.ID, model.AuditAuthLogin, s.uris.UserURI(user.ID), nil, nil)
 	return user, nil
 }
+
+// RequestPasswordReset: リセット用のメールを送る
+// メールアドレスが登録されているかどうかを外から判別できないよう、見つからなくてもエラーにしない
+func (s *authService) RequestPasswordReset(ctx context.Context, req model.ForgotPasswordRequest, meta model.RequestMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.RequestPasswordReset")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.userRepo.FindByEmail(ctx, req.Email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	// 古いリセットトークンは無効にして、最新の1つだけ使えるようにする
+	if err := s.tokenRepo.InvalidateAll(ctx, user.ID, model.TokenPurposePasswordReset); err != nil {
+		return err
+	}
+
+	raw, err := s.issueToken(ctx, user.ID, model.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	s.auditSvc.Record(ctx, meta, "", model.AuditAuthResetRequested, s.uris.UserURI(user.ID), nil, nil)
+
+	body := fmt.Sprintf(
+		"%s さん\n\nパスワード再設定のリクエストを受け付けました。\n以下のリンクから%d分以内に新しいパスワードを設定してください。\n\n%s/reset-password?token=%s\n\n心当たりがない場合はこのメールを無視してください。\n",
+		user.Username, int(passwordResetTTL.Minutes()), s.appBaseURL, raw,
+	)
+	return s.mailer.Send(user.Email, "パスワード再設定のご案内", body)
+}
+
+func (s *authService) ResetPassword(ctx context.Context, req model.ResetPasswordRequest, meta model.RequestMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.ResetPassword")
+	defer func() { tracing.End(span, err) }()
+
+	token, err := s.tokenRepo.Consume(ctx, utils.HashToken(req.Token), model.TokenPurposePasswordReset)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return ErrInvalidToken
+	}
+
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hashing failed: %w", err)
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, token.UserID, string(hashedPass)); err != nil {
+		return err
+	}
+	s.auditSvc.Record(ctx, meta, token.UserID, model.AuditAuthPasswordReset, s.uris.UserURI(token.UserID), nil, nil)
+
+	// リセットメールを受け取れた = メールアドレスの持ち主なので、確認済みにしてしまう
+	return s.userRepo.MarkEmailVerified(ctx, token.UserID)
+}
+
+func (s *authService) VerifyEmail(ctx context.Context, req model.VerifyEmailRequest, meta model.RequestMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.VerifyEmail")
+	defer func() { tracing.End(span, err) }()
+
+	token, err := s.tokenRepo.Consume(ctx, utils.HashToken(req.Token), model.TokenPurposeEmailVerify)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return ErrInvalidToken
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, token.UserID); err != nil {
+		return err
+	}
+	s.auditSvc.Record(ctx, meta, token.UserID, model.AuditAuthEmailVerified, s.uris.UserURI(token.UserID), nil, nil)
+	return s.tokenRepo.InvalidateAll(ctx, token.UserID, model.TokenPurposeEmailVerify)
+}
+
+func (s *authService) ResendVerification(ctx context.Context, userID string, meta model.RequestMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.ResendVerification")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user not found")
+	}
+	if user.EmailVerified {
+		return fmt.Errorf("メールアドレスは既に確認済みなのだ")
+	}
+
+	if err := s.tokenRepo.InvalidateAll(ctx, user.ID, model.TokenPurposeEmailVerify); err != nil {
+		return err
+	}
+	s.auditSvc.Record(ctx, meta, user.ID, model.AuditAuthVerifyResent, s.uris.UserURI(user.ID), nil, nil)
+	return s.sendVerificationMail(ctx, user)
+}
+
+// IsSuperuser: 管理者専用ルートの確認用
+func (s *authService) IsSuperuser(ctx context.Context, userID string) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.IsSuperuser")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user != nil && user.IsSuperuser, nil
+}
+
+// ---------------------------------------------------
+// Helper
+// ---------------------------------------------------
+
+func (s *authService) sendVerificationMail(ctx context.Context, user *model.User) error {
+	raw, err := s.issueToken(ctx, user.ID, model.TokenPurposeEmailVerify, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(
+		"%s さん\n\nご登録ありがとうございます。\n以下のリンクからメールアドレスの確認を完了してください (有効期限: %d時間)。\n\n%s/verify-email?token=%s\n",
+		user.Username, int(emailVerifyTTL.Hours()), s.appBaseURL, raw,
+	)
+	return s.mailer.Send(user.Email, "メールアドレスの確認", body)
+}
+
+// issueToken: トークンを発行してハッシュをDBに保存し、生のトークンを返す
+func (s *authService) issueToken(ctx context.Context, userID, purpose string, ttl time.Duration) (string, error) {
+	raw, hash, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", fmt.Errorf("token generation failed: %w", err)
+	}
+
+	token := &model.AuthToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
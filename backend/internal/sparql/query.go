@@ -0,0 +1,111 @@
+package sparql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Format: fmt.Sprintf と同じ書き方で、%s に Term を埋め込む
+// 引数を Term に限っているので、エスケープしていない文字列がクエリに紛れ込まない
+// 使える書き方は %s・%[n]s・%% だけ。それ以外や、引数の数が合わないときはプログラムの誤りなのでパニックする
+// (%!s(MISSING) のようなものが混ざったクエリを Fuseki に投げないため)
+//
+//	sparql.Format(`SELECT ?p ?o WHERE { %s ?p ?o } LIMIT %s`, iri, sparql.Integer(10))
+func Format(format string, terms ...Term) string {
+	if err := checkFormat(format, len(terms)); err != nil {
+		panic(err)
+	}
+	args := make([]interface{}, len(terms))
+	for i, t := range terms {
+		args[i] = t.SPARQL()
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// checkFormat: 書式の %s と引数の数が合っているか (使われない引数も誤りにする)
+func checkFormat(format string, n int) error {
+	used := make([]bool, n)
+	next := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i >= len(format) {
+			return fmt.Errorf("sparql.Format: 書式が %% で終わっているのだ")
+		}
+		if format[i] == '%' {
+			continue
+		}
+		if format[i] == '[' {
+			end := strings.IndexByte(format[i:], ']')
+			if end < 0 {
+				return fmt.Errorf("sparql.Format: %%[ が閉じていないのだ")
+			}
+			idx, err := strconv.Atoi(format[i+1 : i+end])
+			if err != nil || idx < 1 {
+				return fmt.Errorf("sparql.Format: 引数の番号が不正なのだ: %q", format[i:i+end+1])
+			}
+			next = idx - 1
+			i += end + 1
+			if i >= len(format) {
+				return fmt.Errorf("sparql.Format: 書式が %%[n] で終わっているのだ")
+			}
+		}
+		if format[i] != 's' {
+			return fmt.Errorf("sparql.Format: %%%c は使えないのだ (%%s だけ)", format[i])
+		}
+		if next >= n {
+			return fmt.Errorf("sparql.Format: 引数が足りないのだ (%d 個しか無い)", n)
+		}
+		used[next] = true
+		next++
+	}
+	for i, u := range used {
+		if !u {
+			return fmt.Errorf("sparql.Format: %d 番目の引数が使われていないのだ", i+1)
+		}
+	}
+	return nil
+}
+
+// Triples: INSERT DATA { ... } の中身を組み立てる
+type Triples struct {
+	b strings.Builder
+}
+
+// Add: 1つの主語に述語・目的語の組をまとめて足す (s p1 o1 ; p2 o2 .)
+func (t *Triples) Add(subject IRI, predicateObjects ...PredicateObject) {
+	if len(predicateObjects) == 0 {
+		return
+	}
+	t.b.WriteString("  ")
+	t.b.WriteString(subject.SPARQL())
+	for i, po := range predicateObjects {
+		if i > 0 {
+			t.b.WriteString(" ;\n   ")
+		}
+		t.b.WriteString(" ")
+		t.b.WriteString(po.Predicate.SPARQL())
+		t.b.WriteString(" ")
+		t.b.WriteString(po.Object.SPARQL())
+	}
+	t.b.WriteString(" .\n")
+}
+
+// String: 組み立てたトリプル (そのまま { } の中に入れる)
+func (t *Triples) String() string {
+	return t.b.String()
+}
+
+// PredicateObject: 述語と目的語の組
+type PredicateObject struct {
+	Predicate IRI
+	Object    Term
+}
+
+// PO: PredicateObject の短縮形
+func PO(predicate IRI, object Term) PredicateObject {
+	return PredicateObject{Predicate: predicate, Object: object}
+}
@@ -0,0 +1,122 @@
+package sparql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	s := MustIRI("http://example.org/s")
+	o := String(`a "quoted" value`)
+	tests := []struct {
+		name   string
+		format string
+		terms  []Term
+		want   string
+	}{
+		{"sequential", "%s ?p %s", []Term{s, o}, `<http://example.org/s> ?p "a \"quoted\" value"`},
+		{"indexed", "%[2]s %[1]s %[1]s", []Term{s, Integer(3)}, "3 <http://example.org/s> <http://example.org/s>"},
+		{"index then sequential", "%[2]s %s %[1]s", []Term{s, Integer(3), Integer(4)}, "3 4 <http://example.org/s>"},
+		{"percent", "FILTER (?x = %s) # 100%%", []Term{Integer(1)}, "FILTER (?x = 1) # 100%"},
+		{"no placeholders", "SELECT * WHERE { ?s ?p ?o }", nil, "SELECT * WHERE { ?s ?p ?o }"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.format, tt.terms...); got != tt.want {
+			t.Errorf("%s: Format = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	one := []Term{Integer(1)}
+	tests := []struct {
+		name   string
+		format string
+		terms  []Term
+		want   string // エラーの文に含まれるもの
+	}{
+		{"too few terms", "%s %s", one, "引数が足りない"},
+		{"too many terms", "%s", []Term{Integer(1), Integer(2)}, "使われていない"},
+		{"unused indexed term", "%[2]s", []Term{Integer(1), Integer(2)}, "1 番目"},
+		{"index out of range", "%[3]s", []Term{Integer(1), Integer(2)}, "引数が足りない"},
+		{"index zero", "%[0]s", one, "番号が不正"},
+		{"index not a number", "%[x]s", one, "番号が不正"},
+		{"unclosed index", "%[1s", one, "閉じていない"},
+		{"verb d", "LIMIT %d", one, "%d は使えない"},
+		{"verb v", "%v", one, "%v は使えない"},
+		{"verb q", "%q", one, "%q は使えない"},
+		{"width", "%5s", one, "%5 は使えない"},
+		{"trailing percent", "%s 100%", one, "% で終わっている"},
+		{"trailing index", "%s %[1]", one, "%[n] で終わっている"},
+	}
+	for _, tt := range tests {
+		err := checkFormat(tt.format, len(tt.terms))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: checkFormat(%q) = %v, want error containing %q", tt.name, tt.format, err, tt.want)
+			continue
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: Format(%q) did not panic", tt.name, tt.format)
+				}
+			}()
+			Format(tt.format, tt.terms...)
+		}()
+	}
+}
+
+func TestTriples(t *testing.T) {
+	subject := MustIRI("http://example.org/occ/1")
+	label := MustIRI("http://www.w3.org/2000/01/rdf-schema#label")
+	remarks := MustIRI("http://rs.tdwg.org/dwc/terms/occurrenceRemarks")
+	other := MustIRI("http://example.org/occ/2")
+
+	tests := []struct {
+		name string
+		add  func(*Triples)
+		want string
+	}{
+		{"empty", func(*Triples) {}, ""},
+		{"no predicates", func(tr *Triples) { tr.Add(subject) }, ""},
+		{
+			"one",
+			func(tr *Triples) { tr.Add(subject, PO(label, String("x"))) },
+			"  <http://example.org/occ/1> <http://www.w3.org/2000/01/rdf-schema#label> \"x\" .\n",
+		},
+		{
+			"several predicates and subjects",
+			func(tr *Triples) {
+				tr.Add(subject, PO(label, String("x")), PO(remarks, String("a\"} ; DROP ALL")))
+				tr.Add(other, PO(label, Integer(2)))
+			},
+			"  <http://example.org/occ/1> <http://www.w3.org/2000/01/rdf-schema#label> \"x\" ;\n" +
+				"    <http://rs.tdwg.org/dwc/terms/occurrenceRemarks> \"a\\\"} ; DROP ALL\" .\n" +
+				"  <http://example.org/occ/2> <http://www.w3.org/2000/01/rdf-schema#label> 2 .\n",
+		},
+	}
+	for _, tt := range tests {
+		var tr Triples
+		tt.add(&tr)
+		if got := tr.String(); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+
+	// 組み立てたものが INSERT DATA の中で文字列1つ分ずつとして読めること
+	var tr Triples
+	tr.Add(subject, PO(remarks, String("} } INSERT DATA { <a> <b> <c> }")))
+	toks, err := tokenize("INSERT DATA { " + tr.String() + " }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	braces := 0
+	for _, tok := range toks {
+		if tok.kind == tokPunct && (tok.text == "{" || tok.text == "}") {
+			braces++
+		}
+	}
+	if braces != 2 {
+		t.Errorf("literal leaked braces into the query: %v", toks)
+	}
+}
@@ -0,0 +1,449 @@
+package sparql
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 外部から受け取った SPARQL を、見せてはいけないリソースが出てこない形に書き換える
+//
+// Fuseki には問い合わせごとのアクセス制御が無いので、WHERE の中のグループ { ... } ごとに
+// 「このグループに出てくる変数・IRI は非公開のリソースに束縛されない」という FILTER を差し込む
+// 変数を経由しないで値に辿り着ける書き方 (プロパティパス・空白ノード・コレクション) と、
+// 見るデータセットを変える書き方 (FROM・SERVICE など) は書き換えられないので受け付けない
+
+// ErrQueryRejected: 受け付けられない問い合わせ (理由は wrap されたメッセージ)
+var ErrQueryRejected = errors.New("この SPARQL は受け付けられないのだ")
+
+// 問い合わせの種類
+const (
+	FormSelect    = "SELECT"
+	FormConstruct = "CONSTRUCT"
+	FormAsk       = "ASK"
+)
+
+// Restriction: 隠す対象
+// Predicate が Hidden のリソースは、Owner (空ならなし) が OwnerPredicate になっているもの以外見えなくする
+// Dependents の名前空間のリソース (記録を作るときにできる自由入力の値など) は、
+// 見てよいリソースから (主語として) 使われているものだけ見せる
+type Restriction struct {
+	Predicate      IRI
+	Hidden         Literal
+	OwnerPredicate IRI
+	Owner          *IRI
+	Namespace      string   // この名前空間の IRI をクエリに直接書いた場合もチェックする
+	Dependents     []string // 上に書いた、使われ方で見せるかを決めるリソースの名前空間
+	MaxLimit       int      // SELECT / CONSTRUCT の LIMIT の上限 (0なら付けない)
+}
+
+// ScopedQuery: 書き換え後の問い合わせ
+type ScopedQuery struct {
+	Form  string
+	Query string
+	Limit int // 実際に掛かる LIMIT (ASK は 0)
+}
+
+// 更新系・データセットを変えるキーワード
+var rejectedKeywords = map[string]string{
+	"INSERT": "更新はできないのだ", "DELETE": "更新はできないのだ", "LOAD": "更新はできないのだ",
+	"CLEAR": "更新はできないのだ", "DROP": "更新はできないのだ", "CREATE": "更新はできないのだ",
+	"ADD": "更新はできないのだ", "MOVE": "更新はできないのだ", "COPY": "更新はできないのだ",
+	"WITH": "更新はできないのだ", "USING": "更新はできないのだ",
+	"DESCRIBE": "DESCRIBE は使えないのだ (CONSTRUCT で書いてほしいのだ)",
+	"SERVICE":  "SERVICE (連合クエリ) は使えないのだ",
+	"FROM":     "FROM / FROM NAMED は使えないのだ",
+	"BASE":     "BASE は使えないのだ (IRIは絶対IRIで書いてほしいのだ)",
+}
+
+// Scope: 問い合わせを検査して、非公開リソースを隠す FILTER と LIMIT を付け足す
+func Scope(query string, r Restriction) (*ScopedQuery, error) {
+	// \uXXXX / \UXXXXXXXX は構文解析の前に (文字列やコメントの中でも) 戻されるので、
+	// 字句解析で見た形と Fuseki が読む形がずれる (コメントの中の \u000A で改行になるなど)
+	// 戻してから送る手もあるけれど、戻した結果にまた \u が出てくることもあるので受け付けないことにするのだ
+	if strings.Contains(query, `\u`) || strings.Contains(query, `\U`) {
+		return nil, rejectf("\\u / \\U のエスケープは使えないのだ (文字はそのまま書いてほしいのだ)")
+	}
+	toks, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	s := &scoper{src: query, toks: toks, r: r, prefixes: map[string]string{}}
+	return s.run()
+}
+
+// ---------------------------------------------------
+// 書き換え
+// ---------------------------------------------------
+
+type scoper struct {
+	src      string
+	toks     []token
+	r        Restriction
+	prefixes map[string]string
+	inserts  []insertion
+}
+
+type insertion struct {
+	pos  int
+	text string
+	cut  int // pos から cut バイトを置き換える (0なら挿入だけ)
+}
+
+// group: WHERE の中の { ... } 1つ分
+type group struct {
+	parens    int             // このグループ直下の ( ) の深さ
+	data      bool            // VALUES のデータブロック (FILTER を入れてはいけない)
+	subSelect bool            // { SELECT ... } の外側 (FILTER を入れてはいけない)
+	terms     map[string]bool // このグループの三つ組に出てくる変数・IRI
+}
+
+func (s *scoper) run() (*ScopedQuery, error) {
+	i := 0
+	// PREFIX 宣言
+	for i < len(s.toks) && s.toks[i].keyword() == "PREFIX" {
+		if i+2 >= len(s.toks) || s.toks[i+1].kind != tokPName || s.toks[i+2].kind != tokIRI {
+			return nil, rejectf("PREFIX の書き方が変なのだ")
+		}
+		s.prefixes[strings.TrimSuffix(s.toks[i+1].text, ":")] = iriValue(s.toks[i+2].text)
+		i += 3
+	}
+	if i >= len(s.toks) {
+		return nil, rejectf("問い合わせが空なのだ")
+	}
+
+	for _, t := range s.toks[i:] {
+		if reason, ok := rejectedKeywords[t.keyword()]; ok {
+			return nil, rejectf("%s", reason)
+		}
+	}
+
+	form := s.toks[i].keyword()
+	switch form {
+	case FormSelect, FormAsk:
+	case FormConstruct:
+		// CONSTRUCT { テンプレート } WHERE { ... } の形だけ (CONSTRUCT WHERE { ... } の短縮形は不可)
+		if i+1 >= len(s.toks) || s.toks[i+1].text != "{" {
+			return nil, rejectf("CONSTRUCT WHERE の短縮形は使えないのだ (テンプレートを書いてほしいのだ)")
+		}
+		end, err := s.matchBrace(i + 1)
+		if err != nil {
+			return nil, err
+		}
+		i = end
+	default:
+		return nil, rejectf("SELECT / CONSTRUCT / ASK だけ使えるのだ")
+	}
+
+	// WHERE の最初の { を探す (SELECT の射影部分は読み飛ばす)
+	// 射影の中の EXISTS { ... } は FILTER を入れられないので受け付けない
+	start, parens := -1, 0
+	for j := i + 1; j < len(s.toks) && start < 0; j++ {
+		switch s.toks[j].text {
+		case "(":
+			parens++
+		case ")":
+			parens--
+		case "{":
+			if parens > 0 {
+				return nil, rejectf("WHERE の外で EXISTS などのグループは使えないのだ")
+			}
+			start = j
+		}
+	}
+	if start < 0 {
+		return nil, rejectf("WHERE { ... } が無いのだ")
+	}
+
+	end, err := s.scopeWhere(start)
+	if err != nil {
+		return nil, err
+	}
+
+	// WHERE の後ろ (GROUP BY・HAVING・ORDER BY) にもグループは書けない (末尾の VALUES だけ可)
+	for j := end + 1; j < len(s.toks); j++ {
+		if s.toks[j].keyword() == "VALUES" {
+			break
+		}
+		if s.toks[j].text == "{" {
+			return nil, rejectf("WHERE の外で EXISTS などのグループは使えないのだ")
+		}
+		if s.toks[j].text == "}" {
+			return nil, rejectf("括弧の対応がおかしいのだ")
+		}
+	}
+
+	limit := 0
+	if form != FormAsk {
+		if limit, err = s.applyLimit(end + 1); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ScopedQuery{Form: form, Query: s.render(), Limit: limit}, nil
+}
+
+// scopeWhere: WHERE のグループを読み、各グループの閉じ括弧の前に FILTER を差し込む
+// 戻り値は WHERE を閉じる } の位置
+func (s *scoper) scopeWhere(start int) (int, error) {
+	var stack []*group
+	var pendingData bool // 直前に VALUES があった (次の { はデータブロック)
+
+	for i := start; i < len(s.toks); i++ {
+		t := s.toks[i]
+		var g *group
+		if len(stack) > 0 {
+			g = stack[len(stack)-1]
+		}
+
+		switch {
+		case t.text == "{":
+			ng := &group{terms: map[string]bool{}}
+			if pendingData || (g != nil && g.data) {
+				ng.data = true
+				pendingData = false
+			}
+			stack = append(stack, ng)
+			continue
+
+		case t.text == "}":
+			if g == nil {
+				return 0, rejectf("括弧の対応がおかしいのだ")
+			}
+			if !g.data && !g.subSelect {
+				if f := s.filterFor(g.terms); f != "" {
+					s.inserts = append(s.inserts, insertion{pos: t.pos, text: f})
+				}
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return i, nil
+			}
+			continue
+		}
+
+		if g == nil || g.data {
+			continue
+		}
+
+		switch t.kind {
+		case tokWord:
+			kw := t.keyword()
+			switch kw {
+			case "VALUES":
+				pendingData = true
+			case "SELECT":
+				// { SELECT ... } の外側のグループ。射影・GROUP BY などは ( ) や * を含むので検査しない
+				g.subSelect = true
+			}
+		case tokBNode:
+			return 0, rejectf("WHERE の中で空白ノード (%s) は使えないのだ (変数にしてほしいのだ)", t.text)
+		}
+
+		if g.subSelect {
+			continue
+		}
+
+		if t.kind == tokPunct {
+			switch t.text {
+			case "(":
+				if g.parens == 0 && !(i > 0 && s.toks[i-1].kind == tokWord && s.toks[i-1].keyword() != "A") {
+					return 0, rejectf("WHERE の中でコレクション ( ... ) やパスのグループは使えないのだ")
+				}
+				g.parens++
+			case ")":
+				g.parens--
+			case "[":
+				return 0, rejectf("WHERE の中で空白ノード [ ... ] は使えないのだ (変数にしてほしいのだ)")
+			case "/", "^", "|", "*", "+", "?", "!":
+				if g.parens == 0 {
+					return 0, rejectf("プロパティパス (%s) は使えないのだ (変数を挟んで書いてほしいのだ)", t.text)
+				}
+			}
+			continue
+		}
+
+		if g.parens > 0 {
+			continue
+		}
+		switch t.kind {
+		case tokVar:
+			g.terms["?"+t.text[1:]] = true
+		case tokIRI:
+			if v := iriValue(t.text); s.inNamespace(v) {
+				g.terms["<"+v+">"] = true
+			}
+		case tokPName:
+			v, err := s.expand(t.text)
+			if err != nil {
+				return 0, err
+			}
+			if s.inNamespace(v) {
+				g.terms["<"+v+">"] = true
+			}
+		}
+	}
+	return 0, rejectf("WHERE の括弧が閉じていないのだ")
+}
+
+// filterFor: グループに出てきた変数・IRI が非公開リソースなら弾く FILTER
+func (s *scoper) filterFor(terms map[string]bool) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(terms))
+	for k := range terms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var conds []string
+	for _, k := range keys {
+		var cond string
+		switch {
+		case strings.HasPrefix(k, "?"):
+			cond = s.visible(k)
+			if len(s.r.Dependents) > 0 {
+				var prefixes []string
+				for _, ns := range s.r.Dependents {
+					prefixes = append(prefixes, "STRSTARTS(STR("+k+"), "+String(ns).SPARQL()+")")
+				}
+				cond += " && (!isIRI(" + k + ") || !(" + strings.Join(prefixes, " || ") + ") || " + s.referenced(k) + ")"
+			}
+			// OPTIONAL などで束縛されていない変数は対象外
+			cond = "(!BOUND(" + k + ") || " + cond + ")"
+		case s.inDependents(iriValue(k)):
+			cond = s.referenced(k)
+		default:
+			cond = s.visible(k)
+		}
+		conds = append(conds, cond)
+	}
+	return " FILTER (" + strings.Join(conds, " && ") + ") "
+}
+
+// visible: k が隠すリソースではない
+func (s *scoper) visible(k string) string {
+	hidden := k + " " + s.r.Predicate.SPARQL() + " " + s.r.Hidden.SPARQL()
+	if s.r.Owner != nil {
+		hidden += " . FILTER NOT EXISTS { " + k + " " + s.r.OwnerPredicate.SPARQL() + " " + s.r.Owner.SPARQL() + " }"
+	}
+	return "NOT EXISTS { " + hidden + " }"
+}
+
+// referenced: k を目的語か述語に使っている、見てよいリソースがある
+// 中の変数名が問い合わせの変数と同じでも、外の値で置き換わって条件が厳しくなるだけなので漏れはしないのだ
+func (s *scoper) referenced(k string) string {
+	return "EXISTS { { ?scope_ref ?scope_p " + k + " } UNION { ?scope_ref " + k + " ?scope_o } FILTER (" + s.visible("?scope_ref") + ") }"
+}
+
+// applyLimit: 一番外側の LIMIT を上限以下にする (無ければ付ける)
+func (s *scoper) applyLimit(from int) (int, error) {
+	if s.r.MaxLimit <= 0 {
+		return 0, nil
+	}
+	valuesAt := -1
+	depth := 0
+	for i := from; i < len(s.toks); i++ {
+		t := s.toks[i]
+		switch t.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth != 0 {
+			continue
+		}
+		switch t.keyword() {
+		case "VALUES":
+			if valuesAt < 0 {
+				valuesAt = t.pos
+			}
+		case "LIMIT":
+			if i+1 >= len(s.toks) || s.toks[i+1].kind != tokNumber {
+				return 0, rejectf("LIMIT の後ろは数字なのだ")
+			}
+			n, err := strconv.Atoi(s.toks[i+1].text)
+			if err != nil || n < 0 {
+				return 0, rejectf("LIMIT の値が不正なのだ")
+			}
+			if n <= s.r.MaxLimit {
+				return n, nil
+			}
+			num := s.toks[i+1]
+			s.inserts = append(s.inserts, insertion{pos: num.pos, cut: len(num.text), text: strconv.Itoa(s.r.MaxLimit)})
+			return s.r.MaxLimit, nil
+		}
+	}
+
+	text := fmt.Sprintf("\nLIMIT %d\n", s.r.MaxLimit)
+	if valuesAt >= 0 {
+		s.inserts = append(s.inserts, insertion{pos: valuesAt, text: text})
+	} else {
+		s.inserts = append(s.inserts, insertion{pos: len(s.src), text: text})
+	}
+	return s.r.MaxLimit, nil
+}
+
+func (s *scoper) matchBrace(open int) (int, error) {
+	depth := 0
+	for i := open; i < len(s.toks); i++ {
+		switch s.toks[i].text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, rejectf("括弧が閉じていないのだ")
+}
+
+func (s *scoper) expand(pname string) (string, error) {
+	colon := strings.Index(pname, ":")
+	base, ok := s.prefixes[pname[:colon]]
+	if !ok {
+		return "", rejectf("PREFIX が宣言されていないのだ: %s", pname)
+	}
+	return base + pname[colon+1:], nil
+}
+
+func (s *scoper) inNamespace(iri string) bool {
+	return s.r.Namespace != "" && strings.HasPrefix(iri, s.r.Namespace) || s.inDependents(iri)
+}
+
+func (s *scoper) inDependents(iri string) bool {
+	for _, ns := range s.r.Dependents {
+		if ns != "" && strings.HasPrefix(iri, ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// render: 差し込み・置き換えを反映した問い合わせ
+func (s *scoper) render() string {
+	sort.SliceStable(s.inserts, func(a, b int) bool { return s.inserts[a].pos < s.inserts[b].pos })
+	var b strings.Builder
+	last := 0
+	for _, in := range s.inserts {
+		b.WriteString(s.src[last:in.pos])
+		b.WriteString(in.text)
+		last = in.pos + in.cut
+	}
+	b.WriteString(s.src[last:])
+	return b.String()
+}
+
+func rejectf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrQueryRejected, fmt.Sprintf(format, args...))
+}
+
+func iriValue(tok string) string {
+	return tok[1 : len(tok)-1]
+}
@@ -0,0 +1,439 @@
+package sparql
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// API の /api/sparql と同じ形の制限 (テスト用の名前空間)
+func testRestriction(owner string) Restriction {
+	r := Restriction{
+		Predicate:      MustIRI("http://example.org/ns#visibility"),
+		Hidden:         String("private"),
+		OwnerPredicate: MustIRI("http://purl.org/dc/terms/creator"),
+		Namespace:      "http://my-db.org/occ/",
+		MaxLimit:       100,
+	}
+	if owner != "" {
+		iri := MustIRI(owner)
+		r.Owner = &iri
+	}
+	return r
+}
+
+func TestScopeRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		// 更新
+		{"insert data", `INSERT DATA { <http://my-db.org/occ/1> <http://x/p> "v" }`},
+		{"delete where", `DELETE WHERE { ?s ?p ?o }`},
+		{"delete insert", `DELETE { ?s ?p ?o } INSERT { ?s ?p "x" } WHERE { ?s ?p ?o }`},
+		{"lowercase update", `insert data { <http://x/a> <http://x/p> "v" }`},
+		{"update after prefix", `PREFIX x: <http://x/> DROP ALL`},
+		{"load", `LOAD <http://example.org/data.ttl>`},
+		{"clear", `CLEAR DEFAULT`},
+		{"create", `CREATE GRAPH <http://x/g>`},
+		{"with", `WITH <http://x/g> DELETE { ?s ?p ?o } WHERE { ?s ?p ?o }`},
+		{"select then update", "SELECT * WHERE { ?s ?p ?o } ;\nDROP ALL"},
+
+		// データセットを変えるもの
+		{"from", `SELECT * FROM <http://x/g> WHERE { ?s ?p ?o }`},
+		{"from named", `SELECT * FROM NAMED <http://x/g> WHERE { GRAPH ?g { ?s ?p ?o } }`},
+		{"service", `SELECT * WHERE { SERVICE <http://example.org/sparql> { ?s ?p ?o } }`},
+		{"service silent", `SELECT * WHERE { ?s ?p ?o SERVICE SILENT <http://example.org/sparql> { ?s ?q ?v } }`},
+		{"base", `BASE <http://my-db.org/occ/> SELECT * WHERE { <1> ?p ?o }`},
+		{"describe", `DESCRIBE <http://my-db.org/occ/1>`},
+		{"describe where", `DESCRIBE ?s WHERE { ?s ?p ?o }`},
+
+		// 変数を経由しないで値に辿り着ける書き方
+		{"blank node label", `SELECT * WHERE { _:b ?p ?o }`},
+		{"blank node object", `SELECT * WHERE { ?s ?p _:b }`},
+		{"anonymous blank node", `SELECT * WHERE { ?s ?p [ ?q ?o ] }`},
+		{"empty blank node", `SELECT * WHERE { ?s ?p [] }`},
+		{"path sequence", `SELECT * WHERE { ?s <http://x/p>/<http://x/q> ?o }`},
+		{"path inverse", `SELECT * WHERE { ?s ^<http://x/p> ?o }`},
+		{"path alternative", `SELECT * WHERE { ?s <http://x/p>|<http://x/q> ?o }`},
+		{"path star", `SELECT * WHERE { ?s <http://x/p>* ?o }`},
+		{"path plus", `PREFIX x: <http://x/> SELECT * WHERE { ?s x:p+ ?o }`},
+		{"path optional", `SELECT * WHERE { ?s <http://x/p>? ?o }`},
+		{"path negated", `SELECT * WHERE { ?s !<http://x/p> ?o }`},
+		{"path group", `SELECT * WHERE { ?s (<http://x/p>) ?o }`},
+		{"collection", `SELECT * WHERE { ?s <http://x/p> ( ?a ?b ) }`},
+		{"collection subject", `SELECT * WHERE { ( ?a ?b ) <http://x/p> ?o }`},
+
+		// 書き換えられない形
+		{"construct where", `CONSTRUCT WHERE { ?s ?p ?o }`},
+		{"exists in projection", `SELECT (EXISTS { ?s ?p ?o } AS ?e) WHERE { ?x ?y ?z }`},
+		{"exists in having", `SELECT ?s WHERE { ?s ?p ?o } GROUP BY ?s HAVING (EXISTS { ?s ?q ?v })`},
+		{"unknown prefix", `SELECT * WHERE { occ:1 ?p ?o }`},
+		{"bad limit", `SELECT * WHERE { ?s ?p ?o } LIMIT ?n`},
+		{"unclosed where", `SELECT * WHERE { ?s ?p ?o`},
+		{"unbalanced", `SELECT * WHERE { ?s ?p ?o } }`},
+		{"unclosed string", `SELECT * WHERE { ?s ?p "abc }`},
+		{"no where", `SELECT ?s`},
+
+		// \u は構文解析の前に戻されるので、コメントや文字列を抜け出せてしまう
+		{"unicode escape ends comment", "SELECT ?r WHERE {\n # x\\u000A ?s <http://rs.tdwg.org/dwc/terms/occurrenceRemarks> ?r .\n}"},
+		{"long unicode escape ends comment", "SELECT ?r WHERE { # x\\U0000000D ?s ?p ?r }"},
+		{"unicode escape in string", `SELECT ?s WHERE { ?s ?p "\u0022 } " }`},
+		{"unicode escape in iri", `SELECT ?s WHERE { <http://my-db.org/occ/\u0031> ?p ?s }`},
+		{"unicode escape in name", `PREFIX x: <http://x/> SELECT ?s WHERE { ?s x:\u0070 ?o }`},
+		{"empty", "# nothing but a comment\n"},
+	}
+	for _, tt := range tests {
+		for _, owner := range []string{"", "http://my-db.org/user/u1"} {
+			if _, err := Scope(tt.query, testRestriction(owner)); !errors.Is(err, ErrQueryRejected) {
+				t.Errorf("%s (owner=%q): Scope error = %v, want ErrQueryRejected", tt.name, owner, err)
+			}
+		}
+	}
+}
+
+// コメントや文字列の中のキーワード・括弧は、問い合わせの構文として扱わない
+func TestScopeIgnoresCommentsAndStrings(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		limit int
+	}{
+		{"update keyword in string", `SELECT ?s WHERE { ?s ?p "INSERT DATA { <a> <b> <c> }" }`, 100},
+		{"update keyword in long string", `SELECT ?s WHERE { ?s ?p """DROP ALL ; DELETE WHERE { ?s ?p ?o }""" }`, 100},
+		{"single quoted string", `SELECT ?s WHERE { ?s ?p 'SERVICE <http://x/> { }' }`, 100},
+		{"escaped quote in string", `SELECT ?s WHERE { ?s ?p "say \"} FROM <http://x/g>\"" }`, 100},
+		{"keywords in comments", "# DELETE WHERE { ?s ?p ?o }\nSELECT ?s WHERE { # } FROM <http://x/g>\n ?s ?p ?o } # SERVICE", 100},
+		{"limit in comment", "SELECT ?s WHERE { ?s ?p ?o } # LIMIT 5", 100},
+		{"limit in string", `SELECT ?s WHERE { ?s ?p "LIMIT 5" }`, 100},
+		{"keyword-like variables and names", `PREFIX x: <http://x/> SELECT ?insert ?from WHERE { ?insert x:DELETE ?from }`, 100},
+	}
+	for _, tt := range tests {
+		out, err := Scope(tt.query, testRestriction(""))
+		if err != nil {
+			t.Errorf("%s: Scope error = %v", tt.name, err)
+			continue
+		}
+		if out.Limit != tt.limit {
+			t.Errorf("%s: Limit = %d, want %d", tt.name, out.Limit, tt.limit)
+		}
+		checkFiltered(t, tt.name, out.Query)
+	}
+}
+
+// 書き換えた問い合わせで、三つ組に変数が出てくるグループすべてに、その変数の FILTER が入っていること
+func TestScopeInjectsFilterIntoEveryGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		groups int // FILTER が入るはずのグループの数
+	}{
+		{"basic", `SELECT * WHERE { ?s ?p ?o }`, 1},
+		{"optional", `SELECT * WHERE { ?s ?p ?o OPTIONAL { ?s <http://x/r> ?r } }`, 2},
+		{"nested optional", `SELECT * WHERE { ?s ?p ?o OPTIONAL { ?s <http://x/r> ?r OPTIONAL { ?r <http://x/q> ?q } } }`, 3},
+		{"union", `SELECT * WHERE { { ?s ?p ?o } UNION { ?o ?p ?s } }`, 2},
+		{"graph", `SELECT * WHERE { GRAPH ?g { ?s ?p ?o } }`, 2},
+		{"graph iri", `SELECT * WHERE { GRAPH <http://x/g> { ?s ?p ?o } }`, 1},
+		{"minus", `SELECT * WHERE { ?s ?p ?o MINUS { ?s <http://x/q> ?v } }`, 2},
+		{"exists in filter", `SELECT * WHERE { ?s ?p ?o FILTER EXISTS { ?s <http://x/q> ?v } }`, 2},
+		{"sub-select", `SELECT ?s WHERE { { SELECT ?s (COUNT(?o) AS ?n) WHERE { ?s ?p ?o } GROUP BY ?s } ?s ?q ?v }`, 2},
+		{"sub-select in optional", `SELECT * WHERE { ?s ?p ?o OPTIONAL { { SELECT ?s WHERE { ?s ?q ?v } LIMIT 1 } } }`, 2},
+		{"values inside", `SELECT * WHERE { VALUES ?s { <http://my-db.org/occ/1> <http://my-db.org/occ/2> } ?s ?p ?o }`, 1},
+		{"values multiple", `SELECT * WHERE { VALUES (?s ?o) { (<http://my-db.org/occ/1> "a") (UNDEF "b") } ?s ?p ?o }`, 1},
+		{"values after where", `SELECT * WHERE { ?s ?p ?o } VALUES ?s { <http://my-db.org/occ/1> }`, 1},
+		{"bind and filter", `SELECT * WHERE { ?s ?p ?o BIND (STR(?o) AS ?l) FILTER (CONTAINS(?l, "x")) }`, 1},
+		{"construct", `CONSTRUCT { ?s ?p ?o } WHERE { ?s ?p ?o OPTIONAL { ?o ?q ?v } }`, 2},
+		{"ask", `ASK { ?s ?p ?o }`, 1},
+		{"ask with where", `ASK WHERE { { ?s ?p ?o } UNION { GRAPH ?g { ?s ?p ?o } } }`, 3},
+		// コメントは \r でも終わる (Fuseki はその後ろを三つ組として読む)
+		{"comment ended by cr", "SELECT ?r WHERE {\n # x\r ?s <http://rs.tdwg.org/dwc/terms/occurrenceRemarks> ?r .\n}", 1},
+		{"comment ended by crlf", "SELECT ?r WHERE { # x\r\n ?s ?p ?r }", 1},
+	}
+	for _, tt := range tests {
+		for _, owner := range []string{"", "http://my-db.org/user/u1"} {
+			out, err := Scope(tt.query, testRestriction(owner))
+			if err != nil {
+				t.Errorf("%s: Scope error = %v", tt.name, err)
+				continue
+			}
+			if n := checkFiltered(t, tt.name, out.Query); n != tt.groups {
+				t.Errorf("%s: %d groups have triples, want %d\n%s", tt.name, n, tt.groups, out.Query)
+			}
+		}
+	}
+}
+
+// 名前空間の IRI を直接書いた場合も、その IRI が非公開なら当たらないようにする
+func TestScopeChecksNamespaceIRIs(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"iri", `SELECT * WHERE { <http://my-db.org/occ/1> ?p ?o }`, `NOT EXISTS { <http://my-db.org/occ/1> <http://example.org/ns#visibility> "private" }`},
+		{"prefixed", `PREFIX occ: <http://my-db.org/occ/> SELECT * WHERE { occ:1 ?p ?o }`, `NOT EXISTS { <http://my-db.org/occ/1> <http://example.org/ns#visibility> "private" }`},
+	}
+	for _, tt := range tests {
+		out, err := Scope(tt.query, testRestriction(""))
+		if err != nil {
+			t.Errorf("%s: Scope error = %v", tt.name, err)
+			continue
+		}
+		if !strings.Contains(out.Query, tt.want) {
+			t.Errorf("%s: missing %s\n%s", tt.name, tt.want, out.Query)
+		}
+	}
+
+	// 名前空間の外の IRI は調べない
+	out, err := Scope(`SELECT * WHERE { <http://other.org/x> ?p ?o }`, testRestriction(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.Query, "<http://other.org/x> <http://example.org/ns#visibility>") {
+		t.Errorf("IRI outside the namespace was checked:\n%s", out.Query)
+	}
+}
+
+// 匿名なら非公開のものはすべて隠し、ログインしていれば自分のものだけ見せる
+func TestScopeOwner(t *testing.T) {
+	const query = `SELECT ?s WHERE { ?s ?p ?o }`
+
+	anon, err := Scope(query, testRestriction(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAnon := `(!BOUND(?s) || NOT EXISTS { ?s <http://example.org/ns#visibility> "private" })`
+	if !strings.Contains(anon.Query, wantAnon) {
+		t.Errorf("anonymous filter missing %s\n%s", wantAnon, anon.Query)
+	}
+	if strings.Contains(anon.Query, "creator") {
+		t.Errorf("anonymous filter lets an owner through:\n%s", anon.Query)
+	}
+
+	owned, err := Scope(query, testRestriction("http://my-db.org/user/u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOwner := `(!BOUND(?s) || NOT EXISTS { ?s <http://example.org/ns#visibility> "private" . FILTER NOT EXISTS { ?s <http://purl.org/dc/terms/creator> <http://my-db.org/user/u1> } })`
+	if !strings.Contains(owned.Query, wantOwner) {
+		t.Errorf("owner filter missing %s\n%s", wantOwner, owned.Query)
+	}
+}
+
+// 自由入力の値 (user_val など) は、見てよい記録から使われているときだけ見える
+func TestScopeDependents(t *testing.T) {
+	r := testRestriction("")
+	r.Dependents = []string{"http://my-db.org/user_val/", "http://my-db.org/user_prop/"}
+	const refs = `EXISTS { { ?scope_ref ?scope_p %[1]s } UNION { ?scope_ref %[1]s ?scope_o } ` +
+		`FILTER (NOT EXISTS { ?scope_ref <http://example.org/ns#visibility> "private" }) }`
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			"label of a variable",
+			`SELECT ?l WHERE { ?v <http://www.w3.org/2000/01/rdf-schema#label> ?l }`,
+			[]string{
+				`(!isIRI(?v) || !(STRSTARTS(STR(?v), "http://my-db.org/user_val/") || STRSTARTS(STR(?v), "http://my-db.org/user_prop/")) || ` +
+					fmt.Sprintf(refs, "?v") + `)`,
+			},
+		},
+		{
+			"label of a written value",
+			`SELECT ?l WHERE { <http://my-db.org/user_val/%E8%B5%A4> <http://www.w3.org/2000/01/rdf-schema#label> ?l }`,
+			[]string{fmt.Sprintf(refs, "<http://my-db.org/user_val/%E8%B5%A4>")},
+		},
+		{
+			"prefixed value",
+			`PREFIX uv: <http://my-db.org/user_val/> ASK { uv:red ?p ?o }`,
+			[]string{fmt.Sprintf(refs, "<http://my-db.org/user_val/red>")},
+		},
+	}
+	for _, tt := range tests {
+		out, err := Scope(tt.query, r)
+		if err != nil {
+			t.Errorf("%s: Scope error = %v", tt.name, err)
+			continue
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(out.Query, w) {
+				t.Errorf("%s: query does not contain\n%s\n%s", tt.name, w, out.Query)
+			}
+		}
+		// 差し込んだものも含めて括弧が揃っていること
+		toks, err := tokenize(out.Query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		depth := 0
+		for _, tok := range toks {
+			switch tok.text {
+			case "{", "(":
+				depth++
+			case "}", ")":
+				depth--
+			}
+		}
+		if depth != 0 {
+			t.Errorf("%s: unbalanced rewrite\n%s", tt.name, out.Query)
+		}
+	}
+
+	// Dependents が無ければ今までどおり
+	out, err := Scope(`SELECT ?l WHERE { ?v ?p ?l }`, testRestriction(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.Query, "scope_ref") {
+		t.Errorf("dependents check without Dependents:\n%s", out.Query)
+	}
+}
+
+func TestScopeLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		maxLimit int
+		limit    int
+		contains string // 書き換え後に含まれるもの
+		absent   string // 書き換え後に含まれてはいけないもの
+	}{
+		{"missing", `SELECT * WHERE { ?s ?p ?o }`, 100, 100, "\nLIMIT 100\n", ""},
+		{"within", `SELECT * WHERE { ?s ?p ?o } LIMIT 5`, 100, 5, "LIMIT 5", "LIMIT 100"},
+		{"equal", `SELECT * WHERE { ?s ?p ?o } LIMIT 100`, 100, 100, "LIMIT 100", ""},
+		{"oversized", `SELECT * WHERE { ?s ?p ?o } LIMIT 100000`, 100, 100, "LIMIT 100", "100000"},
+		{"oversized with offset", `SELECT * WHERE { ?s ?p ?o } ORDER BY ?s OFFSET 10 LIMIT 5000`, 100, 100, "OFFSET 10 LIMIT 100", "5000"},
+		{"lowercase", `select * where { ?s ?p ?o } limit 5000`, 100, 100, "limit 100", "5000"},
+		{"nested only", `SELECT * WHERE { { SELECT ?s WHERE { ?s ?p ?o } LIMIT 5000 } }`, 100, 100, "\nLIMIT 100\n", ""},
+		{"nested and outer", `SELECT * WHERE { { SELECT ?s WHERE { ?s ?p ?o } LIMIT 5 } } LIMIT 5000`, 100, 100, "} } LIMIT 100", "5000"},
+		{"before trailing values", `SELECT * WHERE { ?s ?p ?o } VALUES ?s { <http://x/a> }`, 100, 100, "\nLIMIT 100\nVALUES", ""},
+		{"construct", `CONSTRUCT { ?s ?p ?o } WHERE { ?s ?p ?o } LIMIT 1000`, 100, 100, "LIMIT 100", "1000"},
+		{"ask has no limit", `ASK { ?s ?p ?o }`, 100, 0, "", "LIMIT"},
+		{"no max", `SELECT * WHERE { ?s ?p ?o } LIMIT 100000`, 0, 0, "LIMIT 100000", ""},
+	}
+	for _, tt := range tests {
+		r := testRestriction("")
+		r.MaxLimit = tt.maxLimit
+		out, err := Scope(tt.query, r)
+		if err != nil {
+			t.Errorf("%s: Scope error = %v", tt.name, err)
+			continue
+		}
+		if out.Limit != tt.limit {
+			t.Errorf("%s: Limit = %d, want %d", tt.name, out.Limit, tt.limit)
+		}
+		if tt.contains != "" && !strings.Contains(out.Query, tt.contains) {
+			t.Errorf("%s: query does not contain %q\n%s", tt.name, tt.contains, out.Query)
+		}
+		if tt.absent != "" && strings.Contains(out.Query, tt.absent) {
+			t.Errorf("%s: query still contains %q\n%s", tt.name, tt.absent, out.Query)
+		}
+	}
+}
+
+// checkFiltered: 書き換え後の問い合わせを読み直して、三つ組に変数が出てくるグループごとに
+// そのグループ直下の FILTER がすべての変数を調べているかを確かめる。調べたグループの数を返す
+func checkFiltered(t *testing.T, name, query string) int {
+	t.Helper()
+	toks, err := tokenize(query)
+	if err != nil {
+		t.Fatalf("%s: rewritten query does not tokenize: %v\n%s", name, err, query)
+	}
+
+	type frame struct {
+		data, subSelect bool
+		parens          int // BIND (...) や VALUES (...) の中の変数は三つ組ではない
+		vars, filtered  map[string]bool
+	}
+	var stack []*frame
+	pendingData := false
+	checked := 0
+	inWhere := false
+
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		switch tok.keyword() {
+		case "WHERE", "ASK":
+			inWhere = true
+		case "VALUES":
+			pendingData = true
+		}
+		if !inWhere {
+			// CONSTRUCT のテンプレートは対象外
+			continue
+		}
+		var f *frame
+		if len(stack) > 0 {
+			f = stack[len(stack)-1]
+		}
+
+		switch {
+		case tok.text == "{":
+			nf := &frame{vars: map[string]bool{}, filtered: map[string]bool{}}
+			if pendingData || (f != nil && f.data) {
+				nf.data = true
+				pendingData = false
+			}
+			stack = append(stack, nf)
+			continue
+		case tok.text == "}":
+			if f == nil {
+				t.Fatalf("%s: unbalanced braces\n%s", name, query)
+			}
+			if !f.data && !f.subSelect && len(f.vars) > 0 {
+				checked++
+				var missing []string
+				for v := range f.vars {
+					if !f.filtered[v] {
+						missing = append(missing, v)
+					}
+				}
+				sort.Strings(missing)
+				if len(missing) > 0 {
+					t.Errorf("%s: group does not filter %v\n%s", name, missing, query)
+				}
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if f == nil || f.data {
+			continue
+		}
+
+		switch {
+		case tok.keyword() == "SELECT":
+			f.subSelect = true
+		case tok.keyword() == "FILTER" && i+1 < len(toks) && toks[i+1].text == "(":
+			// FILTER ( ... ) を読み飛ばしながら、!BOUND(?x) で調べている変数を集める
+			// (FILTER EXISTS { ... } は ( が無いので、次のグループとして読む)
+			depth := 0
+			j := i + 1
+			for ; j < len(toks); j++ {
+				switch toks[j].text {
+				case "(":
+					depth++
+				case ")":
+					depth--
+				}
+				if toks[j].keyword() == "BOUND" && j+2 < len(toks) && toks[j+2].kind == tokVar {
+					f.filtered[toks[j+2].text] = true
+				}
+				if depth == 0 {
+					break
+				}
+			}
+			i = j
+		case tok.text == "(":
+			f.parens++
+		case tok.text == ")":
+			f.parens--
+		case tok.kind == tokVar && !f.subSelect && f.parens == 0:
+			f.vars[tok.text] = true
+		}
+	}
+	return checked
+}
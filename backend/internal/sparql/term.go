@@ -0,0 +1,176 @@
+package sparql
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SPARQL に埋め込む値 (IRI・リテラル)
+// クエリに文字列をそのまま fmt.Sprintf で埋めると、" や > を含む入力でクエリを書き換えられてしまう
+// Term はエスケープ・検証済みの値しか作れないので、Format に渡せば安全に埋め込めるのだ
+
+// ErrInvalidTerm: IRI や言語タグとして使えない値
+var ErrInvalidTerm = errors.New("SPARQL に埋め込めない値なのだ")
+
+// Term: クエリに埋め込める値
+type Term interface {
+	// SPARQL の構文として書いたときの形 (<...> や "..."@ja)
+	SPARQL() string
+}
+
+// ---------------------------------------------------
+// IRI
+// ---------------------------------------------------
+
+// IRI: <http://...> の形で埋め込まれる
+type IRI struct {
+	value string
+}
+
+// NewIRI: 絶対IRIかどうか・使えない文字が入っていないかを確かめて IRI を作る
+// SPARQL の IRIREF では < > " { } | ^ ` \ と空白・制御文字が使えない
+// (IRIREF としては通る U+00A0 などの空白や C1 の制御文字も、取り違えのもとなので断る)
+func NewIRI(s string) (IRI, error) {
+	if s == "" {
+		return IRI{}, fmt.Errorf("%w: IRI が空", ErrInvalidTerm)
+	}
+	if !utf8.ValidString(s) {
+		return IRI{}, fmt.Errorf("%w: IRI が UTF-8 じゃない", ErrInvalidTerm)
+	}
+	for _, c := range s {
+		if c <= 0x20 || unicode.IsSpace(c) || unicode.IsControl(c) || strings.ContainsRune("<>\"{}|^`\\", c) {
+			return IRI{}, fmt.Errorf("%w: IRI に使えない文字 %q が入っている", ErrInvalidTerm, c)
+		}
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return IRI{}, fmt.Errorf("%w: 絶対IRIじゃない: %q", ErrInvalidTerm, s)
+	}
+	return IRI{value: s}, nil
+}
+
+// MustIRI: 定数のIRI用 (不正ならパニックする)
+func MustIRI(s string) IRI {
+	iri, err := NewIRI(s)
+	if err != nil {
+		panic(err)
+	}
+	return iri
+}
+
+// Value: <> を付けない IRI そのもの
+func (i IRI) Value() string { return i.value }
+
+func (i IRI) SPARQL() string { return "<" + i.value + ">" }
+
+// ---------------------------------------------------
+// リテラル
+// ---------------------------------------------------
+
+// よく使うデータ型
+var (
+	XSDInteger  = MustIRI("http://www.w3.org/2001/XMLSchema#integer")
+	XSDDecimal  = MustIRI("http://www.w3.org/2001/XMLSchema#decimal")
+	XSDBoolean  = MustIRI("http://www.w3.org/2001/XMLSchema#boolean")
+	XSDDateTime = MustIRI("http://www.w3.org/2001/XMLSchema#dateTime")
+)
+
+// Literal: "..." / "..."@ja / "..."^^<datatype>
+type Literal struct {
+	lexical  string
+	lang     string
+	datatype IRI
+}
+
+// String: 言語タグもデータ型も無い文字列リテラル
+func String(s string) Literal {
+	return Literal{lexical: s}
+}
+
+// 言語タグ (BCP47 の大まかな形: ja, en-US, zh-Hant-TW)
+var reLangTag = regexp.MustCompile(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`)
+
+// LangString: "..."@ja
+func LangString(s, lang string) (Literal, error) {
+	if !reLangTag.MatchString(lang) {
+		return Literal{}, fmt.Errorf("%w: 言語タグが不正: %q", ErrInvalidTerm, lang)
+	}
+	return Literal{lexical: s, lang: strings.ToLower(lang)}, nil
+}
+
+// Typed: "..."^^<datatype>
+func Typed(s string, datatype IRI) Literal {
+	return Literal{lexical: s, datatype: datatype}
+}
+
+// DateTime: "2024-01-01T00:00:00Z"^^xsd:dateTime
+func DateTime(t time.Time) Literal {
+	return Typed(t.Format(time.RFC3339), XSDDateTime)
+}
+
+// Lexical: エスケープ前の中身
+func (l Literal) Lexical() string { return l.lexical }
+
+func (l Literal) SPARQL() string {
+	s := `"` + Escape(l.lexical) + `"`
+	switch {
+	case l.lang != "":
+		s += "@" + l.lang
+	case l.datatype.value != "":
+		s += "^^" + l.datatype.SPARQL()
+	}
+	return s
+}
+
+// Integer: 5 のように数字だけで書く (LIMIT / OFFSET にも使える)
+type Integer int
+
+func (n Integer) SPARQL() string { return strconv.Itoa(int(n)) }
+
+// ---------------------------------------------------
+// エスケープ
+// ---------------------------------------------------
+
+// Escape: "..." の中に入れられるように文字列をエスケープする
+// SPARQL の ECHAR (\t \b \n \r \f \" \' \\) と、それ以外の制御文字は \uXXXX にする
+func Escape(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for _, c := range s {
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case utf8.RuneError:
+			// 壊れたバイト列は置換文字にしておく (Fuseki が UTF-8 として読めなくなるため)
+			b.WriteRune(utf8.RuneError)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, c)
+				continue
+			}
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,177 @@
+package sparql
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// エスケープした文字列を "..." に入れると、何を入れても1つの文字列として読まれること
+// (途中で閉じたり、改行が入って後ろのクエリが書き換えられたりしない)
+func FuzzEscape(f *testing.F) {
+	for _, s := range []string{
+		"", "Homo sapiens", `"`, `\`, `\"`, `" } ; DROP ALL ; #`, "a\nb", "a\rb", "\t\b\f",
+		"'''", `"""`, "\x00\x1f\x7f", "日本語", "\xff\xfe", "}\n} INSERT DATA { <a> <b> <c> }",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		lit := String(s).SPARQL()
+		if strings.ContainsAny(lit, "\n\r") {
+			t.Fatalf("escaped literal contains a newline: %q", lit)
+		}
+
+		src := "SELECT * WHERE { ?s ?p " + lit + " }"
+		toks, err := tokenize(src)
+		if err != nil {
+			t.Fatalf("tokenize(%q): %v", src, err)
+		}
+		var strs []token
+		for _, tok := range toks {
+			if tok.kind == tokString {
+				strs = append(strs, tok)
+			}
+		}
+		if len(strs) != 1 || strs[0].text != lit {
+			t.Fatalf("literal %q was not read as one string: %v", lit, strs)
+		}
+		if last := toks[len(toks)-1]; last.kind != tokPunct || last.text != "}" {
+			t.Fatalf("query does not end with the closing brace: %v", toks)
+		}
+
+		// 壊れたバイト列でなければ、読み戻すと元の文字列になる
+		if utf8.ValidString(s) {
+			if got := unescape(t, lit[1:len(lit)-1]); got != s {
+				t.Fatalf("unescape(Escape(%q)) = %q", s, got)
+			}
+		}
+	})
+}
+
+// unescape: SPARQL の ECHAR と \uXXXX を戻す (テスト用)
+func unescape(t *testing.T, s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case '"', '\'', '\\':
+			b.WriteByte(s[i])
+		case 'u':
+			n, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				t.Fatalf("bad \\u escape in %q", s)
+			}
+			b.WriteRune(rune(n))
+			i += 4
+		default:
+			t.Fatalf("unknown escape \\%c in %q", s[i], s)
+		}
+	}
+	return b.String()
+}
+
+// 受け付けた IRI には IRIREF で使えない文字や空白が入っておらず、<...> が1つの IRI として読まれること
+func FuzzNewIRI(f *testing.F) {
+	for _, s := range []string{
+		"http://example.org/a", "http://purl.obolibrary.org/obo/NCBITaxon_9606", "urn:uuid:1234",
+		"http://example.org/a b", "http://example.org/>", "http://example.org/a> } ; DROP ALL ; <x",
+		"http://example.org/ ", "http://example.org/ ", "relative/path", "", "http://例え.jp/",
+		"http://example.org/{x}", "mailto:a@example.org", "http://example.org/%20",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		iri, err := NewIRI(s)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidTerm) {
+				t.Fatalf("NewIRI(%q) error is not ErrInvalidTerm: %v", s, err)
+			}
+			return
+		}
+		if strings.ContainsAny(s, "<>\"{}|^`\\") {
+			t.Fatalf("NewIRI accepted %q with a forbidden character", s)
+		}
+		if strings.ContainsFunc(s, func(r rune) bool { return r <= 0x20 || unicode.IsSpace(r) || unicode.IsControl(r) }) {
+			t.Fatalf("NewIRI accepted %q with whitespace or a control character", s)
+		}
+		toks, err := tokenize(iri.SPARQL())
+		if err != nil || len(toks) != 1 || toks[0].kind != tokIRI {
+			t.Fatalf("%q was not read as one IRI: %v %v", iri.SPARQL(), toks, err)
+		}
+	})
+}
+
+func TestNewIRI(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"http://example.org/a", true},
+		{"http://purl.obolibrary.org/obo/NCBITaxon_9606", true},
+		{"urn:uuid:0b7c2f0e-5d7a-4c8e-9a55-1f1f4c3e2a10", true},
+		{"", false},
+		{"relative/path", false},
+		{"http://example.org/a b", false},
+		{"http://example.org/a>", false},
+		{"http://example.org/\"", false},
+		{"http://example.org/{a}", false},
+		{"http://example.org/a|b", false},
+		{"http://example.org/a^b", false},
+		{"http://example.org/a`b", false},
+		{`http://example.org/a\b`, false},
+		{"http://example.org/ ", false},
+		{"http://example.org/\x7f", false},
+		{"http://example.org/\xff", false},
+	}
+	for _, tt := range tests {
+		_, err := NewIRI(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewIRI(%q) error = %v, want ok=%v", tt.in, err, tt.ok)
+		}
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	ja, err := LangString("ヒト", "JA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		in   Literal
+		want string
+	}{
+		{"plain", String("Homo sapiens"), `"Homo sapiens"`},
+		{"quote", String(`say "hi"`), `"say \"hi\""`},
+		{"newline", String("a\nb"), `"a\nb"`},
+		{"control", String("a\x01b"), `"a\u0001b"`},
+		{"lang", ja, `"ヒト"@ja`},
+		{"typed", Typed("5", XSDInteger), `"5"^^<http://www.w3.org/2001/XMLSchema#integer>`},
+	}
+	for _, tt := range tests {
+		if got := tt.in.SPARQL(); got != tt.want {
+			t.Errorf("%s: SPARQL() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := LangString("x", "ja\" } DROP ALL"); !errors.Is(err, ErrInvalidTerm) {
+		t.Errorf("LangString accepted a bad tag: %v", err)
+	}
+}
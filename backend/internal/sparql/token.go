@@ -0,0 +1,228 @@
+package sparql
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Scope 用の簡単な字句解析
+// 構文木までは作らず、文字列・IRI・コメントの中の { } や ? を取り違えない程度に区切るのだ
+
+type tokenKind int
+
+const (
+	tokPunct   tokenKind = iota // { } ( ) . ; , / ^ など
+	tokWord                     // キーワード・関数名・a・true
+	tokIRI                      // <http://...>
+	tokPName                    // dwc:Occurrence
+	tokVar                      // ?x / $x
+	tokBNode                    // _:b0
+	tokString                   // "..." / '...' / """...""" / '''...'''
+	tokLangTag                  // @ja
+	tokNumber                   // 10 / 1.5 / -2e3
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // 元の文字列でのバイト位置
+}
+
+// keyword: キーワードなら大文字にしたもの (それ以外は空)
+func (t token) keyword() string {
+	if t.kind != tokWord {
+		return ""
+	}
+	return strings.ToUpper(t.text)
+}
+
+// 2文字の記号
+var punct2 = []string{"^^", "||", "&&", "!=", "<=", ">="}
+
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+
+		case c == '#':
+			// コメントは \n でも \r でも終わる (SPARQL 1.1 §19.4)
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+			continue
+
+		case c == '<':
+			if end := scanIRI(src, i); end > 0 {
+				toks = append(toks, token{tokIRI, src[i:end], i})
+				i = end
+				continue
+			}
+
+		case c == '"' || c == '\'':
+			end, ok := scanString(src, i)
+			if !ok {
+				return nil, rejectf("文字列が閉じていないのだ")
+			}
+			toks = append(toks, token{tokString, src[i:end], i})
+			i = end
+			continue
+
+		case (c == '?' || c == '$') && i+1 < len(src) && isNameStart(src[i+1:]):
+			end := scanName(src, i+1, false)
+			toks = append(toks, token{tokVar, src[i:end], i})
+			i = end
+			continue
+
+		case c == '_' && i+1 < len(src) && src[i+1] == ':':
+			end := scanName(src, i+2, true)
+			toks = append(toks, token{tokBNode, src[i:end], i})
+			i = end
+			continue
+
+		case c == '@':
+			end := i + 1
+			for end < len(src) && (isASCIILetter(src[end]) || isDigit(src[end]) || src[end] == '-') {
+				end++
+			}
+			toks = append(toks, token{tokLangTag, src[i:end], i})
+			i = end
+			continue
+
+		case isDigit(c) || ((c == '+' || c == '-' || c == '.') && i+1 < len(src) && isDigit(src[i+1])):
+			end := scanNumber(src, i)
+			toks = append(toks, token{tokNumber, src[i:end], i})
+			i = end
+			continue
+
+		case c == ':' || isNameStart(src[i:]):
+			end := scanName(src, i, true)
+			text := src[i:end]
+			kind := tokWord
+			if strings.Contains(text, ":") {
+				kind = tokPName
+			}
+			toks = append(toks, token{kind, text, i})
+			i = end
+			continue
+		}
+
+		matched := false
+		for _, p := range punct2 {
+			if strings.HasPrefix(src[i:], p) {
+				toks = append(toks, token{tokPunct, p, i})
+				i += len(p)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			_, size := utf8.DecodeRuneInString(src[i:])
+			toks = append(toks, token{tokPunct, src[i : i+size], i})
+			i += size
+		}
+	}
+	return toks, nil
+}
+
+// scanIRI: <...> が IRIREF として読めれば閉じ > の次の位置 (読めなければ 0 で、比較演算子の < になる)
+func scanIRI(src string, start int) int {
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		if c == '>' {
+			return i + 1
+		}
+		if c <= 0x20 || strings.IndexByte("<\"{}|^`\\", c) >= 0 {
+			return 0
+		}
+	}
+	return 0
+}
+
+func scanString(src string, start int) (int, bool) {
+	q := src[start]
+	long := strings.HasPrefix(src[start:], strings.Repeat(string(q), 3))
+	i := start + 1
+	if long {
+		i = start + 3
+	}
+	for i < len(src) {
+		switch {
+		case src[i] == '\\':
+			i += 2
+		case long && strings.HasPrefix(src[i:], strings.Repeat(string(q), 3)):
+			return i + 3, true
+		case !long && src[i] == q:
+			return i + 1, true
+		case !long && (src[i] == '\n' || src[i] == '\r'):
+			return 0, false
+		default:
+			i++
+		}
+	}
+	return 0, false
+}
+
+func scanNumber(src string, start int) int {
+	i := start
+	if src[i] == '+' || src[i] == '-' {
+		i++
+	}
+	for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+		// 1. のように終わる場合の . は三つ組の区切り
+		if src[i] == '.' && (i+1 >= len(src) || !isDigit(src[i+1])) {
+			break
+		}
+		i++
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && isDigit(src[j]) {
+			i = j
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+// scanName: 変数名・キーワード・接頭辞付きの名前を読む
+// withColon なら : と . (末尾以外) と - も名前の一部にする
+func scanName(src string, start int, withColon bool) int {
+	i := start
+	for i < len(src) {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		case withColon && (r == ':' || r == '-' || r == '%'):
+		case withColon && r == '.':
+			if i+1 >= len(src) || !isNameStart(src[i+1:]) && !isDigit(src[i+1]) {
+				return i
+			}
+		case withColon && r == '\\' && i+1 < len(src):
+			size = 2
+		default:
+			return i
+		}
+		i += size
+	}
+	return i
+}
+
+func isNameStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isASCIILetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/saku-730/bio-occurrence/backend/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OpenTelemetry のトレース
+// ハンドラー (otelgin) → サービス → リポジトリ (SPARQL・Meilisearch) の順に span が入れ子になる
+// 送り先が設定されていなければ何もしない (span は作られるが捨てられる)
+
+const tracerName = "github.com/saku-730/bio-occurrence/backend"
+
+var tracer = otel.Tracer(tracerName)
+
+// Setup: OTLP/HTTP でコレクターに送る TracerProvider をグローバルに設定する
+// 戻り値の関数は終了時に呼ぶ (溜まっている span を送り切る)
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	// traceparent ヘッダーの受け渡しは送り先が無くても有効にしておく (上流のトレースを下流に繋ぐため)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	endpoint, err := tracesURL(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("トレースの送り先を作れなかったのだ: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// 上流でサンプリングされたリクエストはこちらでも必ず記録する
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// tracesURL: http://localhost:4318 のようにパスが無ければ /v1/traces を付ける
+// (OTEL_EXPORTER_OTLP_ENDPOINT の決まりに合わせる)
+func tracesURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("トレースの送り先のURLが不正なのだ: %w", err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	} else if !strings.HasSuffix(u.Path, "/v1/traces") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// Start: span を開始する。サービス層では
+//
+//	ctx, span := tracing.Start(ctx, "OccurrenceService.Create")
+//	defer func() { tracing.End(span, err) }()
+//
+// のように使う
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartClient: 外部 (Fuseki・Meilisearch) を呼ぶ span を開始する
+func StartClient(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// Transport: 外部へのHTTPリクエストに traceparent ヘッダーを付ける RoundTripper
+// Fuseki・Meilisearch 側のログやトレースとも繋がるようにするため
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return propagatingTransport{base: base}
+}
+
+type propagatingTransport struct {
+	base http.RoundTripper
+}
+
+func (t propagatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper は受け取ったリクエストを書き換えてはいけないので複製してから付ける
+	req = req.Clone(req.Context())
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return t.base.RoundTrip(req)
+}
+
+// End: エラーがあれば span に記録してから終える
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,29 @@
+package utils
+
+import "strings"
+
+const oboBase = "http://purl.obolibrary.org/obo/"
+
+// ExpandTermID: 画面で使う短いID (ncbi:9606 / PATO:0000001) を OBO の IRI に戻す
+// http で始まるものはそのまま返す
+func ExpandTermID(id string) string {
+	if strings.HasPrefix(id, "http") {
+		return id
+	}
+	safeID := strings.ReplaceAll(id, ":", "_")
+	if strings.HasPrefix(id, "ncbi:") {
+		safeID = strings.Replace(safeID, "ncbi_", "NCBITaxon_", 1)
+	}
+	return oboBase + safeID
+}
+
+// ShortenTermID: ExpandTermID の逆 (OBO 以外の IRI はそのまま返す)
+func ShortenTermID(uri string) string {
+	if strings.Contains(uri, "/obo/") {
+		parts := strings.Split(uri, "/obo/")
+		id := parts[len(parts)-1]
+		id = strings.Replace(id, "NCBITaxon_", "ncbi:", 1)
+		return strings.ReplaceAll(id, "_", ":")
+	}
+	return uri
+}
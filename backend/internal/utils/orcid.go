@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var reORCID = regexp.MustCompile(`^\d{4}-\d{4}-\d{4}-\d{3}[\dX]$`)
+
+// NormalizeORCID: "https://orcid.org/0000-0002-1825-0097" のような形も受け付けて
+// "0000-0002-1825-0097" に揃え、チェックディジット (ISO 7064 MOD 11-2) を確認する
+func NormalizeORCID(raw string) (string, error) {
+	id := strings.TrimSpace(raw)
+	id = strings.TrimPrefix(id, "https://orcid.org/")
+	id = strings.TrimPrefix(id, "http://orcid.org/")
+	id = strings.ToUpper(id)
+
+	if !reORCID.MatchString(id) {
+		return "", fmt.Errorf("ORCID iD の形式が不正なのだ: %s", raw)
+	}
+
+	digits := strings.ReplaceAll(id, "-", "")
+	total := 0
+	for _, c := range digits[:15] {
+		total = (total + int(c-'0')) * 2
+	}
+	check := (12 - total%11) % 11
+	expected := byte('0' + check)
+	if check == 10 {
+		expected = 'X'
+	}
+	if digits[15] != expected {
+		return "", fmt.Errorf("ORCID iD のチェックディジットが合わないのだ: %s", raw)
+	}
+	return id, nil
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// 学名の表記ゆれをそろえる (古い表計算ファイルの学名を ncbitaxon と照らし合わせるため)
+
+// 種より下の階級の記号 (書き方の違うものは左の形にそろえる)
+var infraRankMarkers = map[string]string{
+	"subsp.": "subsp.", "subsp": "subsp.", "ssp.": "subsp.", "ssp": "subsp.",
+	"var.": "var.", "var": "var.", "subvar.": "subvar.",
+	"f.": "f.", "forma": "f.", "fo.": "f.", "subf.": "subf.",
+}
+
+// 名前の途中にあっても読み飛ばす語 (同定があいまいなことを示すだけ)
+var uncertainMarkers = map[string]bool{"cf.": true, "cf": true, "aff.": true, "aff": true, "nr.": true, "?": true}
+
+// ここから後は種名ではない (sp. は種が決まっていない印)
+var speciesStops = map[string]bool{"sp.": true, "sp": true, "spp.": true, "spp": true, "sp.nov.": true, "indet.": true}
+
+// 小文字で始まるが著者名の一部になる語 (de Candolle など)
+var authorParticles = map[string]bool{"de": true, "da": true, "del": true, "della": true, "di": true, "du": true, "van": true, "von": true, "der": true, "ex": true, "in": true, "et": true, "emend.": true, "non": true}
+
+var (
+	reEpithet = regexp.MustCompile(`^[a-z][a-z-]*$`)
+	reGenus   = regexp.MustCompile(`^[A-Za-z][A-Za-z-]*$`)
+)
+
+// CleanTaxonName: 前後と間の空白をそろえ、交雑の記号 × を x にする (大文字小文字や著者名はそのまま)
+func CleanTaxonName(raw string) string {
+	s := strings.ReplaceAll(raw, "×", " x ")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// CanonicalTaxonName: 学名から著者名・年・cf. などを外して、属名だけ大文字で始まる形にする
+// 例: "HOMO SAPIENS Linnaeus, 1758" → "Homo sapiens"、"Mentha ×piperita L." → "Mentha x piperita"
+// 属名が読み取れなければ空
+func CanonicalTaxonName(raw string) string {
+	s := CleanTaxonName(raw)
+	// すべて大文字で書かれていたら、著者名と区別がつかないので小文字にしてから読む
+	if !strings.ContainsFunc(s, unicode.IsLower) {
+		s = strings.ToLower(s)
+	}
+	s = strings.NewReplacer(",", " , ", "(", " ( ", ")", " ) ").Replace(s)
+	tokens := strings.Fields(s)
+
+	var parts []string
+	i := 0
+	// 属の交雑 (× Agropogon など)
+	if i < len(tokens) && strings.EqualFold(tokens[i], "x") {
+		parts = append(parts, "x")
+		i++
+	}
+	if i >= len(tokens) || !reGenus.MatchString(tokens[i]) {
+		return ""
+	}
+	genus := strings.ToLower(tokens[i])
+	parts = append(parts, strings.ToUpper(genus[:1])+genus[1:])
+	i++
+	// 属名の直後の (亜属名) は外す
+	if i+2 < len(tokens) && tokens[i] == "(" && tokens[i+2] == ")" {
+		i += 3
+	}
+
+	marker := "" // 直前に出た階級の記号 (次の小名と組にする)
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		lower := strings.ToLower(tok)
+		switch {
+		case uncertainMarkers[lower]:
+			continue
+		case speciesStops[lower]:
+			return strings.Join(parts, " ")
+		case lower == "x":
+			parts = append(parts, "x")
+			continue
+		case infraRankMarkers[lower] != "" && len(parts) > 1:
+			marker = infraRankMarkers[lower]
+			continue
+		case authorParticles[tok] || !reEpithet.MatchString(tok):
+			// 大文字で始まる語・数字・括弧・カンマから後は著者名と年
+			return strings.Join(parts, " ")
+		}
+		if marker != "" {
+			parts = append(parts, marker)
+			marker = ""
+		}
+		parts = append(parts, tok)
+	}
+	return strings.Join(parts, " ")
+}
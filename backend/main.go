@@ -1,62 +1,235 @@
 package main
 
 import (
+	"github.com/saku-730/bio-occurrence/backend/internal/config"
 	"github.com/saku-730/bio-occurrence/backend/internal/handler"
+	"github.com/saku-730/bio-occurrence/backend/internal/metrics"
 	"github.com/saku-730/bio-occurrence/backend/internal/repository"
 	"github.com/saku-730/bio-occurrence/backend/internal/router"
 	"github.com/saku-730/bio-occurrence/backend/internal/service"
+	"github.com/saku-730/bio-occurrence/backend/internal/tracing"
 	"github.com/saku-730/bio-occurrence/backend/internal/infrastructure"
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"os"
-)
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
-// 設定定数 (本来は環境変数から読むべき)
-const (
-	PGHost = "localhost"
-	PGPort = "5432"
-	PGUser = "bio_user"
-	PGPass = "14afqrzv" // docker-compose.ymlと合わせる！
-	PGDB   = "bio_auth"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
-	meiliURL := getEnv("NEXT_PUBLIC_MEILI_URL")
-	meiliKey := getEnv("NEXT_PUBLIC_MEILI_KEY")
-	fusekiURL := getEnv("FUSEKI_URL")
-	fusekiUser := getEnv("FUSEKI_USER")
-	fusekiPass := getEnv("FUSEKI_PASSWORD")
+	// 1. 設定の読み込み (設定ファイル → 環境変数 → フラグ の順に上書き)
+	cfg := config.MustLoad(config.SectionPostgres, config.SectionFuseki, config.SectionMeili)
+	uris := cfg.URIs.BaseURIs()
 
-	pgDBConn := infrastructure.NewPostgresDB(PGHost, PGPort, PGUser, PGPass, PGDB)
+	// gin のデバッグ出力 (ルート一覧など) は log.level=debug のときだけ
+	if os.Getenv("GIN_MODE") == "" && cfg.Log.Level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// トレース (送り先が設定されていなければ何もしない)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("tracing setup failed", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		// 溜まっている span を送り切ってから終わる
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("tracing shutdown failed", "error", err)
+		}
+	}()
+	if cfg.Tracing.Endpoint != "" {
+		slog.Info("tracing enabled", "endpoint", cfg.Tracing.Endpoint, "service", cfg.Tracing.ServiceName, "sample_ratio", cfg.Tracing.SampleRatio)
+	}
+
+	pgDBConn := infrastructure.NewPostgresDB(cfg.Postgres.Host, cfg.Postgres.Port, cfg.Postgres.User, cfg.Postgres.Password, cfg.Postgres.DBName)
+	defer pgDBConn.Close()
+	metrics.RegisterDBStats(pgDBConn, cfg.Postgres.DBName)
+
+	// 依存先の立ち上がりを待つ (docker compose で一斉に起動したときのため)
+	deps := []infrastructure.DependencyCheck{
+		infrastructure.PostgresCheck(pgDBConn),
+		infrastructure.FusekiCheck(cfg.Fuseki.QueryURL(), cfg.Fuseki.User, cfg.Fuseki.Password),
+		infrastructure.MeiliCheck(cfg.Meili.URL),
+	}
+	for _, dep := range deps {
+		if err := infrastructure.WaitFor(dep, cfg.Server.StartupTimeout.Std(), cfg.Server.ReadyTimeout.Std()); err != nil {
+			slog.Error("dependency unavailable", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	// 2. 依存関係の組み立て (DI)
 	// リポジトリ
-	occRepo := repository.NewOccurrenceRepository(fusekiURL, fusekiUser, fusekiPass)
-	searchRepo := repository.NewSearchRepository(meiliURL, meiliKey)
+	occRepo := repository.NewOccurrenceRepository(cfg.Fuseki.URL, cfg.Fuseki.User, cfg.Fuseki.Password, uris, cfg.Log.SlowQueryThreshold.Std())
+	searchRepo := repository.NewSearchRepository(cfg.Meili.URL, cfg.Meili.Key)
+	classRepo := repository.NewClassificationRepository(cfg.Meili.URL, cfg.Meili.Key)
 	userRepo := repository.NewUserRepository(pgDBConn)
+	tokenRepo := repository.NewTokenRepository(pgDBConn)
+	apiKeyRepo := repository.NewAPIKeyRepository(pgDBConn)
+	identityRepo := repository.NewIdentityRepository(pgDBConn)
+	auditRepo := repository.NewAuditRepository(pgDBConn)
+	outboxRepo := repository.NewSearchOutboxRepository(pgDBConn)
+	sparqlRepo := repository.NewSPARQLEndpointRepository(cfg.Fuseki.URL, cfg.Fuseki.User, cfg.Fuseki.Password, cfg.SPARQL.MaxResponseBytes, cfg.Log.SlowQueryThreshold.Std())
+
+	// メール送信 (SMTPホストが無ければ開発用にログ出力するだけ)
+	var mailer infrastructure.Mailer
+	if cfg.Mail.SMTPHost != "" {
+		mailer = infrastructure.NewSMTPMailer(cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUser, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	} else {
+		mailer = infrastructure.NewLogMailer(cfg.Mail.LogFile)
+	}
+
+	// レート制限・ログインロックの保存先 (複数台構成なら postgres にする)
+	var limiter infrastructure.RateLimitStore
+	if cfg.RateLimit.Store == "postgres" {
+		limiter = infrastructure.NewPostgresRateLimitStore(pgDBConn)
+	} else {
+		limiter = infrastructure.NewMemoryRateLimitStore()
+	}
 
 	// サービス (★ここで userRepo を渡すのが重要！)
-	occSvc := service.NewOccurrenceService(occRepo, searchRepo, userRepo)
-	userSvc := service.NewUserService(userRepo)
+	auditSvc := service.NewAuditService(auditRepo)
+	lineageCache := service.NewTaxonLineageCache(occRepo)
+	searchSyncSvc := service.NewSearchSyncService(outboxRepo, occRepo, searchRepo, userRepo, auditSvc, lineageCache, cfg.Search.SyncInterval.Std(), cfg.Search.SyncMaxAttempts)
+	reindexSvc := service.NewReindexService(occRepo, searchRepo, userRepo, outboxRepo, auditSvc, lineageCache)
+	occSvc := service.NewOccurrenceService(occRepo, searchRepo, userRepo, auditSvc, searchSyncSvc, uris)
+	taxonSvc := service.NewTaxonService(occRepo, userRepo, lineageCache)
+	exportSvc := service.NewExportService(occRepo, lineageCache)
+	reconcileSvc := service.NewReconcileService(occRepo, classRepo)
+	userSvc := service.NewUserService(userRepo, tokenRepo, mailer, limiter, auditSvc, uris, cfg.Server.AppBaseURL)
+	apiKeySvc := service.NewAPIKeyService(apiKeyRepo, auditSvc, uris)
+	oidcSvc := service.NewOIDCService(loadOIDCProviders(cfg.OIDC), userRepo, identityRepo, auditSvc, uris)
+	profileSvc := service.NewProfileService(userRepo, occRepo, auditSvc, uris)
+	ldSvc := service.NewLinkedDataService(occRepo, uris)
+	sparqlSvc := service.NewSPARQLService(sparqlRepo, uris, cfg.SPARQL.Timeout.Std(), cfg.SPARQL.MaxResults)
 
 	// ハンドラー
-	occHandler := handler.NewOccurrenceHandler(occSvc)
+	occHandler := handler.NewOccurrenceHandler(occSvc, uris, cfg.Server.PublicBaseURL)
+	taxonHandler := handler.NewTaxonHandler(taxonSvc)
+	exportHandler := handler.NewExportHandler(exportSvc)
+	reconcileHandler := handler.NewReconcileHandler(reconcileSvc)
 	userHandler := handler.NewUserHandler(userSvc)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeySvc)
+	oidcHandler := handler.NewOIDCHandler(oidcSvc, cfg.Server.AppBaseURL)
+	profileHandler := handler.NewProfileHandler(profileSvc)
+	auditHandler := handler.NewAuditHandler(auditSvc)
+	searchSyncHandler := handler.NewSearchSyncHandler(searchSyncSvc)
+	reindexHandler := handler.NewReindexHandler(reindexSvc)
+	sparqlHandler := handler.NewSPARQLHandler(sparqlSvc)
+	ldHandler := handler.NewLinkedDataHandler(ldSvc, cfg.Server.AppBaseURL)
+	healthHandler := handler.NewHealthHandler(deps, cfg.Server.ReadyTimeout.Std())
 
 	// 3. ルーターセットアップ
-	r := router.SetupRouter(occHandler, userHandler)
+	r := router.SetupRouter(cfg.Server, cfg.Tracing, uris, occHandler, taxonHandler, exportHandler, reconcileHandler, userHandler, apiKeyHandler, oidcHandler, profileHandler, auditHandler, searchSyncHandler, reindexHandler, sparqlHandler, ldHandler, healthHandler, apiKeySvc, userSvc, limiter)
 
-	// 2. サーバー起動
-	fmt.Println("🚀 APIサーバー起動: http://localhost:8080")
-	r.Run(":8080")
+	// 4. サーバー起動
+	srv := &http.Server{
+		Addr:              cfg.Server.ListenAddr,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Meilisearch への同期ワーカー (終了時は処理中の1件を終えてから止まる)
+	syncCtx, stopSync := context.WithCancel(context.Background())
+	syncDone := make(chan struct{})
+	go func() {
+		searchSyncSvc.Run(syncCtx)
+		close(syncDone)
+	}()
+	// 分類が読み込み直されたら、インデックスの系統を付け直す
+	watchDone := make(chan struct{})
+	go func() {
+		reindexSvc.WatchTaxonomy(syncCtx)
+		close(watchDone)
+	}()
+	// レート制限のバケットと期限切れのログイン失敗記録を定期的に掃除する
+	pruneDone := make(chan struct{})
+	go func() {
+		infrastructure.PruneRateLimits(syncCtx, limiter, 10*time.Minute)
+		close(pruneDone)
+	}()
+	defer func() {
+		stopSync()
+		<-syncDone
+		<-watchDone
+		<-pruneDone
+	}()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		slog.Info("api server started", "addr", cfg.Server.ListenAddr, "url", cfg.Server.LocalURL())
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	// /metrics を別のポートで出す (外に公開しないネットワークで待ち受ける想定なので、IP制限はかけない)
+	var metricsSrv *http.Server
+	if cfg.Server.MetricsListenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		metricsSrv = &http.Server{
+			Addr:              cfg.Server.MetricsListenAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			slog.Info("metrics server started", "addr", cfg.Server.MetricsListenAddr)
+			serverErr <- metricsSrv.ListenAndServe()
+		}()
+	}
+
+	// 5. SIGTERM / Ctrl+C で止めるときは、処理中のリクエストが終わるのを待ってから終了する
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serverErr:
+		slog.Error("api server stopped", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	stop() // 2回目の Ctrl+C ですぐ止められるようにする
+
+	slog.Info("shutdown signal received, draining requests", "drain_delay", cfg.Server.ShutdownDrainDelay.Std(), "timeout", cfg.Server.ShutdownTimeout.Std())
+	healthHandler.StartDraining()
+
+	// /readyz が 503 になったのをロードバランサーが見て外すまでは、新しいリクエストも受け付け続ける
+	// (すぐ Shutdown すると、その間に振り分けられたリクエストが接続を拒否されてしまう)
+	time.Sleep(cfg.Server.ShutdownDrainDelay.Std())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Std())
+	defer cancel()
+	if metricsSrv != nil {
+		// API が止まりきるまではメトリクスを取れるよう、後で閉じる
+		defer metricsSrv.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("shutdown timed out", "error", err)
+		return
+	}
+	slog.Info("api server stopped gracefully")
 }
 
 
-func getEnv(key string) string {
-	value, ok := os.LookupEnv(key)
-	if !ok {
-		// ログを出してプログラムを終了させる（これが安全！）
-		log.Fatalf("❌ 致命的エラー: 必須環境変数 '%s' が設定されていない！ .envファイルを確認するか、exportコマンドで設定する", key)
+// loadOIDCProviders: 設定のプロバイダー (ORCID・大学SSO) を組み立てる
+func loadOIDCProviders(oidcCfg config.OIDCConfig) []*infrastructure.OIDCProvider {
+	var providers []*infrastructure.OIDCProvider
+	for _, p := range oidcCfg.Providers {
+		providers = append(providers, infrastructure.NewOIDCProvider(infrastructure.OIDCProviderConfig{
+			Name:         p.Name,
+			IssuerURL:    p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}))
 	}
-	return value
+	return providers
 }
@@ -0,0 +1,24 @@
+-- +goose Up
+-- メールアドレス確認済みかどうか (NULL = 未確認)
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- 既存ユーザーは確認済み扱いにしておく (いきなり公開できなくなると困るので)
+UPDATE users SET email_verified_at = created_at;
+
+-- パスワードリセット・メール確認用のワンタイムトークン
+-- token_hash には SHA-256 のハッシュだけを保存して、生のトークンは持たない
+CREATE TABLE auth_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,              -- password_reset, email_verify
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,          -- 使用済みなら日時が入る
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_auth_tokens_user_purpose ON auth_tokens (user_id, purpose);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth_tokens;
+ALTER TABLE users DROP COLUMN email_verified_at;
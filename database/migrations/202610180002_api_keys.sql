@@ -0,0 +1,20 @@
+-- +goose Up
+-- スクリプト・パイプライン用の個人APIキー
+-- key_hash には SHA-256 のハッシュだけを保存する (生のキーは作成時に一度だけ返す)
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,               -- 一覧表示用のキー先頭部分
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{read}',   -- read, write
+    expires_at TIMESTAMP WITH TIME ZONE,       -- NULL = 無期限
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_user ON api_keys (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- 外部IdP (ORCID・大学のSSOなど) のアカウントとの紐付け
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(64) NOT NULL,             -- 設定上のプロバイダー名 (orcid など)
+    subject VARCHAR(255) NOT NULL,             -- IdP 側の sub クレーム
+    email VARCHAR(255),
+    orcid VARCHAR(19),                         -- ORCID iD (0000-0000-0000-0000)
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user ON user_identities (user_id);
+
+-- 認可リクエスト中の state / nonce / PKCE verifier を一時的に保存する
+CREATE TABLE oidc_login_states (
+    state VARCHAR(64) PRIMARY KEY,
+    provider VARCHAR(64) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- プロフィール・アカウント設定
+ALTER TABLE users
+    ADD COLUMN display_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN affiliation VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN orcid VARCHAR(19) NOT NULL DEFAULT '',                -- 0000-0000-0000-0000
+    ADD COLUMN default_license VARCHAR(32) NOT NULL DEFAULT 'CC-BY-4.0',
+    ADD COLUMN default_visibility VARCHAR(16) NOT NULL DEFAULT 'private', -- private, public
+    ADD COLUMN preferred_language VARCHAR(8) NOT NULL DEFAULT 'ja';
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN display_name,
+    DROP COLUMN affiliation,
+    DROP COLUMN orcid,
+    DROP COLUMN default_license,
+    DROP COLUMN default_visibility,
+    DROP COLUMN preferred_language;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- レート制限のトークンバケット (RATE_LIMIT_STORE=postgres のときに使う)
+CREATE TABLE rate_limit_buckets (
+    key VARCHAR(255) PRIMARY KEY,              -- 例: login:ip:127.0.0.1, search:user:<uuid>
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL DEFAULT TRUE,     -- 直近の Take が許可されたか
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ログイン失敗回数と段階的ロック
+CREATE TABLE login_failures (
+    key VARCHAR(255) PRIMARY KEY,              -- 例: email:foo@example.com
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_failures;
+DROP TABLE IF EXISTS rate_limit_buckets;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- 監査ログ (誰がいつ何を変更したか)。追記のみで、更新・削除はトリガーで禁止する
+CREATE TABLE audit_logs (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    actor_id UUID,                             -- 未ログイン操作 (ログイン失敗など) は NULL
+    action VARCHAR(64) NOT NULL,               -- 例: occurrence.create, auth.login_failed, admin.occurrence.delete
+    target_uri TEXT NOT NULL DEFAULT '',
+    before_summary JSONB,
+    after_summary JSONB,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_audit_logs_occurred_at ON audit_logs (occurred_at DESC);
+CREATE INDEX idx_audit_logs_actor ON audit_logs (actor_id, occurred_at DESC);
+CREATE INDEX idx_audit_logs_target ON audit_logs (target_uri, occurred_at DESC);
+CREATE INDEX idx_audit_logs_action ON audit_logs (action, occurred_at DESC);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_logs_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS audit_logs_no_update_delete ON audit_logs;
+DROP FUNCTION IF EXISTS audit_logs_append_only();
+DROP TABLE IF EXISTS audit_logs;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- Fuseki の変更を Meilisearch に反映するための outbox
+-- 記録を変更する前に積んでおき、ワーカーが Fuseki の最新の状態をインデックスに写す (反映できたら行を消す)
+CREATE TABLE search_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    operation VARCHAR(16) NOT NULL,            -- index / delete (きっかけになった操作。実際には Fuseki の状態に合わせる)
+    occurrence_uri TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending', -- pending / failed (failed は再試行を諦めたもの)
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT search_outbox_operation_check CHECK (operation IN ('index', 'delete')),
+    CONSTRAINT search_outbox_status_check CHECK (status IN ('pending', 'failed'))
+);
+
+CREATE INDEX idx_search_outbox_due ON search_outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_search_outbox_status ON search_outbox (status, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS search_outbox;
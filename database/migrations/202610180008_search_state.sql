@@ -0,0 +1,11 @@
+-- +goose Up
+-- 検索インデックスの状態 (複数台で共有する)
+-- lineage_version: 今のインデックスの系統 (taxon_ancestors) を作ったときの分類 (ncbitaxon グラフ) の読み込み日時
+CREATE TABLE search_state (
+    name VARCHAR(64) PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS search_state;
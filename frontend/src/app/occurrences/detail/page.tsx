@@ -69,7 +69,12 @@ function DetailContent() {
 
     const fetchDetail = async () => {
       try {
-      	const res = await fetch(`${API_URL}/api/occurrences/${id}`); 
+        // 非公開の記録は持ち主にしか返らないので、ログインしていればトークンを付ける
+        const headers: HeadersInit = {};
+        if (token) {
+          headers["Authorization"] = `Bearer ${token}`;
+        }
+      	const res = await fetch(`${API_URL}/api/occurrences/${id}`, { headers }); 
         if (!res.ok) throw new Error("取得失敗");
         const json = await res.json();
         setData(json);
@@ -80,7 +85,7 @@ function DetailContent() {
       }
     };
     fetchDetail();
-  }, [id]);
+  }, [id, token]);
 
   if (!id) return <div className="p-10 text-center">IDが指定されていません</div>;
   if (loading) return <div className="p-10 flex justify-center"><Loader2 className="animate-spin" /></div>;
@@ -4,6 +4,7 @@ import { useEffect, useState, Suspense } from "react";
 import { useSearchParams, useRouter } from "next/navigation";
 import { Loader2 } from "lucide-react";
 import OccurrenceForm from "@/components/OccurrenceForm"; // 改造したフォームを使う
+import { useAuth } from "@/contexts/AuthContext";
 
 const API_URL = process.env.NEXT_PUBLIC_API_URL;
 
@@ -11,11 +12,17 @@ function EditContent() {
   const searchParams = useSearchParams();
   const id = searchParams.get("id");
   const [initialData, setInitialData] = useState<any>(null);
+  const { token } = useAuth();
 
   useEffect(() => {
     if (!id) return;
     // 既存データを取得してフォームの初期値にする
-    fetch(`${API_URL}/api/occurrences/${id}`)
+    // 非公開の記録は持ち主にしか返らないのでトークンを付ける
+    const headers: HeadersInit = {};
+    if (token) {
+      headers["Authorization"] = `Bearer ${token}`;
+    }
+    fetch(`${API_URL}/api/occurrences/${id}`, { headers })
       .then((res) => res.json())
       .then((data) => {
         // APIのレスポンスをフォームの形に合わせる（traitsにuri等は不要なので）
@@ -26,7 +33,7 @@ function EditContent() {
             traits: data.traits,
         });
       });
-  }, [id]);
+  }, [id, token]);
 
   if (!initialData) return <div className="p-10 flex justify-center"><Loader2 className="animate-spin" /></div>;
 
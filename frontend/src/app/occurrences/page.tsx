@@ -16,6 +16,13 @@ type ListItem = {
   created_at?: string;
 };
 
+// /api/search の返り値 (facets は facets= を付けたときだけ)
+type SearchResponse = {
+  total: number;
+  hits: ListItem[];
+  facets?: Record<string, Record<string, number>>;
+};
+
 export default function OccurrenceList() {
   const [list, setList] = useState<ListItem[]>([]);
   const [loading, setLoading] = useState(true);
@@ -46,9 +53,9 @@ export default function OccurrenceList() {
       const res = await fetch(url, { headers });
       
       if (!res.ok) throw new Error("取得失敗");
-      const data = await res.json();
+      const data: SearchResponse = await res.json();
       
-      setList(data || []);
+      setList(data.hits || []);
     } catch (err) {
       console.error(err);
       setList([]);